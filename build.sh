@@ -4,17 +4,30 @@ set -e
 
 mkdir -p bin
 
+VERSION="${RELEASE_VERSION:-$(git describe --tags --always 2>/dev/null || echo dev)}"
+COMMIT="$(git rev-parse --short HEAD 2>/dev/null || echo none)"
+LDFLAGS="-X main.version=${VERSION} -X main.commit=${COMMIT}"
+
+echo "Building version ${VERSION} (commit ${COMMIT})..."
+
 echo "Building for Linux (amd64)..."
-GOOS=linux GOARCH=amd64 go build -o bin/BPB-Terminal-Wizard-linux-amd64 src/main.go
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o bin/BPB-Terminal-Wizard-linux-amd64 ./src
 
 echo "Building for Linux (arm64)..."
-GOOS=linux GOARCH=arm64 go build -o bin/BPB-Terminal-Wizard-linux-arm64 src/main.go
+GOOS=linux GOARCH=arm64 go build -ldflags "$LDFLAGS" -o bin/BPB-Terminal-Wizard-linux-arm64 ./src
 
 echo "Building for macOS (amd64)..."
-GOOS=darwin GOARCH=amd64 go build -o bin/BPB-Terminal-Wizard-darwin-amd64 src/main.go
+GOOS=darwin GOARCH=amd64 go build -ldflags "$LDFLAGS" -o bin/BPB-Terminal-Wizard-darwin-amd64 ./src
 
 echo "Building for macOS (arm64)..."
-GOOS=darwin GOARCH=arm64 go build -o bin/BPB-Terminal-Wizard-darwin-arm64 src/main.go
+GOOS=darwin GOARCH=arm64 go build -ldflags "$LDFLAGS" -o bin/BPB-Terminal-Wizard-darwin-arm64 ./src
+
+echo "Writing checksums..."
+if command -v sha256sum >/dev/null 2>&1; then
+    (cd bin && sha256sum BPB-Terminal-Wizard-* > SHA256SUMS)
+else
+    (cd bin && shasum -a 256 BPB-Terminal-Wizard-* > SHA256SUMS)
+fi
 
 echo "Build completed successfully!"
-ls -l bin/
\ No newline at end of file
+ls -l bin/
@@ -3,3 +3,12 @@ module github.com/4n0nymou3/BPB-Terminal-Wizard
 go 1.24.1
 
 require github.com/google/uuid v1.6.0
+
+require (
+	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.38.0
+	golang.org/x/term v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.31.0 // indirect
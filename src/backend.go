@@ -0,0 +1,208 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Backend performs the Cloudflare side of a deployment.
+type Backend interface {
+    Login() error
+    NameStatus(name, deployType string) (nameStatus, error)
+    CreateKV(title string) (string, error)
+    Deploy(dir, name, deployType string, secrets map[string]string) (string, error)
+    AccountID() (string, error)
+}
+
+var errLoginTimeout = errors.New("timeout waiting for OAuth URL")
+
+var (
+    loginURLTimeout   = 60 * time.Second
+    loginPollInterval = 1 * time.Second
+)
+
+// wranglerBackend drives the locally installed Wrangler CLI.
+type wranglerBackend struct {
+    installDir string
+    runner     Runner
+    createdMu  sync.Mutex
+    created    map[string]bool
+    apiMu      sync.Mutex
+    api        *cloudflareClient
+}
+
+func newWranglerBackend(installDir string) *wranglerBackend {
+    return &wranglerBackend{installDir: installDir, runner: commandRunner}
+}
+
+// run makes a single attempt; callers retry through retryPolicy so
+// Wrangler failures are never retried at two levels.
+func (b *wranglerBackend) run(args string) (string, error) {
+    return b.runIn(b.installDir, args)
+}
+
+// runIn runs Wrangler in dir, the directory holding a panel's wrangler.json.
+func (b *wranglerBackend) runIn(dir, args string) (string, error) {
+    return runWith(b.runner, dir, wranglerCommand(b.installDir, args), 1)
+}
+
+func (b *wranglerBackend) Login() error {
+    var stdoutBuf syncBuffer
+    command := wranglerCommand(b.installDir, "login")
+    start := time.Now()
+    proc, err := b.runner.Start(b.installDir, command, &stdoutBuf)
+    if err != nil {
+        return fmt.Errorf("error starting Cloudflare login: %v", err)
+    }
+
+    timeout := time.After(loginURLTimeout)
+    ticker := time.NewTicker(loginPollInterval)
+    defer ticker.Stop()
+
+    var oauthURL string
+    for oauthURL == "" {
+        select {
+        case <-timeout:
+            fmt.Printf("%s Debug: Wrangler output: %s\n", infoPrefix, redact(stdoutBuf.String()))
+            logCommand(command, start, stdoutBuf.String(), errLoginTimeout)
+            return permanent(errLoginTimeout)
+        case <-ticker.C:
+            oauthURL, err = extractOAuthURL(stdoutBuf.String())
+            if err != nil {
+                oauthURL = ""
+            }
+        }
+    }
+
+    fmt.Printf("%s Found OAuth URL: %s%s%s\n", infoPrefix, blue, oauthURL, reset)
+    if _, err := b.runner.Run("", openURLCommand(oauthURL)); err != nil {
+        fmt.Printf("%s Could not open browser automatically.\nPlease open this URL manually: %s%s%s\n", warnPrefix, blue, oauthURL, reset)
+    } else {
+        fmt.Printf("%s Browser opened with URL: %s%s%s\n", infoPrefix, blue, oauthURL, reset)
+    }
+
+    err = proc.Wait()
+    logCommand(command, start, stdoutBuf.String(), err)
+    if err != nil {
+        return fmt.Errorf("error logging into Cloudflare: %v", err)
+    }
+
+    if _, err := b.run("telemetry disable"); err != nil {
+        fmt.Printf("%s Warning: Could not disable telemetry, continuing anyway...\n", warnPrefix)
+    }
+    return nil
+}
+
+func (b *wranglerBackend) cloudflare() (*cloudflareClient, error) {
+    b.apiMu.Lock()
+    defer b.apiMu.Unlock()
+    if b.api == nil {
+        api, err := newCloudflareClient(b.installDir, func() error {
+            _, err := b.run("whoami")
+            return err
+        })
+        if err != nil {
+            return nil, err
+        }
+        b.api = api
+    }
+    return b.api, nil
+}
+
+func (b *wranglerBackend) NameStatus(name, deployType string) (nameStatus, error) {
+    api, err := b.cloudflare()
+    if err != nil {
+        return nameUnknown, err
+    }
+    return api.nameStatus(name, deployType)
+}
+
+// AccountID is the Cloudflare account the current login deploys to.
+func (b *wranglerBackend) AccountID() (string, error) {
+    api, err := b.cloudflare()
+    if err != nil {
+        return "", err
+    }
+    return api.accountID, nil
+}
+
+func (b *wranglerBackend) CreateKV(title string) (string, error) {
+    output, err := b.run("kv namespace create " + title)
+    if err != nil {
+        return "", fmt.Errorf("%w, output: %s", err, output)
+    }
+    id, err := extractKvID(output)
+    if err != nil {
+        return "", permanent(fmt.Errorf("error getting KV ID: %v, output: %s", err, output))
+    }
+    return id, nil
+}
+
+// putSecrets uploads secrets in one call so they never appear in the
+// generated config or on a command line.
+func (b *wranglerBackend) putSecrets(dir, name, deployType string, secrets map[string]string) error {
+    path, err := writeSecretsFile(dir, name, secrets)
+    if err != nil {
+        return permanent(err)
+    }
+    defer os.Remove(path)
+    args := fmt.Sprintf("secret bulk %s --name %s", shellQuote(path), name)
+    if deployType == "2" {
+        args = fmt.Sprintf("pages secret bulk %s --project-name %s", shellQuote(path), name)
+    }
+    if output, err := b.runIn(dir, args); err != nil {
+        return fmt.Errorf("error uploading secrets: %w, output: %s", err, output)
+    }
+    return nil
+}
+
+// Deploy publishes the panel. Secrets are uploaded first so the new
+// version never runs without them; for Workers, secret bulk creates the
+// script if it does not exist yet.
+func (b *wranglerBackend) Deploy(dir, name, deployType string, secrets map[string]string) (string, error) {
+    if deployType == "1" {
+        if len(secrets) > 0 {
+            if err := b.putSecrets(dir, name, deployType, secrets); err != nil {
+                return "", err
+            }
+        }
+        output, err := b.runIn(dir, "deploy ./src/worker.js")
+        if err != nil {
+            return "", fmt.Errorf("%w, output: %s", err, output)
+        }
+        url, err := extractURL(output)
+        if err != nil {
+            return "", permanent(fmt.Errorf("error getting URL: %v", err))
+        }
+        return url, nil
+    }
+
+    b.createdMu.Lock()
+    created := b.created[name]
+    b.createdMu.Unlock()
+    if !created {
+        // Redeploying an existing panel finds its project already there.
+        if output, err := b.runIn(dir, fmt.Sprintf("pages project create %s --production-branch production", name)); err != nil && !strings.Contains(output, "already exists") {
+            return "", fmt.Errorf("error creating Pages project: %w, output: %s", err, output)
+        }
+        b.createdMu.Lock()
+        if b.created == nil {
+            b.created = map[string]bool{}
+        }
+        b.created[name] = true
+        b.createdMu.Unlock()
+    }
+    if len(secrets) > 0 {
+        if err := b.putSecrets(dir, name, deployType, secrets); err != nil {
+            return "", err
+        }
+    }
+    if output, err := b.runIn(dir, "pages deploy --commit-dirty true --branch production"); err != nil {
+        return "", fmt.Errorf("%w, output: %s", err, output)
+    }
+    return "https://" + name + ".pages.dev", nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    maxBatchCount       = 50
+    maxBatchConcurrency = 10
+)
+
+var (
+    batchCount       = 1
+    batchProfiles    stringList
+    batchConcurrency = 3
+    sharedKV         bool
+    batchResultsPath string
+)
+
+// batchResult is one row of the batch summary and export.
+type batchResult struct {
+    Index      int     `json:"index"`
+    Profile    string  `json:"profile,omitempty"`
+    Name       string  `json:"name,omitempty"`
+    DeployType string  `json:"deploy_type,omitempty"`
+    Status     string  `json:"status"`
+    PanelURL   string  `json:"panel_url,omitempty"`
+    KVID       string  `json:"kv_id,omitempty"`
+    UUID       string  `json:"uuid,omitempty"`
+    TrPass     string  `json:"tr_pass,omitempty"`
+    SubPath    string  `json:"sub_path,omitempty"`
+    Error      string  `json:"error,omitempty"`
+    Seconds    float64 `json:"seconds"`
+}
+
+// deploySettings is everything a profile can change, so each panel of a
+// batch starts from the command-line settings.
+type deploySettings struct {
+    deployType    string
+    nameStyle     string
+    namePrefix    string
+    nameTemplate  string
+    secretsMode   bool
+    workerVersion string
+    workerSHA256  string
+    workerFile    string
+    workerURLs    stringList
+    customDomain  string
+    profileName   string
+    panel         panelOptions
+}
+
+func captureSettings() deploySettings {
+    return deploySettings{deployType, nameStyle, namePrefix, nameTemplate, secretsMode, workerVersion, workerSHA256, workerFile, workerURLs, customDomain, profileName, panelSettings}
+}
+
+func (s deploySettings) restore() {
+    deployType, nameStyle, namePrefix, nameTemplate = s.deployType, s.nameStyle, s.namePrefix, s.nameTemplate
+    secretsMode, workerVersion, workerSHA256, workerFile, workerURLs = s.secretsMode, s.workerVersion, s.workerSHA256, s.workerFile, s.workerURLs
+    customDomain, profileName, panelSettings = s.customDomain, s.profileName, s.panel
+}
+
+// deployBatch deploys count panels for each profile, or count panels with
+// the current settings when no profiles are given. Names, credentials and
+// worker scripts are prepared one panel at a time; creating KV namespaces
+// and deploying runs up to batchConcurrency panels at once.
+func deployBatch(installDir string, backend Backend, profiles []*panelProfile, explicit map[string]bool) []batchResult {
+    if len(profiles) == 0 {
+        profiles = []*panelProfile{nil}
+    }
+    var plan []*panelProfile
+    for _, profile := range profiles {
+        for i := 0; i < batchCount; i++ {
+            plan = append(plan, profile)
+        }
+    }
+
+    batchDir := filepath.Join(installDir, "batch")
+    if err := os.RemoveAll(batchDir); err != nil {
+        fmt.Printf("%s Warning: Could not clear %s: %v\n", warnPrefix, batchDir, err)
+    }
+
+    base := captureSettings()
+    defer base.restore()
+
+    results := make([]batchResult, len(plan))
+    deployments := make([]*Deployment, len(plan))
+    planned := map[string]bool{}
+    for i, profile := range plan {
+        base.restore()
+        results[i] = batchResult{Index: i + 1, Status: "failed"}
+        if profile != nil {
+            deployFlag := deployType
+            applyProfile(profile, explicit, &deployFlag)
+            deployType = deployFlag
+            results[i].Profile = profile.Name
+        }
+        if profileName != "" {
+            fmt.Printf("\n%s Planning panel %d of %d (profile %s)...\n", titlePrefix, i+1, len(plan), profileName)
+        } else {
+            fmt.Printf("\n%s Planning panel %d of %d...\n", titlePrefix, i+1, len(plan))
+        }
+
+        start := time.Now()
+        dir := filepath.Join(batchDir, fmt.Sprintf("panel-%d", i+1))
+        deployment, err := planPanel(installDir, dir, backend, func(name string) bool { return planned[name] })
+        results[i].Seconds = time.Since(start).Seconds()
+        if err != nil {
+            results[i].Error = redact(err.Error())
+            continue
+        }
+        planned[deployment.Name] = true
+        deployments[i] = deployment
+        results[i].Name, results[i].DeployType = deployment.Name, deployment.DeployType
+    }
+    base.restore()
+
+    if sharedKV && len(planned) > 0 {
+        logStep("create-kv")
+        shared := &Deployment{KVID: panelSettings.KVID}
+        fmt.Printf("\n%s Preparing a KV namespace shared by all panels...\n", titlePrefix)
+        if err := createKVNamespace(shared, backend, "shared"); err != nil {
+            for i, deployment := range deployments {
+                if deployment != nil {
+                    results[i].Error = "shared KV namespace: " + redact(err.Error())
+                    deployments[i] = nil
+                }
+            }
+        }
+        for _, deployment := range deployments {
+            if deployment != nil && deployment.KVID == "" {
+                deployment.KVID = shared.KVID
+            }
+        }
+    }
+
+    logStep("deploy")
+    fmt.Printf("\n%s Deploying %d panel(s), %d at a time...\n", titlePrefix, len(plan), min(max(batchConcurrency, 1), maxBatchConcurrency))
+    runLimited(len(deployments), batchConcurrency, func(i int) {
+        deployment, result := deployments[i], &results[i]
+        if deployment == nil {
+            return
+        }
+        start := time.Now()
+        err := executePanel(filepath.Join(batchDir, fmt.Sprintf("panel-%d", i+1)), deployment, backend, deployment.Name)
+        result.Seconds += time.Since(start).Seconds()
+        result.KVID = deployment.KVID
+        if err != nil {
+            result.Error = redact(err.Error())
+            return
+        }
+        panelf(deployment.Name, successPrefix, "Panel deployed successfully!")
+        result.Status = "deployed"
+        result.PanelURL = deployment.PanelURL
+        if showSecrets {
+            result.UUID, result.TrPass, result.SubPath = deployment.UUID, deployment.TrPass, deployment.SubPath
+        }
+        if err := recordDeployment(installDir, *deployment); err != nil {
+            panelf(deployment.Name, warnPrefix, "Warning: Could not save deployment record: %v", err)
+        }
+    })
+
+    if err := tightenPermissions(installDir); err != nil {
+        fmt.Printf("%s Warning: Could not restrict permissions in %s: %v\n", warnPrefix, installDir, err)
+    }
+    return results
+}
+
+// runLimited calls fn for 0..n-1 with at most concurrency calls running
+// at once, capped at maxBatchConcurrency.
+func runLimited(n, concurrency int, fn func(i int)) {
+    slots := make(chan struct{}, min(max(concurrency, 1), maxBatchConcurrency))
+    var wg sync.WaitGroup
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            slots <- struct{}{}
+            defer func() { <-slots }()
+            fn(i)
+        }(i)
+    }
+    wg.Wait()
+}
+
+func printBatchSummary(results []batchResult) {
+    deployed := 0
+    fmt.Printf("\n  %-4s %-14s %-34s %-9s %s\n", "#", "PROFILE", "NAME", "STATUS", "URL / ERROR")
+    for _, result := range results {
+        color, detail := green, result.PanelURL
+        if result.Status != "deployed" {
+            color, detail = red, result.Error
+        } else {
+            deployed++
+        }
+        profile := result.Profile
+        if profile == "" {
+            profile = "-"
+        }
+        fmt.Printf("  %-4d %-14s %-34s %s%-9s%s %s\n", result.Index, profile, result.Name, bold+color, result.Status, reset, detail)
+    }
+    if deployed == len(results) {
+        successMessage(fmt.Sprintf("All %d panels deployed.", deployed))
+    } else {
+        fmt.Printf("\n%s %d of %d panels deployed, %d failed.\n", warnPrefix, deployed, len(results), len(results)-deployed)
+    }
+}
+
+// writeBatchResults exports the results as JSON and CSV. A path ending in
+// .json or .csv writes only that format; any other path is used as the
+// base name for both.
+func writeBatchResults(path string, results []batchResult) ([]string, error) {
+    var paths []string
+    switch filepath.Ext(path) {
+    case ".json", ".csv":
+        paths = []string{path}
+    default:
+        paths = []string{path + ".json", path + ".csv"}
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return nil, fmt.Errorf("error creating results directory: %v", err)
+    }
+    for _, path := range paths {
+        var data []byte
+        if filepath.Ext(path) == ".json" {
+            var err error
+            if data, err = json.MarshalIndent(results, "", "  "); err != nil {
+                return nil, fmt.Errorf("error encoding results: %v", err)
+            }
+        } else {
+            var b strings.Builder
+            w := csv.NewWriter(&b)
+            w.Write([]string{"index", "profile", "name", "deploy_type", "status", "panel_url", "kv_id", "uuid", "tr_pass", "sub_path", "error", "seconds"})
+            for _, r := range results {
+                w.Write([]string{strconv.Itoa(r.Index), r.Profile, r.Name, r.DeployType, r.Status, r.PanelURL, r.KVID, r.UUID, r.TrPass, r.SubPath, r.Error, strconv.FormatFloat(r.Seconds, 'f', 1, 64)})
+            }
+            w.Flush()
+            data = []byte(b.String())
+        }
+        if err := os.WriteFile(path, data, 0600); err != nil {
+            return nil, fmt.Errorf("error writing %s: %v", path, err)
+        }
+    }
+    return paths, nil
+}
+
+func defaultBatchResultsPath(installDir string) string {
+    return filepath.Join(installDir, "batches", "batch-"+time.Now().Format("20060102-150405"))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func setupBatch(t *testing.T, count, concurrency int, shared bool) {
+    t.Helper()
+    savedCount, savedConcurrency, savedShared := batchCount, batchConcurrency, sharedKV
+    t.Cleanup(func() {
+        batchCount, batchConcurrency, sharedKV = savedCount, savedConcurrency, savedShared
+    })
+    batchCount, batchConcurrency, sharedKV = count, concurrency, shared
+}
+
+func TestBatchDeployUniqueNames(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    setupBatch(t, 3, 3, false)
+    backend := newMemoryBackend()
+
+    results := deployBatch(installDir, backend, nil, map[string]bool{})
+    if len(results) != 3 {
+        t.Fatalf("got %d results, want 3", len(results))
+    }
+    names := map[string]bool{}
+    for _, result := range results {
+        if result.Status != "deployed" {
+            t.Fatalf("panel %d: %s (%s)", result.Index, result.Status, result.Error)
+        }
+        if names[result.Name] {
+            t.Errorf("name %s used twice", result.Name)
+        }
+        names[result.Name] = true
+        if backend.deployed[result.Name]+"/panel" != result.PanelURL {
+            t.Errorf("panel %d: URL %q not served by the backend", result.Index, result.PanelURL)
+        }
+        if result.UUID != "" {
+            t.Errorf("panel %d: credentials exported without -show-secrets", result.Index)
+        }
+    }
+    if len(backend.namespaces) != 3 {
+        t.Errorf("created %d KV namespaces, want 3", len(backend.namespaces))
+    }
+    deployments, err := loadDeployments(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(deployments) != 3 {
+        t.Errorf("recorded %d deployments, want 3", len(deployments))
+    }
+}
+
+func TestBatchDeploySharedKV(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    setupBatch(t, 4, 2, true)
+    backend := newMemoryBackend()
+
+    results := deployBatch(installDir, backend, nil, map[string]bool{})
+    if len(backend.namespaces) != 1 {
+        t.Fatalf("created %d KV namespaces, want 1", len(backend.namespaces))
+    }
+    for _, result := range results {
+        if result.Status != "deployed" || result.KVID != results[0].KVID {
+            t.Errorf("panel %d: status %s, KV %q", result.Index, result.Status, result.KVID)
+        }
+    }
+}
+
+func TestBatchDeployPartialFailure(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    setupBatch(t, 3, 1, false)
+    backend := newMemoryBackend()
+    backend.deployFailures = defaultRetryPolicy.maxAttempts
+
+    results := deployBatch(installDir, backend, nil, map[string]bool{})
+    failed := 0
+    for _, result := range results {
+        if result.Status != "deployed" {
+            failed++
+            if !strings.Contains(result.Error, "deploy failed") {
+                t.Errorf("panel %d: error %q", result.Index, result.Error)
+            }
+        }
+    }
+    if failed != 1 || len(backend.deployed) != 2 {
+        t.Errorf("%d failed and %d deployed, want 1 and 2", failed, len(backend.deployed))
+    }
+}
+
+func TestWriteBatchResults(t *testing.T) {
+    results := []batchResult{
+        {Index: 1, Profile: "eu", Name: "panel-one", Status: "deployed", PanelURL: "https://panel-one.example.workers.dev/panel", Seconds: 1.25},
+        {Index: 2, Profile: "eu", Status: "failed", Error: "deploy failed, \"quoted\""},
+    }
+    base := filepath.Join(t.TempDir(), "out", "batch")
+    paths, err := writeBatchResults(base, results)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(paths) != 2 {
+        t.Fatalf("wrote %v, want a JSON and a CSV file", paths)
+    }
+
+    data, err := os.ReadFile(base + ".json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var decoded []batchResult
+    if err := json.Unmarshal(data, &decoded); err != nil {
+        t.Fatal(err)
+    }
+    if len(decoded) != 2 || decoded[1].Error != results[1].Error {
+        t.Errorf("JSON round trip: %+v", decoded)
+    }
+
+    f, err := os.Open(base + ".csv")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(rows) != 3 || rows[1][2] != "panel-one" || rows[2][10] != results[1].Error {
+        t.Errorf("CSV rows: %q", rows)
+    }
+
+    only := filepath.Join(t.TempDir(), "results.csv")
+    if paths, err := writeBatchResults(only, results); err != nil || len(paths) != 1 || paths[0] != only {
+        t.Errorf("explicit .csv path wrote %v, %v", paths, err)
+    }
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "runtime"
+    "sort"
+    "strings"
+    "time"
+)
+
+const (
+    maxWranglerLogs    = 3
+    maxReportFileBytes = 512 * 1024
+)
+
+var (
+    // accountIDRe matches Cloudflare account, zone and namespace IDs.
+    accountIDRe = regexp.MustCompile(`\b[0-9a-fA-F]{32}\b`)
+    uuidRe      = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+    emailRe     = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// reportFile is one entry of a bug report archive.
+type reportFile struct {
+    Name   string
+    Source string
+    Data   []byte
+}
+
+// scrubReport removes credentials, IDs and e-mail addresses from text
+// that goes into a bug report. It is stricter than redact because the
+// report leaves the machine.
+func scrubReport(text string) string {
+    text = redact(text)
+    text = uuidRe.ReplaceAllString(text, redactedMark)
+    text = accountIDRe.ReplaceAllString(text, "[REDACTED-ID]")
+    return emailRe.ReplaceAllString(text, "[REDACTED-EMAIL]")
+}
+
+// tailBytes keeps the last limit bytes of data, where the failure is.
+func tailBytes(data []byte, limit int) []byte {
+    if len(data) <= limit {
+        return data
+    }
+    return append([]byte("...\n"), data[len(data)-limit:]...)
+}
+
+func wranglerLogDirs() []string {
+    var dirs []string
+    if dir := os.Getenv("WRANGLER_LOG_PATH"); dir != "" {
+        dirs = append(dirs, dir)
+    }
+    for _, path := range wranglerConfigPaths() {
+        dirs = append(dirs, filepath.Join(filepath.Dir(filepath.Dir(path)), "logs"))
+    }
+    return dirs
+}
+
+// recentWranglerLogs returns the newest Wrangler debug logs.
+func recentWranglerLogs() []string {
+    type logFile struct {
+        path    string
+        modTime time.Time
+    }
+    var logs []logFile
+    seen := map[string]bool{}
+    for _, dir := range wranglerLogDirs() {
+        entries, err := os.ReadDir(dir)
+        if err != nil {
+            continue
+        }
+        for _, entry := range entries {
+            path := filepath.Join(dir, entry.Name())
+            if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".log") || seen[path] {
+                continue
+            }
+            seen[path] = true
+            if info, err := entry.Info(); err == nil {
+                logs = append(logs, logFile{path, info.ModTime()})
+            }
+        }
+    }
+    sort.Slice(logs, func(i, j int) bool { return logs[i].modTime.After(logs[j].modTime) })
+    var paths []string
+    for i := 0; i < len(logs) && i < maxWranglerLogs; i++ {
+        paths = append(paths, logs[i].path)
+    }
+    return paths
+}
+
+// redactWranglerConfig blanks the panel credentials and IDs in
+// wrangler.json and registers them so they are scrubbed from the logs too.
+func redactWranglerConfig(data []byte) ([]byte, error) {
+    var config map[string]any
+    if err := json.Unmarshal(data, &config); err != nil {
+        return nil, fmt.Errorf("error parsing wrangler.json: %v", err)
+    }
+    if vars, ok := config["vars"].(map[string]any); ok {
+        for _, key := range []string{"UUID", "TR_PASS", "SUB_PATH"} {
+            if value, ok := vars[key].(string); ok {
+                registerSecret(value)
+                vars[key] = redactedMark
+            }
+        }
+    }
+    if accountID, ok := config["account_id"].(string); ok {
+        registerSecret(accountID)
+        config["account_id"] = "[REDACTED-ID]"
+    }
+    if namespaces, ok := config["kv_namespaces"].([]any); ok {
+        for _, namespace := range namespaces {
+            if binding, ok := namespace.(map[string]any); ok {
+                binding["id"] = "[REDACTED-ID]"
+            }
+        }
+    }
+    return json.MarshalIndent(config, "", "  ")
+}
+
+func formatDoctorReport(checks []DoctorCheck) string {
+    var b strings.Builder
+    for _, check := range checks {
+        fmt.Fprintf(&b, "%-6s %-18s %s\n", check.Status, check.Name, check.Detail)
+        if check.Hint != "" && check.Status != statusPass {
+            fmt.Fprintf(&b, "       hint: %s\n", check.Hint)
+        }
+    }
+    return b.String()
+}
+
+// registerReportSecrets registers every credential the install knows, so
+// that scrubReport removes it. The vault is unlocked even if that needs a
+// prompt: without it the panel credentials could reach the report.
+func registerReportSecrets(installDir string) error {
+    envelope, err := readVaultEnvelope(installDir)
+    if err != nil {
+        return err
+    }
+    data := &vaultData{}
+    if envelope != nil {
+        if data, err = loadVault(installDir); err != nil {
+            return fmt.Errorf("the vault must be unlocked to remove the panel credentials from the report: %v", err)
+        }
+    } else if legacy, err := os.ReadFile(registryPath(installDir)); err == nil {
+        if err := json.Unmarshal(legacy, &data.Deployments); err != nil {
+            return fmt.Errorf("error parsing deployment records: %v", err)
+        }
+    }
+    for i := range data.Deployments {
+        for _, value := range panelSecrets(&data.Deployments[i]) {
+            registerSecret(value)
+        }
+    }
+    for _, token := range data.Tokens {
+        registerSecret(token)
+    }
+
+    // Batch and fleet runs leave a wrangler.json in batch/panel-N and
+    // fleet/<name>; their credentials may be in the logs as well.
+    return filepath.WalkDir(installDir, func(path string, entry os.DirEntry, err error) error {
+        if err != nil {
+            return nil
+        }
+        if entry.IsDir() && entry.Name() == "node_modules" {
+            return filepath.SkipDir
+        }
+        if entry.IsDir() || entry.Name() != "wrangler.json" {
+            return nil
+        }
+        if config, err := os.ReadFile(path); err == nil {
+            redactWranglerConfig(config)
+        }
+        return nil
+    })
+}
+
+// collectBugReport gathers the report contents. Everything is scrubbed
+// before it is returned.
+func collectBugReport(installDir string, checks []DoctorCheck) ([]reportFile, error) {
+    system := fmt.Sprintf("%s\nplatform: %s\nos: %s/%s\ngenerated: %s\n", versionString(), detectPlatform(), runtime.GOOS, runtime.GOARCH, time.Now().UTC().Format(time.RFC3339))
+    files := []reportFile{
+        {Name: "system.txt", Source: "wizard", Data: []byte(system)},
+        {Name: "doctor.txt", Source: "doctor checks", Data: []byte(formatDoctorReport(checks))},
+    }
+
+    if id := cachedAccountID(installDir); id != "" {
+        registerSecret(id)
+    }
+    if id := os.Getenv("CLOUDFLARE_ACCOUNT_ID"); id != "" {
+        registerSecret(id)
+    }
+    if err := registerReportSecrets(installDir); err != nil {
+        return nil, err
+    }
+    configPath := filepath.Join(installDir, "wrangler.json")
+    if data, err := os.ReadFile(configPath); err == nil {
+        if redacted, err := redactWranglerConfig(data); err == nil {
+            files = append(files, reportFile{Name: "wrangler.json", Source: configPath, Data: redacted})
+        } else {
+            files = append(files, reportFile{Name: "wrangler.json.error", Source: configPath, Data: []byte(err.Error())})
+        }
+    }
+
+    if runs, err := listRunLogs(runLogDir(installDir)); err == nil && len(runs) > 0 {
+        path := filepath.Join(runLogDir(installDir), runs[0]+".jsonl")
+        if data, err := os.ReadFile(path); err == nil {
+            files = append(files, reportFile{Name: "run-log.jsonl", Source: path, Data: tailBytes(data, maxReportFileBytes)})
+        }
+    }
+
+    for _, path := range recentWranglerLogs() {
+        if data, err := os.ReadFile(path); err == nil {
+            files = append(files, reportFile{Name: "wrangler-logs/" + filepath.Base(path), Source: path, Data: tailBytes(data, maxReportFileBytes)})
+        }
+    }
+
+    for i := range files {
+        files[i].Data = []byte(scrubReport(string(files[i].Data)))
+    }
+    return files, nil
+}
+
+func printReportManifest(files []reportFile) {
+    fmt.Printf("\n  %-36s %-10s %s\n", "FILE", "SIZE", "SOURCE")
+    for _, file := range files {
+        fmt.Printf("  %s%-36s%s %-10s %s\n", cyan, file.Name, reset, formatBytes(int64(len(file.Data))), file.Source)
+    }
+}
+
+func writeBugReport(path string, files []reportFile) error {
+    out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+    if err != nil {
+        return fmt.Errorf("error creating %s: %v", path, err)
+    }
+    gz := gzip.NewWriter(out)
+    tw := tar.NewWriter(gz)
+    now := time.Now()
+    var manifest strings.Builder
+    for _, file := range files {
+        fmt.Fprintf(&manifest, "%s\t%d\t%s\n", file.Name, len(file.Data), file.Source)
+    }
+    files = append([]reportFile{{Name: "MANIFEST.txt", Data: []byte(manifest.String())}}, files...)
+    for _, file := range files {
+        header := &tar.Header{Name: "bpb-wizard-bug-report/" + file.Name, Mode: 0600, Size: int64(len(file.Data)), ModTime: now}
+        if err := tw.WriteHeader(header); err == nil {
+            _, err = tw.Write(file.Data)
+        }
+        if err != nil {
+            out.Close()
+            return fmt.Errorf("error writing %s: %v", file.Name, err)
+        }
+    }
+    if err := tw.Close(); err != nil {
+        out.Close()
+        return fmt.Errorf("error writing archive: %v", err)
+    }
+    if err := gz.Close(); err != nil {
+        out.Close()
+        return fmt.Errorf("error writing archive: %v", err)
+    }
+    return out.Close()
+}
+
+func runBugReport(args []string) {
+    fs := flag.NewFlagSet("bug-report", flag.ExitOnError)
+    output := fs.String("o", fmt.Sprintf("bpb-wizard-bug-report-%s.tar.gz", time.Now().Format("20060102-150405")), "Path of the archive to write")
+    dryRun := fs.Bool("dry-run", false, "Only show what would be included")
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    installDir, err := getInstallDir()
+    if err != nil {
+        failMessage("Error getting home directory", err)
+        return
+    }
+
+    fmt.Printf("\n%s Collecting a %sbug report%s...\n", titlePrefix, bold+blue, reset)
+    fmt.Printf("%s Running diagnostics...\n", infoPrefix)
+    files, err := collectBugReport(installDir, runDoctorChecks(installDir))
+    if err != nil {
+        failMessage("Could not collect the bug report", err)
+        return
+    }
+
+    fmt.Printf("\n%s The report contains these files. Credentials, account IDs, UUIDs and e-mail addresses have been removed:\n", infoPrefix)
+    printReportManifest(files)
+    if *dryRun {
+        return
+    }
+    if err := writeBugReport(*output, files); err != nil {
+        failMessage("Error writing bug report", err)
+        return
+    }
+    successMessage(fmt.Sprintf("Bug report written to %s. Please look through it before attaching it to an issue.", *output))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestBugReportIsScrubbed(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    home := t.TempDir()
+    t.Setenv("HOME", home)
+    t.Setenv("XDG_CONFIG_HOME", home)
+    t.Setenv("WRANGLER_HOME", "")
+    logDir := t.TempDir()
+    t.Setenv("WRANGLER_LOG_PATH", logDir)
+
+    const (
+        uuid      = "6f1c1f0e-3b1a-4d55-9d1e-2a8f0b1c3d4e"
+        trPass    = "tr0jan!Pass"
+        accountID = "0123456789abcdef0123456789abcdef"
+    )
+    config := `{"name":"panel","account_id":"` + accountID + `","vars":{"UUID":"` + uuid + `","TR_PASS":"` + trPass + `","SUB_PATH":"subpath-secret","PROXY_IP":"bpb.yousef.isegaro.com"},"kv_namespaces":[{"binding":"kv","id":"fedcba9876543210fedcba9876543210"}]}`
+    if err := os.WriteFile(filepath.Join(installDir, "wrangler.json"), []byte(config), 0600); err != nil {
+        t.Fatal(err)
+    }
+    batchDir := filepath.Join(installDir, "batch", "panel-2")
+    if err := os.MkdirAll(batchDir, 0700); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(batchDir, "wrangler.json"), []byte(`{"name":"panel-2","vars":{"TR_PASS":"batch-pass","SUB_PATH":"batch-sub"}}`), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if err := recordDeployment(installDir, Deployment{Name: "recorded", TrPass: "vault-pass", SubPath: "vault-sub"}); err != nil {
+        t.Fatal(err)
+    }
+    wranglerLog := "Your worker has access to: env.TR_PASS (\"" + trPass + "\")\nuploading batch-pass and batch-sub, then vault-pass and vault-sub\nGetting User settings...\nlogged in as someone@example.com for account " + accountID + "\nAuthorization: Bearer live-token-value\n"
+    if err := os.WriteFile(filepath.Join(logDir, "wrangler-2026-10-19.log"), []byte(wranglerLog), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if err := startRunLog(installDir, []string{"bpb-wizard"}); err != nil {
+        t.Fatal(err)
+    }
+    logMessage("error", "deploy failed")
+    finishRunLog()
+
+    checks := []DoctorCheck{{Name: "Node.js", Status: statusPass, Detail: "v22.1.0"}}
+    files, err := collectBugReport(installDir, checks)
+    if err != nil {
+        t.Fatal(err)
+    }
+    archive := filepath.Join(t.TempDir(), "report.tar.gz")
+    if err := writeBugReport(archive, files); err != nil {
+        t.Fatal(err)
+    }
+
+    file, err := os.Open(archive)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+    gz, err := gzip.NewReader(file)
+    if err != nil {
+        t.Fatal(err)
+    }
+    contents := map[string]string{}
+    tr := tar.NewReader(gz)
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            t.Fatal(err)
+        }
+        data, _ := io.ReadAll(tr)
+        contents[strings.TrimPrefix(header.Name, "bpb-wizard-bug-report/")] = string(data)
+    }
+
+    for _, name := range []string{"MANIFEST.txt", "system.txt", "doctor.txt", "run-log.jsonl", "wrangler.json", "wrangler-logs/wrangler-2026-10-19.log"} {
+        if _, ok := contents[name]; !ok {
+            t.Errorf("report is missing %s", name)
+        }
+    }
+    for name, data := range contents {
+        for _, secret := range []string{uuid, trPass, "subpath-secret", "batch-pass", "batch-sub", "vault-pass", "vault-sub", accountID, "fedcba9876543210", "someone@example.com", "live-token-value"} {
+            if strings.Contains(data, secret) {
+                t.Errorf("%s contains %q", name, secret)
+            }
+        }
+    }
+    if !strings.Contains(contents["wrangler.json"], "bpb.yousef.isegaro.com") {
+        t.Error("non-secret settings were removed from wrangler.json")
+    }
+    if !strings.Contains(contents["doctor.txt"], "v22.1.0") {
+        t.Error("doctor results are missing")
+    }
+
+    vaultKey, vaultKeySalt = nil, nil
+    t.Setenv(vaultPassphraseEnv, "")
+    if _, err := collectBugReport(installDir, checks); err == nil || !strings.Contains(err.Error(), "vault must be unlocked") {
+        t.Errorf("got %v, want the report refused while the vault is locked", err)
+    }
+}
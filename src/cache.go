@@ -0,0 +1,226 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+type CacheEntry struct {
+    Tag          string    `json:"tag"`
+    SHA256       string    `json:"sha256"`
+    URL          string    `json:"url"`
+    ETag         string    `json:"etag,omitempty"`
+    LastModified string    `json:"last_modified,omitempty"`
+    FetchedAt    time.Time `json:"fetched_at"`
+}
+
+type WorkerCache struct {
+    dir     string
+    Entries map[string]CacheEntry `json:"entries"`
+}
+
+func workerCacheDir(installDir string) string {
+    return filepath.Join(installDir, "cache", "worker")
+}
+
+func openWorkerCache(installDir string) (*WorkerCache, error) {
+    cache := &WorkerCache{dir: workerCacheDir(installDir), Entries: map[string]CacheEntry{}}
+    data, err := os.ReadFile(filepath.Join(cache.dir, "index.json"))
+    if errors.Is(err, os.ErrNotExist) {
+        return cache, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("error reading worker cache index: %v", err)
+    }
+    if err := json.Unmarshal(data, cache); err != nil {
+        return nil, fmt.Errorf("error parsing worker cache index: %v", err)
+    }
+    if cache.Entries == nil {
+        cache.Entries = map[string]CacheEntry{}
+    }
+    return cache, nil
+}
+
+func (c *WorkerCache) save() error {
+    if err := os.MkdirAll(c.dir, 0750); err != nil {
+        return fmt.Errorf("error creating cache directory: %v", err)
+    }
+    jsonData, err := json.MarshalIndent(c, "", "  ")
+    if err != nil {
+        return fmt.Errorf("error marshaling worker cache index: %v", err)
+    }
+    if err := os.WriteFile(filepath.Join(c.dir, "index.json"), jsonData, 0640); err != nil {
+        return fmt.Errorf("error writing worker cache index: %v", err)
+    }
+    return nil
+}
+
+func (c *WorkerCache) objectPath(digest string) string {
+    return filepath.Join(c.dir, "objects", strings.ToLower(digest)+".js")
+}
+
+func (c *WorkerCache) store(key string, entry CacheEntry, src string) error {
+    data, err := os.ReadFile(src)
+    if err != nil {
+        return fmt.Errorf("error reading worker script: %v", err)
+    }
+    sum := sha256.Sum256(data)
+    entry.SHA256 = hex.EncodeToString(sum[:])
+    if err := os.MkdirAll(filepath.Join(c.dir, "objects"), 0750); err != nil {
+        return fmt.Errorf("error creating cache directory: %v", err)
+    }
+    if err := os.WriteFile(c.objectPath(entry.SHA256), data, 0640); err != nil {
+        return fmt.Errorf("error writing cached worker script: %v", err)
+    }
+    entry.FetchedAt = time.Now().UTC()
+    c.Entries[key] = entry
+    return c.save()
+}
+
+func (c *WorkerCache) lookup(key string) (*CacheEntry, bool) {
+    entry, ok := c.Entries[key]
+    if !ok {
+        return nil, false
+    }
+    if _, err := os.Stat(c.objectPath(entry.SHA256)); err != nil {
+        return nil, false
+    }
+    return &entry, true
+}
+
+func (c *WorkerCache) restore(entry *CacheEntry, dest string) error {
+    data, err := os.ReadFile(c.objectPath(entry.SHA256))
+    if err != nil {
+        return fmt.Errorf("error reading cached worker script: %v", err)
+    }
+    sum := sha256.Sum256(data)
+    if !strings.EqualFold(hex.EncodeToString(sum[:]), entry.SHA256) {
+        os.Remove(c.objectPath(entry.SHA256))
+        return fmt.Errorf("cached worker script for %s is corrupted", entry.Tag)
+    }
+    if err := os.WriteFile(dest, data, 0640); err != nil {
+        return fmt.Errorf("error writing worker file: %v", err)
+    }
+    return nil
+}
+
+func revalidateDownload(url, dest string, cached *CacheEntry) (bool, string, string, error) {
+    header := http.Header{}
+    if cached != nil {
+        if cached.ETag != "" {
+            header.Set("If-None-Match", cached.ETag)
+        }
+        if cached.LastModified != "" {
+            header.Set("If-Modified-Since", cached.LastModified)
+        }
+    }
+    status, respHeader, err := downloadOnce(url, dest, header, maxWorkerSize)
+    if err != nil {
+        return false, "", "", err
+    }
+    if status == http.StatusNotModified {
+        if cached == nil {
+            return false, "", "", fmt.Errorf("unexpected HTTP 304 without a cached copy")
+        }
+        return true, cached.ETag, cached.LastModified, nil
+    }
+    return false, respHeader.Get("ETag"), respHeader.Get("Last-Modified"), nil
+}
+
+func (c *WorkerCache) prune(keep int, pinned map[string]bool) (int, error) {
+    var tags []string
+    for key, entry := range c.Entries {
+        if key != workerLatestTag {
+            tags = append(tags, entry.Tag)
+        }
+    }
+    sort.Slice(tags, func(i, j int) bool {
+        return c.Entries[tags[i]].FetchedAt.After(c.Entries[tags[j]].FetchedAt)
+    })
+    for i, tag := range tags {
+        if i >= keep && !pinned[tag] {
+            delete(c.Entries, tag)
+        }
+    }
+
+    referenced := map[string]bool{}
+    for _, entry := range c.Entries {
+        referenced[strings.ToLower(entry.SHA256)] = true
+    }
+    objects, err := os.ReadDir(filepath.Join(c.dir, "objects"))
+    if err != nil && !errors.Is(err, os.ErrNotExist) {
+        return 0, fmt.Errorf("error reading cache directory: %v", err)
+    }
+    removed := 0
+    for _, object := range objects {
+        if referenced[strings.TrimSuffix(object.Name(), ".js")] {
+            continue
+        }
+        if err := os.Remove(filepath.Join(c.dir, "objects", object.Name())); err != nil {
+            return removed, fmt.Errorf("error removing %s: %v", object.Name(), err)
+        }
+        removed++
+    }
+    return removed, c.save()
+}
+
+func runCache(installDir string, args []string) {
+    if len(args) == 0 {
+        failMessage("Missing cache command. Use: cache list | cache prune [-keep N]", nil)
+        return
+    }
+    cache, err := openWorkerCache(installDir)
+    if err != nil {
+        failMessage("Error opening worker cache", err)
+        return
+    }
+
+    switch args[0] {
+    case "list":
+        if len(cache.Entries) == 0 {
+            fmt.Printf("%s Worker cache is empty.\n", infoPrefix)
+            return
+        }
+        var keys []string
+        for key := range cache.Entries {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        fmt.Printf("\n  %-16s %-16s %-18s %s\n", "KEY", "TAG", "FETCHED", "SHA-256")
+        for _, key := range keys {
+            entry := cache.Entries[key]
+            fmt.Printf("  %s%-16s%s %-16s %-18s %s\n", cyan, key, reset, entry.Tag, entry.FetchedAt.Local().Format("2006-01-02 15:04"), entry.SHA256)
+        }
+    case "prune":
+        fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+        keep := fs.Int("keep", 3, "Number of most recently fetched releases to keep")
+        fs.Parse(args[1:])
+
+        pinned := map[string]bool{}
+        deployments, err := loadDeployments(installDir)
+        if err != nil {
+            fmt.Printf("%s Warning: Could not read deployment records, deployed releases will not be pinned: %v\n", warnPrefix, err)
+        }
+        for _, deployment := range deployments {
+            pinned[deployment.WorkerVersion] = true
+        }
+        removed, err := cache.prune(*keep, pinned)
+        if err != nil {
+            failMessage("Error pruning worker cache", err)
+            return
+        }
+        successMessage(fmt.Sprintf("Removed %d cached worker script(s).", removed))
+    default:
+        failMessage(fmt.Sprintf("Unknown cache command %q. Use: cache list | cache prune [-keep N]", args[0]), nil)
+    }
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync/atomic"
+    "testing"
+)
+
+func TestWorkerCacheRestore(t *testing.T) {
+    installDir := t.TempDir()
+    src := filepath.Join(t.TempDir(), "worker.js")
+    if err := os.WriteFile(src, []byte(testWorker), 0600); err != nil {
+        t.Fatal(err)
+    }
+    cache, err := openWorkerCache(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := cache.store("v3.0.0", CacheEntry{Tag: "v3.0.0", URL: "https://example.com/worker.js"}, src); err != nil {
+        t.Fatal(err)
+    }
+
+    cache, err = openWorkerCache(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    entry, ok := cache.lookup("v3.0.0")
+    if !ok || entry.SHA256 != sha256Hex(testWorker) {
+        t.Fatalf("lookup after reopening: %+v %v", entry, ok)
+    }
+    if _, ok := cache.lookup("v2.0.0"); ok {
+        t.Error("lookup found a release that was never cached")
+    }
+
+    tests := []struct {
+        name    string
+        tamper  func(object string)
+        wantErr string
+    }{
+        {"intact", func(string) {}, ""},
+        {"modified object", func(object string) { os.WriteFile(object, []byte("export default { evil: true };\n"), 0640) }, "corrupted"},
+        {"missing object", func(object string) { os.Remove(object) }, "error reading"},
+    }
+    for _, tt := range tests {
+        if err := cache.store("v3.0.0", *entry, src); err != nil {
+            t.Fatal(err)
+        }
+        object := cache.objectPath(entry.SHA256)
+        tt.tamper(object)
+        dest := filepath.Join(t.TempDir(), "worker.js")
+        err := cache.restore(entry, dest)
+        if tt.wantErr == "" {
+            data, _ := os.ReadFile(dest)
+            if err != nil || string(data) != testWorker {
+                t.Errorf("%s: restored %q, %v", tt.name, data, err)
+            }
+            continue
+        }
+        if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+            t.Errorf("%s: got %v, want an error about %q", tt.name, err, tt.wantErr)
+        }
+        if _, err := os.Stat(dest); err == nil {
+            t.Errorf("%s: a worker was restored from a bad cache entry", tt.name)
+        }
+        if _, ok := cache.lookup("v3.0.0"); ok {
+            t.Errorf("%s: lookup still offers the bad entry", tt.name)
+        }
+    }
+}
+
+func TestTamperedCacheIsDownloadedAgain(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    var downloads atomic.Int32
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        downloads.Add(1)
+        w.Write([]byte(testWorker))
+    }))
+    defer server.Close()
+    release := &WorkerRelease{Tag: "v3.0.0", URL: server.URL + "/worker.js", SHA256: sha256Hex(testWorker)}
+
+    cache, err := openWorkerCache(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    workerPath := filepath.Join(t.TempDir(), "worker.js")
+    if _, err := fetchReleaseWithCache(cache, release, workerPath, release.SHA256); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := fetchReleaseWithCache(cache, release, workerPath, release.SHA256); err != nil || downloads.Load() != 1 {
+        t.Fatalf("second fetch: %v after %d downloads, want the cached copy", err, downloads.Load())
+    }
+
+    entry, _ := cache.lookup("v3.0.0")
+    os.WriteFile(cache.objectPath(entry.SHA256), []byte("export default { evil: true };\n"), 0640)
+    script, err := fetchReleaseWithCache(cache, release, workerPath, release.SHA256)
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, _ := os.ReadFile(workerPath)
+    if downloads.Load() != 2 || string(data) != testWorker || script.SHA256 != release.SHA256 {
+        t.Errorf("tampered cache: %d downloads, deployed %q", downloads.Load(), data)
+    }
+}
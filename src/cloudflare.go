@@ -0,0 +1,374 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+var cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+type nameStatus int
+
+const (
+    nameUnknown nameStatus = iota
+    nameFree
+    nameExists
+)
+
+func (s nameStatus) String() string {
+    switch s {
+    case nameFree:
+        return "free"
+    case nameExists:
+        return "exists"
+    default:
+        return "unknown"
+    }
+}
+
+// Cloudflare error codes that mean a name is not in use. Other 404s, such
+// as an unknown account, say nothing about the name.
+const (
+    scriptNotFoundCode  = 10007
+    projectNotFoundCode = 8000007
+)
+
+type cloudflareError struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+}
+
+type cloudflareResponse struct {
+    Success    bool              `json:"success"`
+    Errors     []cloudflareError `json:"errors"`
+    Result     json.RawMessage   `json:"result"`
+    ResultInfo struct {
+        Page       int `json:"page"`
+        TotalPages int `json:"total_pages"`
+    } `json:"result_info"`
+}
+
+func (r *cloudflareResponse) hasError(code int) bool {
+    for _, e := range r.Errors {
+        if e.Code == code {
+            return true
+        }
+    }
+    return false
+}
+
+// cloudflareClient calls the Cloudflare API with CLOUDFLARE_API_TOKEN, a
+// token stored in the vault, or the credentials Wrangler stored at login.
+type cloudflareClient struct {
+    token     string
+    accountID string
+}
+
+// wranglerToken is the OAuth state Wrangler keeps in its user config.
+type wranglerToken struct {
+    OAuthToken     string
+    ExpirationTime time.Time
+}
+
+func wranglerConfigPaths() []string {
+    var paths []string
+    if dir := os.Getenv("WRANGLER_HOME"); dir != "" {
+        paths = append(paths, filepath.Join(dir, "config", "default.toml"))
+    }
+    if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+        paths = append(paths, filepath.Join(dir, ".wrangler", "config", "default.toml"))
+    }
+    if home, err := os.UserHomeDir(); err == nil {
+        paths = append(paths,
+            filepath.Join(home, ".config", ".wrangler", "config", "default.toml"),
+            filepath.Join(home, "Library", "Preferences", ".wrangler", "config", "default.toml"),
+            filepath.Join(home, ".wrangler", "config", "default.toml"),
+        )
+    }
+    return paths
+}
+
+func readWranglerToken() (*wranglerToken, error) {
+    for _, path := range wranglerConfigPaths() {
+        file, err := os.Open(path)
+        if err != nil {
+            continue
+        }
+        token := &wranglerToken{}
+        scanner := bufio.NewScanner(file)
+        for scanner.Scan() {
+            key, value, found := strings.Cut(scanner.Text(), "=")
+            if !found {
+                continue
+            }
+            value = strings.Trim(strings.TrimSpace(value), `"`)
+            switch strings.TrimSpace(key) {
+            case "oauth_token":
+                token.OAuthToken = value
+            case "expiration_time":
+                token.ExpirationTime, _ = time.Parse(time.RFC3339, value)
+            }
+        }
+        file.Close()
+        if token.OAuthToken != "" {
+            return token, nil
+        }
+    }
+    return nil, fmt.Errorf("no Wrangler OAuth token found, log in with wrangler first")
+}
+
+func (t *wranglerToken) expired() bool {
+    return !t.ExpirationTime.IsZero() && time.Now().Add(time.Minute).After(t.ExpirationTime)
+}
+
+// cachedAccountID reads the account Wrangler remembers for the install
+// directory after its first command.
+func cachedAccountID(installDir string) string {
+    data, err := os.ReadFile(filepath.Join(installDir, "node_modules", ".cache", "wrangler", "wrangler-account.json"))
+    if err != nil {
+        return ""
+    }
+    var cache struct {
+        Account struct {
+            ID string `json:"id"`
+        } `json:"account"`
+    }
+    if err := json.Unmarshal(data, &cache); err != nil {
+        return ""
+    }
+    return cache.Account.ID
+}
+
+// newCloudflareClient builds a client from the Wrangler login. refresh is
+// called once when the stored OAuth token has expired.
+func newCloudflareClient(installDir string, refresh func() error) (*cloudflareClient, error) {
+    client := &cloudflareClient{token: os.Getenv("CLOUDFLARE_API_TOKEN"), accountID: os.Getenv("CLOUDFLARE_ACCOUNT_ID")}
+    if client.token == "" {
+        client.token = vaultToken(installDir, "cloudflare")
+    }
+    if client.token == "" {
+        token, err := readWranglerToken()
+        if err == nil && token.expired() && refresh != nil {
+            if err := refresh(); err != nil {
+                return nil, fmt.Errorf("error refreshing Wrangler login: %v", err)
+            }
+            token, err = readWranglerToken()
+        }
+        if err != nil {
+            return nil, err
+        }
+        if token.expired() {
+            return nil, fmt.Errorf("Wrangler OAuth token has expired, log in again")
+        }
+        client.token = token.OAuthToken
+    }
+    registerSecret(client.token)
+    if client.accountID == "" {
+        client.accountID = cachedAccountID(installDir)
+    }
+    if client.accountID == "" {
+        accountID, err := client.lookupAccountID()
+        if err != nil {
+            return nil, err
+        }
+        client.accountID = accountID
+    }
+    return client, nil
+}
+
+func (c *cloudflareClient) get(path string) (int, *cloudflareResponse, error) {
+    return c.request(http.MethodGet, path)
+}
+
+// send makes one API request and returns the status, headers and body.
+func (c *cloudflareClient) send(method, path string) (int, http.Header, []byte, error) {
+    req, err := http.NewRequest(method, cloudflareAPI+path, nil)
+    if err != nil {
+        return 0, nil, nil, fmt.Errorf("error creating request: %v", err)
+    }
+    req.Header.Set("Authorization", "Bearer "+c.token)
+    req.Header.Set("User-Agent", "BPB-Terminal-Wizard")
+    start := time.Now()
+    resp, err := newHTTPClient(apiTimeout).Do(req)
+    if err != nil {
+        logRequest(method, path, 0, start, err)
+        return 0, nil, nil, fmt.Errorf("error querying Cloudflare API: %v", err)
+    }
+    defer resp.Body.Close()
+    logRequest(method, path, resp.StatusCode, start, nil)
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+    if err != nil {
+        return resp.StatusCode, resp.Header, nil, fmt.Errorf("error reading Cloudflare API response: %v", err)
+    }
+    return resp.StatusCode, resp.Header, body, nil
+}
+
+func (c *cloudflareClient) request(method, path string) (int, *cloudflareResponse, error) {
+    status, header, body, err := c.send(method, path)
+    if err != nil {
+        return status, nil, err
+    }
+    var envelope cloudflareResponse
+    if err := json.Unmarshal(body, &envelope); err != nil && status == http.StatusOK {
+        return status, nil, fmt.Errorf("error decoding Cloudflare API response: %v", err)
+    }
+    if status != http.StatusOK && status != http.StatusNotFound {
+        message := fmt.Sprintf("Cloudflare API returned HTTP %d", status)
+        if len(envelope.Errors) > 0 {
+            message += ": " + envelope.Errors[0].Message
+        }
+        return status, &envelope, &httpStatusError{
+            status:     status,
+            retryAfter: parseRetryAfter(header.Get("Retry-After")),
+            message:    message,
+        }
+    }
+    return status, &envelope, nil
+}
+
+func (c *cloudflareClient) lookupAccountID() (string, error) {
+    var accounts []struct {
+        ID   string `json:"id"`
+        Name string `json:"name"`
+    }
+    err := defaultRetryPolicy.do("Listing Cloudflare accounts", func() error {
+        status, envelope, err := c.get("/accounts")
+        if err != nil {
+            return err
+        }
+        if status != http.StatusOK {
+            return permanent(fmt.Errorf("Cloudflare API returned HTTP %d for /accounts", status))
+        }
+        return json.Unmarshal(envelope.Result, &accounts)
+    })
+    if err != nil {
+        return "", err
+    }
+    switch len(accounts) {
+    case 0:
+        return "", fmt.Errorf("no Cloudflare account is available to this login")
+    case 1:
+        return accounts[0].ID, nil
+    default:
+        return "", fmt.Errorf("this login has access to %d accounts, set CLOUDFLARE_ACCOUNT_ID to choose one", len(accounts))
+    }
+}
+
+// nameStatus looks the name up directly: HTTP 200 means it exists and a
+// 404 with the not-found code of the script or project means it is free.
+// Anything else leaves the answer unknown.
+func (c *cloudflareClient) nameStatus(name, deployType string) (nameStatus, error) {
+    path := fmt.Sprintf("/accounts/%s/workers/scripts/%s/settings", c.accountID, url.PathEscape(name))
+    notFoundCode := scriptNotFoundCode
+    if deployType == "2" {
+        path = fmt.Sprintf("/accounts/%s/pages/projects/%s", c.accountID, url.PathEscape(name))
+        notFoundCode = projectNotFoundCode
+    }
+    var status int
+    var envelope *cloudflareResponse
+    err := defaultRetryPolicy.do("Checking name availability", func() error {
+        var err error
+        status, envelope, err = c.get(path)
+        return err
+    })
+    switch {
+    case err != nil:
+        return nameUnknown, err
+    case status == http.StatusOK:
+        return nameExists, nil
+    case status == http.StatusNotFound && envelope.hasError(notFoundCode):
+        return nameFree, nil
+    case status == http.StatusNotFound && len(envelope.Errors) > 0:
+        return nameUnknown, fmt.Errorf("unexpected HTTP 404 from Cloudflare API: %s (code %d)", envelope.Errors[0].Message, envelope.Errors[0].Code)
+    default:
+        return nameUnknown, fmt.Errorf("unexpected HTTP %d from Cloudflare API", status)
+    }
+}
+
+// fetch decodes the result of a single-object endpoint into result.
+func (c *cloudflareClient) fetch(path, action string, result any) error {
+    return defaultRetryPolicy.do(action, func() error {
+        status, envelope, err := c.get(path)
+        if err != nil {
+            return err
+        }
+        if status != http.StatusOK {
+            return permanent(fmt.Errorf("Cloudflare API returned HTTP %d for %s", status, path))
+        }
+        if err := json.Unmarshal(envelope.Result, result); err != nil {
+            return permanent(fmt.Errorf("error decoding Cloudflare API response: %v", err))
+        }
+        return nil
+    })
+}
+
+// list fetches every page of a list endpoint and passes the results of
+// each page to add.
+func (c *cloudflareClient) list(path, action string, add func(json.RawMessage) error) error {
+    separator := "?"
+    if strings.Contains(path, "?") {
+        separator = "&"
+    }
+    for page := 1; ; page++ {
+        var envelope *cloudflareResponse
+        err := defaultRetryPolicy.do(action, func() error {
+            status, response, err := c.get(fmt.Sprintf("%s%spage=%d", path, separator, page))
+            if err != nil {
+                return err
+            }
+            if status != http.StatusOK {
+                return permanent(fmt.Errorf("Cloudflare API returned HTTP %d for %s", status, path))
+            }
+            envelope = response
+            return nil
+        })
+        if err != nil {
+            return err
+        }
+        if err := add(envelope.Result); err != nil {
+            return fmt.Errorf("error decoding Cloudflare API response: %v", err)
+        }
+        if page >= envelope.ResultInfo.TotalPages {
+            return nil
+        }
+    }
+}
+
+// remove deletes a resource. A resource that is already gone counts as
+// removed.
+func (c *cloudflareClient) remove(path, action string) error {
+    return defaultRetryPolicy.do(action, func() error {
+        _, _, err := c.request(http.MethodDelete, path)
+        return err
+    })
+}
+
+// fetchRaw returns the body of an endpoint that does not answer with the
+// JSON envelope, such as script content.
+func (c *cloudflareClient) fetchRaw(path, action string) ([]byte, error) {
+    var body []byte
+    err := defaultRetryPolicy.do(action, func() error {
+        status, header, data, err := c.send(http.MethodGet, path)
+        if err != nil {
+            return err
+        }
+        if status != http.StatusOK {
+            return &httpStatusError{
+                status:     status,
+                retryAfter: parseRetryAfter(header.Get("Retry-After")),
+                message:    fmt.Sprintf("Cloudflare API returned HTTP %d for %s", status, path),
+            }
+        }
+        body = data
+        return nil
+    })
+    return body, err
+}
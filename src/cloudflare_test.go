@@ -0,0 +1,147 @@
+package main
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestNameStatus(t *testing.T) {
+    setupDeploy(t, "1")
+    api := newFakeCloudflare(t)
+    client, err := newCloudflareClient(t.TempDir(), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if status, err := client.nameStatus("free-name", "1"); status != nameFree || err != nil {
+        t.Errorf("free name: got %s, %v", status, err)
+    }
+    api.taken = 1
+    if status, err := client.nameStatus("used-name", "2"); status != nameExists || err != nil {
+        t.Errorf("existing project: got %s, %v", status, err)
+    }
+
+    api.status = http.StatusForbidden
+    if status, err := client.nameStatus("any-name", "1"); status != nameUnknown || err == nil {
+        t.Errorf("forbidden: got %s, %v", status, err)
+    }
+    if got := api.count("/workers/scripts/any-name"); got != 1 {
+        t.Errorf("forbidden lookup was retried %d times", got-1)
+    }
+
+    api.status = http.StatusServiceUnavailable
+    if status, err := client.nameStatus("any-name", "1"); status != nameUnknown || err == nil {
+        t.Errorf("unavailable: got %s, %v", status, err)
+    }
+    if got := api.count("/workers/scripts/any-name"); got != 1+defaultRetryPolicy.maxAttempts {
+        t.Errorf("unavailable lookup ran %d times, want %d", got-1, defaultRetryPolicy.maxAttempts)
+    }
+}
+
+func TestNameStatusNotFoundCodes(t *testing.T) {
+    setupDeploy(t, "1")
+    var body string
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNotFound)
+        io.WriteString(w, body)
+    }))
+    defer server.Close()
+    savedAPI := cloudflareAPI
+    cloudflareAPI = server.URL
+    defer func() { cloudflareAPI = savedAPI }()
+
+    tests := []struct {
+        name       string
+        deployType string
+        body       string
+        want       nameStatus
+    }{
+        {"missing script", "1", `{"success":false,"errors":[{"code":10007,"message":"not found"}]}`, nameFree},
+        {"missing project", "2", `{"success":false,"errors":[{"code":8000007,"message":"Project not found."}]}`, nameFree},
+        {"project code for a script", "1", `{"success":false,"errors":[{"code":8000007,"message":"Project not found."}]}`, nameUnknown},
+        {"script code for a project", "2", `{"success":false,"errors":[{"code":10007,"message":"not found"}]}`, nameUnknown},
+        {"unknown account", "1", `{"success":false,"errors":[{"code":7003,"message":"Could not route to /accounts/x"}]}`, nameUnknown},
+        {"not JSON", "2", `404 page not found`, nameUnknown},
+    }
+    client := &cloudflareClient{token: "test-token", accountID: "acc"}
+    for _, tt := range tests {
+        body = tt.body
+        status, err := client.nameStatus("panel", tt.deployType)
+        if status != tt.want || (tt.want == nameUnknown) != (err != nil) {
+            t.Errorf("%s: got %s, %v, want %s", tt.name, status, err, tt.want)
+        }
+    }
+}
+
+func TestDeployRefusesUnknownName(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    backend := newMemoryBackend()
+    backend.unknownChecks = nameBatchSize
+
+    _, err := deployPanel(installDir, backend)
+    if err == nil || !strings.Contains(err.Error(), "could not verify") {
+        t.Fatalf("expected the deploy to stop on an unknown name, got %v", err)
+    }
+    if len(backend.namespaces) != 0 || len(backend.deployed) != 0 {
+        t.Error("deploy continued after an unknown name check")
+    }
+}
+
+func TestCloudflareClientFromWranglerLogin(t *testing.T) {
+    setupDeploy(t, "1")
+    api := newFakeCloudflare(t)
+    t.Setenv("CLOUDFLARE_API_TOKEN", "")
+    t.Setenv("CLOUDFLARE_ACCOUNT_ID", "")
+    t.Setenv("WRANGLER_HOME", "")
+    configHome := t.TempDir()
+    t.Setenv("XDG_CONFIG_HOME", configHome)
+
+    configPath := filepath.Join(configHome, ".wrangler", "config", "default.toml")
+    if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+        t.Fatal(err)
+    }
+    writeToken := func(expiry time.Time) {
+        config := "oauth_token = \"test-token\"\nexpiration_time = \"" + expiry.UTC().Format(time.RFC3339) + "\"\nrefresh_token = \"refresh\"\n"
+        if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    writeToken(time.Now().Add(-time.Hour))
+    refreshed := false
+    client, err := newCloudflareClient(t.TempDir(), func() error {
+        refreshed = true
+        writeToken(time.Now().Add(time.Hour))
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !refreshed {
+        t.Error("expired token was not refreshed")
+    }
+    if client.token != "test-token" || client.accountID != "test-account" {
+        t.Errorf("unexpected client %+v", client)
+    }
+    if api.count("/accounts") == 0 {
+        t.Error("account ID was not looked up")
+    }
+
+    installDir := t.TempDir()
+    cachePath := filepath.Join(installDir, "node_modules", ".cache", "wrangler", "wrangler-account.json")
+    os.MkdirAll(filepath.Dir(cachePath), 0750)
+    os.WriteFile(cachePath, []byte(`{"account":{"id":"cached-account","name":"Test"}}`), 0600)
+    client, err = newCloudflareClient(installDir, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if client.accountID != "cached-account" {
+        t.Errorf("account ID = %q, want the one cached by Wrangler", client.accountID)
+    }
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+
+    "github.com/google/uuid"
+    "gopkg.in/yaml.v3"
+)
+
+const generateValue = "generate"
+
+var (
+    configPath  string
+    profileName string
+
+    configFileNames = []string{"panel.yaml", "panel.yml", "panel.json"}
+
+    profileNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+    hostnameRe    = regexp.MustCompile(`^(\*\.)?[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*(/\S*)?$`)
+    proxyIPRe     = regexp.MustCompile(`^[A-Za-z0-9.:\[\]-]+$`)
+    subPathRe     = regexp.MustCompile(`^[A-Za-z0-9!@$&*_+;:,.-]+$`)
+    kvIDRe        = regexp.MustCompile(`^[0-9a-f]{32}$`)
+    varNameRe     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+    tagRe         = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// panelOptions are the panel settings a profile can change. Empty
+// credentials are generated at deploy time.
+type panelOptions struct {
+    UUID          string
+    TrPass        string
+    TrPassLength  int
+    SubPath       string
+    SubPathLength int
+    ProxyIPs      []string
+    Fallback      string
+    KVID          string
+    Vars          map[string]string
+    Tags          []string
+}
+
+var panelSettings = defaultPanelOptions()
+
+func defaultPanelOptions() panelOptions {
+    return panelOptions{
+        TrPassLength:  12,
+        SubPathLength: 16,
+        ProxyIPs:      []string{"bpb.yousef.isegaro.com"},
+        Fallback:      "speed.cloudflare.com",
+    }
+}
+
+// panelProfile is one deployment described in a config file. Empty
+// fields were not set and leave the wizard's defaults alone.
+type panelProfile struct {
+    Name          string
+    DeployType    string
+    FixedName     string
+    NameStyle     string
+    NamePrefix    string
+    NameTemplate  string
+    UUID          string
+    TrPass        string
+    TrPassLength  int
+    SubPath       string
+    SubPathLength int
+    SecretsMode   *bool
+    ProxyIPs      []string
+    Fallback      string
+    KVID          string
+    CustomDomain  string
+    WorkerVersion string
+    WorkerSHA256  string
+    WorkerFile    string
+    WorkerURLs    []string
+    Vars          map[string]string
+    Tags          []string
+
+    nodes map[string]*yaml.Node
+}
+
+func (p panelProfile) clone() panelProfile {
+    c := p
+    c.ProxyIPs = append([]string(nil), p.ProxyIPs...)
+    c.WorkerURLs = append([]string(nil), p.WorkerURLs...)
+    c.Tags = append([]string(nil), p.Tags...)
+    c.Vars = make(map[string]string, len(p.Vars))
+    for k, v := range p.Vars {
+        c.Vars[k] = v
+    }
+    c.nodes = make(map[string]*yaml.Node, len(p.nodes))
+    for k, v := range p.nodes {
+        c.nodes[k] = v
+    }
+    return c
+}
+
+// configParser walks the YAML tree by hand so every problem is reported
+// with the line it is on, and all problems are reported at once.
+type configParser struct {
+    path   string
+    dir    string
+    errors []string
+}
+
+func (p *configParser) errorf(node *yaml.Node, format string, args ...any) {
+    p.errors = append(p.errors, fmt.Sprintf("%s:%d: %s", p.path, node.Line, fmt.Sprintf(format, args...)))
+}
+
+func (p *configParser) mapping(node *yaml.Node, what string, fields map[string]func(*yaml.Node)) {
+    if node.Kind != yaml.MappingNode {
+        p.errorf(node, "%s must be a mapping", what)
+        return
+    }
+    seen := map[string]bool{}
+    for i := 0; i+1 < len(node.Content); i += 2 {
+        key, value := node.Content[i], node.Content[i+1]
+        if seen[key.Value] {
+            p.errorf(key, "%s is set twice in %s", key.Value, what)
+            continue
+        }
+        seen[key.Value] = true
+        set, ok := fields[key.Value]
+        if !ok {
+            var names []string
+            for name := range fields {
+                names = append(names, name)
+            }
+            sort.Strings(names)
+            p.errorf(key, "unknown field %q in %s (expected one of: %s)", key.Value, what, strings.Join(names, ", "))
+            continue
+        }
+        set(value)
+    }
+}
+
+func (p *configParser) scalar(node *yaml.Node, field string) (string, bool) {
+    if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+        p.errorf(node, "%s must be a single value", field)
+        return "", false
+    }
+    return strings.TrimSpace(node.Value), true
+}
+
+func (p *configParser) text(node *yaml.Node, field string, valid func(string) error) (string, bool) {
+    value, ok := p.scalar(node, field)
+    if !ok {
+        return "", false
+    }
+    if value == "" {
+        p.errorf(node, "%s must not be empty", field)
+        return "", false
+    }
+    if valid != nil {
+        if err := valid(value); err != nil {
+            p.errorf(node, "%s: %v", field, err)
+            return "", false
+        }
+    }
+    return value, true
+}
+
+func (p *configParser) number(node *yaml.Node, field string, low, high int) (int, bool) {
+    var n int
+    if node.Kind != yaml.ScalarNode || node.Decode(&n) != nil {
+        p.errorf(node, "%s must be a whole number", field)
+        return 0, false
+    }
+    if n < low || n > high {
+        p.errorf(node, "%s must be between %d and %d", field, low, high)
+        return 0, false
+    }
+    return n, true
+}
+
+// list accepts a sequence or a single value.
+func (p *configParser) list(node *yaml.Node, field string, valid func(string) error) ([]string, bool) {
+    items := []*yaml.Node{node}
+    if node.Kind == yaml.SequenceNode {
+        items = node.Content
+    }
+    if len(items) == 0 {
+        p.errorf(node, "%s must not be empty", field)
+        return nil, false
+    }
+    var values []string
+    ok := true
+    for _, item := range items {
+        value, valid := p.text(item, field, valid)
+        ok = ok && valid
+        values = append(values, value)
+    }
+    return values, ok
+}
+
+func pattern(re *regexp.Regexp, description string) func(string) error {
+    return func(value string) error {
+        if !re.MatchString(value) {
+            return fmt.Errorf("%q is not %s", value, description)
+        }
+        return nil
+    }
+}
+
+func generatedOr(valid func(string) error) func(string) error {
+    return func(value string) error {
+        if value == generateValue {
+            return nil
+        }
+        return valid(value)
+    }
+}
+
+func (p *configParser) profile(node *yaml.Node, profile *panelProfile, what string, profiles *yaml.Node) {
+    own := map[string]bool{}
+    set := func(field string, node *yaml.Node) {
+        profile.nodes[field] = node
+        own[field] = true
+    }
+    fields := map[string]func(*yaml.Node){
+        "deploy_type": func(node *yaml.Node) {
+            value, ok := p.text(node, "deploy_type", nil)
+            switch {
+            case !ok:
+            case value == "workers" || value == "1":
+                profile.DeployType = "1"
+            case value == "pages" || value == "2":
+                profile.DeployType = "2"
+            default:
+                p.errorf(node, "deploy_type must be workers or pages, not %q", value)
+            }
+            set("deploy_type", node)
+        },
+        "name": func(node *yaml.Node) {
+            if value, ok := p.text(node, "name", func(name string) error { return validateWorkerName(name, "1") }); ok {
+                profile.FixedName = value
+            }
+            set("name", node)
+        },
+        "naming": func(node *yaml.Node) {
+            set("naming", node)
+            p.mapping(node, "naming", map[string]func(*yaml.Node){
+                "style": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "naming.style", nil); ok {
+                        if _, known := nameStyles[value]; !known {
+                            p.errorf(node, "naming.style must be random or words, not %q", value)
+                        }
+                        profile.NameStyle = value
+                    }
+                },
+                "prefix": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "naming.prefix", pattern(nameCharsRe, "lowercase letters, digits and hyphens")); ok {
+                        profile.NamePrefix = value
+                    }
+                },
+                "template": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "naming.template", func(template string) error {
+                        _, err := expandNameTemplate(template, "prefix")
+                        return err
+                    }); ok {
+                        profile.NameTemplate = value
+                    }
+                },
+            })
+        },
+        "credentials": func(node *yaml.Node) {
+            p.mapping(node, "credentials", map[string]func(*yaml.Node){
+                "uuid": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "credentials.uuid", generatedOr(func(value string) error {
+                        _, err := uuid.Parse(value)
+                        return err
+                    })); ok {
+                        profile.UUID = value
+                    }
+                },
+                "trojan_password": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "credentials.trojan_password", generatedOr(func(value string) error {
+                        if len(value) < 8 || strings.ContainsAny(value, " \t\"") {
+                            return fmt.Errorf("use at least 8 characters without spaces or quotes")
+                        }
+                        return nil
+                    })); ok {
+                        profile.TrPass = value
+                    }
+                },
+                "trojan_password_length": func(node *yaml.Node) {
+                    if n, ok := p.number(node, "credentials.trojan_password_length", 8, 64); ok {
+                        profile.TrPassLength = n
+                    }
+                },
+                "sub_path": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "credentials.sub_path", generatedOr(pattern(subPathRe, "a valid subscription path"))); ok {
+                        profile.SubPath = value
+                    }
+                },
+                "sub_path_length": func(node *yaml.Node) {
+                    if n, ok := p.number(node, "credentials.sub_path_length", 8, 64); ok {
+                        profile.SubPathLength = n
+                    }
+                },
+                "secrets_mode": func(node *yaml.Node) {
+                    var value bool
+                    if node.Kind != yaml.ScalarNode || node.Decode(&value) != nil {
+                        p.errorf(node, "credentials.secrets_mode must be true or false")
+                        return
+                    }
+                    profile.SecretsMode = &value
+                },
+            })
+        },
+        "proxy_ips": func(node *yaml.Node) {
+            if values, ok := p.list(node, "proxy_ips", pattern(proxyIPRe, "a host name or IP address")); ok {
+                profile.ProxyIPs = values
+            }
+        },
+        "fallback": func(node *yaml.Node) {
+            if value, ok := p.text(node, "fallback", pattern(hostnameRe, "a host name")); ok {
+                profile.Fallback = value
+            }
+        },
+        "kv_namespace_id": func(node *yaml.Node) {
+            if value, ok := p.text(node, "kv_namespace_id", pattern(kvIDRe, "a 32-character KV namespace ID")); ok {
+                profile.KVID = value
+            }
+        },
+        "custom_domain": func(node *yaml.Node) {
+            if value, ok := p.text(node, "custom_domain", pattern(hostnameRe, "a domain name")); ok {
+                profile.CustomDomain = value
+            }
+        },
+        "worker": func(node *yaml.Node) {
+            set("worker", node)
+            p.mapping(node, "worker", map[string]func(*yaml.Node){
+                "version": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "worker.version", func(tag string) error {
+                        if tag != workerLatestTag && !isValidReleaseTag(tag) {
+                            return fmt.Errorf("%q is not a release tag such as v3.0.0 or latest", tag)
+                        }
+                        return nil
+                    }); ok {
+                        profile.WorkerVersion = value
+                    }
+                },
+                "sha256": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "worker.sha256", func(digest string) error {
+                        if !isValidSHA256(digest) {
+                            return fmt.Errorf("must be a 64-character hex SHA-256 digest")
+                        }
+                        return nil
+                    }); ok {
+                        profile.WorkerSHA256 = value
+                    }
+                },
+                "file": func(node *yaml.Node) {
+                    if value, ok := p.text(node, "worker.file", nil); ok {
+                        if !filepath.IsAbs(value) {
+                            value = filepath.Join(p.dir, value)
+                        }
+                        profile.WorkerFile = value
+                        set("worker.file", node)
+                    }
+                },
+                "urls": func(node *yaml.Node) {
+                    if values, ok := p.list(node, "worker.urls", func(value string) error {
+                        if !isValidWorkerURL(value) {
+                            return fmt.Errorf("%q is not a full http(s) URL", value)
+                        }
+                        return nil
+                    }); ok {
+                        profile.WorkerURLs = values
+                    }
+                },
+            })
+        },
+        "tags": func(node *yaml.Node) {
+            if values, ok := p.list(node, "tags", pattern(tagRe, "a tag of lowercase letters, digits, hyphens and underscores")); ok {
+                profile.Tags = values
+            }
+        },
+        "vars": func(node *yaml.Node) {
+            if profile.Vars == nil {
+                profile.Vars = map[string]string{}
+            }
+            if node.Kind != yaml.MappingNode {
+                p.errorf(node, "vars must be a mapping of names to values")
+                return
+            }
+            for i := 0; i+1 < len(node.Content); i += 2 {
+                key, value := node.Content[i], node.Content[i+1]
+                switch {
+                case !varNameRe.MatchString(key.Value):
+                    p.errorf(key, "vars: %q is not a valid variable name", key.Value)
+                case key.Value == "UUID" || key.Value == "TR_PASS" || key.Value == "SUB_PATH":
+                    p.errorf(key, "vars: set %s under credentials instead", key.Value)
+                case key.Value == "PROXY_IP":
+                    p.errorf(key, "vars: set PROXY_IP with proxy_ips instead")
+                case key.Value == "FALLBACK":
+                    p.errorf(key, "vars: set FALLBACK with fallback instead")
+                default:
+                    if text, ok := p.scalar(value, "vars."+key.Value); ok {
+                        profile.Vars[key.Value] = text
+                    }
+                }
+            }
+        },
+    }
+    if profiles != nil {
+        fields["profiles"] = func(node *yaml.Node) {
+            *profiles = *node
+        }
+    }
+    p.mapping(node, what, fields)
+
+    // A profile that sets name or naming replaces the other one it
+    // inherited from the top level; setting both is still an error.
+    if own["name"] && !own["naming"] {
+        profile.NameStyle, profile.NamePrefix, profile.NameTemplate = "", "", ""
+        delete(profile.nodes, "naming")
+    }
+    if own["naming"] && !own["name"] {
+        profile.FixedName = ""
+        delete(profile.nodes, "name")
+    }
+}
+
+// check reports combinations that are valid field by field but not
+// together.
+func (p *configParser) check(profile panelProfile) {
+    if profile.FixedName != "" && profile.nodes["naming"] != nil {
+        p.errorf(profile.nodes["name"], "name and naming cannot be used together")
+    }
+    if profile.FixedName != "" && profile.DeployType == "2" {
+        if err := validateWorkerName(profile.FixedName, "2"); err != nil {
+            p.errorf(profile.nodes["name"], "name: %v", err)
+        }
+    }
+    if profile.WorkerFile != "" && len(profile.WorkerURLs) > 0 {
+        p.errorf(profile.nodes["worker.file"], "worker.file and worker.urls cannot be used together")
+    }
+}
+
+// loadConfig parses a config file and returns the named profile, or the
+// top-level settings when name is empty.
+func loadConfig(path, name string) (*panelProfile, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("error reading config file: %v", err)
+    }
+    var doc yaml.Node
+    if err := yaml.Unmarshal(data, &doc); err != nil {
+        return nil, fmt.Errorf("%s: %s", path, strings.TrimPrefix(err.Error(), "yaml: "))
+    }
+    if len(doc.Content) == 0 {
+        return nil, fmt.Errorf("%s: config file is empty", path)
+    }
+
+    parser := &configParser{path: path, dir: filepath.Dir(path)}
+    base := panelProfile{nodes: map[string]*yaml.Node{}}
+    var profilesNode yaml.Node
+    parser.profile(doc.Content[0], &base, "the config file", &profilesNode)
+
+    profiles := map[string]panelProfile{}
+    if profilesNode.Kind != 0 {
+        if profilesNode.Kind != yaml.MappingNode {
+            parser.errorf(&profilesNode, "profiles must be a mapping of profile names to settings")
+        }
+        for i := 0; profilesNode.Kind == yaml.MappingNode && i+1 < len(profilesNode.Content); i += 2 {
+            key, value := profilesNode.Content[i], profilesNode.Content[i+1]
+            if !profileNameRe.MatchString(key.Value) {
+                parser.errorf(key, "profile name %q may only contain lowercase letters, digits, hyphens and underscores", key.Value)
+                continue
+            }
+            if _, exists := profiles[key.Value]; exists {
+                parser.errorf(key, "profile %s is defined twice", key.Value)
+                continue
+            }
+            profile := base.clone()
+            profile.Name = key.Value
+            parser.profile(value, &profile, "profile "+key.Value, nil)
+            profiles[key.Value] = profile
+        }
+    }
+
+    selected := base
+    if name != "" {
+        profile, ok := profiles[name]
+        if !ok && len(parser.errors) == 0 {
+            var names []string
+            for known := range profiles {
+                names = append(names, known)
+            }
+            sort.Strings(names)
+            if len(names) == 0 {
+                return nil, fmt.Errorf("%s defines no profiles", path)
+            }
+            return nil, fmt.Errorf("%s has no profile %q (available: %s)", path, name, strings.Join(names, ", "))
+        }
+        selected = profile
+    }
+    parser.check(selected)
+    if len(parser.errors) > 0 {
+        return nil, errors.New(strings.Join(parser.errors, "\n"))
+    }
+    return &selected, nil
+}
+
+// findConfigFile looks for a config file in the working directory and
+// then in the install directory.
+func findConfigFile(installDir string) (string, error) {
+    for _, dir := range []string{".", installDir} {
+        for _, name := range configFileNames {
+            path := filepath.Join(dir, name)
+            if _, err := os.Stat(path); err == nil {
+                return path, nil
+            }
+        }
+    }
+    return "", fmt.Errorf("no config file found, pass one with -config (looked for %s in the current and install directories)", strings.Join(configFileNames, ", "))
+}
+
+// applyProfile copies the profile into the wizard's settings. Flags given
+// on the command line win over the file.
+func applyProfile(profile *panelProfile, explicit map[string]bool, deployFlag *string) {
+    setString := func(flagName string, target *string, value string) {
+        if value != "" && !explicit[flagName] {
+            *target = value
+        }
+    }
+    setString("deploy", deployFlag, profile.DeployType)
+    if !explicit["name-style"] && !explicit["name-prefix"] && !explicit["name-template"] {
+        setString("name-style", &nameStyle, profile.NameStyle)
+        setString("name-prefix", &namePrefix, profile.NamePrefix)
+        setString("name-template", &nameTemplate, profile.NameTemplate)
+        setString("name-template", &nameTemplate, profile.FixedName)
+    }
+    if profile.SecretsMode != nil && !explicit["secrets-mode"] {
+        secretsMode = *profile.SecretsMode
+    }
+    setString("worker-version", &workerVersion, profile.WorkerVersion)
+    setString("worker-sha256", &workerSHA256, profile.WorkerSHA256)
+    if !explicit["worker-file"] && !explicit["worker-url"] {
+        setString("worker-file", &workerFile, profile.WorkerFile)
+        if len(profile.WorkerURLs) > 0 {
+            workerURLs = append(stringList(nil), profile.WorkerURLs...)
+        }
+    }
+    customDomain = profile.CustomDomain
+    profileName = profile.Name
+
+    panelSettings = defaultPanelOptions()
+    for _, field := range []struct {
+        target *string
+        value  string
+    }{
+        {&panelSettings.UUID, profile.UUID},
+        {&panelSettings.TrPass, profile.TrPass},
+        {&panelSettings.SubPath, profile.SubPath},
+    } {
+        if field.value != generateValue {
+            *field.target = field.value
+        }
+    }
+    if profile.TrPassLength > 0 {
+        panelSettings.TrPassLength = profile.TrPassLength
+    }
+    if profile.SubPathLength > 0 {
+        panelSettings.SubPathLength = profile.SubPathLength
+    }
+    if len(profile.ProxyIPs) > 0 {
+        panelSettings.ProxyIPs = profile.ProxyIPs
+    }
+    if profile.Fallback != "" {
+        panelSettings.Fallback = profile.Fallback
+    }
+    panelSettings.KVID = profile.KVID
+    panelSettings.Vars = profile.Vars
+    panelSettings.Tags = profile.Tags
+}
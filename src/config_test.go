@@ -0,0 +1,210 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+const testConfig = `# shared settings
+deploy_type: workers
+naming:
+  style: words
+  prefix: panel
+proxy_ips:
+  - 1.2.3.4
+  - proxy.example.com
+vars:
+  LOG_LEVEL: debug
+
+profiles:
+  iran-mobile:
+    name: iran-mobile-panel
+    credentials:
+      uuid: 6f1c1f0e-3b1a-4d55-9d1e-2a8f0b1c3d4e
+      trojan_password_length: 20
+      secrets_mode: true
+    fallback: www.example.org
+    kv_namespace_id: 0123456789abcdef0123456789abcdef
+    worker:
+      version: v3.0.0
+      file: worker.js
+    vars:
+      REGION: ir
+  pages:
+    deploy_type: pages
+    tags: [iran, backup]
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestLoadConfigProfiles(t *testing.T) {
+    path := writeConfig(t, "panel.yaml", testConfig)
+    base, err := loadConfig(path, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if base.DeployType != "1" || base.NameStyle != "words" || len(base.ProxyIPs) != 2 {
+        t.Errorf("top-level settings = %+v", base)
+    }
+
+    profile, err := loadConfig(path, "pages")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if profile.DeployType != "2" || profile.NamePrefix != "panel" || profile.Vars["LOG_LEVEL"] != "debug" || len(profile.Tags) != 2 {
+        t.Errorf("pages profile did not inherit the shared settings: %+v", profile)
+    }
+
+    profile, err = loadConfig(path, "iran-mobile")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if profile.FixedName != "iran-mobile-panel" || profile.NameStyle != "" || profile.NamePrefix != "" {
+        t.Errorf("name did not replace the inherited naming: %+v", profile)
+    }
+    if _, err := loadConfig(path, "missing"); err == nil || !strings.Contains(err.Error(), "available: iran-mobile, pages") {
+        t.Errorf("expected the available profiles to be listed, got %v", err)
+    }
+}
+
+func TestLoadConfigNameOverridesNaming(t *testing.T) {
+    tests := []struct {
+        name    string
+        config  string
+        want    string
+        wantErr string
+    }{
+        {"profile name over top-level naming", "naming:\n  prefix: panel\nprofiles:\n  p:\n    name: fixed-panel\n", "fixed-panel", ""},
+        {"profile naming over top-level name", "name: fixed-panel\nprofiles:\n  p:\n    naming:\n      prefix: edge\n", "edge", ""},
+        {"both in the profile", "profiles:\n  p:\n    name: fixed-panel\n    naming:\n      prefix: edge\n", "", "panel.yaml:3: name and naming cannot be used together"},
+        {"both at the top level", "name: fixed-panel\nnaming:\n  prefix: edge\nprofiles:\n  p:\n    fallback: www.example.org\n", "", "panel.yaml:1: name and naming cannot be used together"},
+    }
+    for _, tt := range tests {
+        profile, err := loadConfig(writeConfig(t, "panel.yaml", tt.config), "p")
+        if tt.wantErr != "" {
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Errorf("%s: got %v, want %q", tt.name, err, tt.wantErr)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        if got := profile.FixedName + profile.NamePrefix; got != tt.want {
+            t.Errorf("%s: name %q, prefix %q, want only %q", tt.name, profile.FixedName, profile.NamePrefix, tt.want)
+        }
+        if (profile.nodes["name"] == nil) == (profile.nodes["naming"] == nil) {
+            t.Errorf("%s: nodes still hold both or neither of name and naming", tt.name)
+        }
+    }
+}
+
+func TestLoadConfigErrorsHaveLines(t *testing.T) {
+    path := writeConfig(t, "panel.yaml", `deploy_type: lambda
+proxy_ip: 1.2.3.4
+credentials:
+  uuid: not-a-uuid
+  trojan_password_length: 4
+kv_namespace_id: 1234
+vars:
+  UUID: fixed
+worker:
+  urls: [ftp://example.com/worker.js]
+`)
+    _, err := loadConfig(path, "")
+    if err == nil {
+        t.Fatal("invalid config was accepted")
+    }
+    for _, want := range []string{
+        `panel.yaml:1: deploy_type must be workers or pages, not "lambda"`,
+        `panel.yaml:2: unknown field "proxy_ip" in the config file`,
+        `panel.yaml:4: credentials.uuid`,
+        `panel.yaml:5: credentials.trojan_password_length must be between 8 and 64`,
+        `panel.yaml:6: kv_namespace_id`,
+        `panel.yaml:8: vars: set UUID under credentials instead`,
+        `panel.yaml:10: worker.urls`,
+    } {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("missing error %q in:\n%v", want, err)
+        }
+    }
+
+    path = writeConfig(t, "broken.yaml", "deploy_type: workers\n  naming: [\n")
+    if _, err := loadConfig(path, ""); err == nil || !strings.Contains(err.Error(), "line 2") {
+        t.Errorf("syntax error without a line number: %v", err)
+    }
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+    path := writeConfig(t, "panel.json", `{"profiles": {"eu": {"deploy_type": "pages", "name": "eu-panel", "fallback": "example.com"}}}`)
+    profile, err := loadConfig(path, "eu")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if profile.FixedName != "eu-panel" || profile.DeployType != "2" || profile.Name != "eu" {
+        t.Errorf("JSON profile = %+v", profile)
+    }
+}
+
+func TestApplyProfileKeepsFlags(t *testing.T) {
+    setupDeploy(t, "1")
+    deployFlag := "1"
+    profile := &panelProfile{Name: "eu", DeployType: "2", NameStyle: "words", WorkerVersion: "v3.0.0", ProxyIPs: []string{"9.9.9.9"}}
+    applyProfile(profile, map[string]bool{"deploy": true, "worker-version": true}, &deployFlag)
+    if deployFlag != "1" || workerVersion != workerLatestTag {
+        t.Errorf("command-line flags were overridden: deploy %s, worker version %s", deployFlag, workerVersion)
+    }
+    if nameStyle != "words" || panelSettings.ProxyIPs[0] != "9.9.9.9" || profileName != "eu" {
+        t.Errorf("profile settings were not applied: style %s, proxies %v, profile %s", nameStyle, panelSettings.ProxyIPs, profileName)
+    }
+}
+
+func TestDeployWithProfile(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    path := writeConfig(t, "panel.yaml", strings.Replace(testConfig, "naming:\n  style: words\n  prefix: panel\n", "", 1))
+    if err := os.WriteFile(filepath.Join(filepath.Dir(path), "worker.js"), []byte("export default {};\n"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    profile, err := loadConfig(path, "iran-mobile")
+    if err != nil {
+        t.Fatal(err)
+    }
+    deployFlag := "1"
+    applyProfile(profile, map[string]bool{}, &deployFlag)
+    workerVersion = workerLatestTag
+
+    backend := newMemoryBackend()
+    deployment, err := deployPanel(installDir, backend)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if deployment.Name != "iran-mobile-panel" || deployment.Profile != "iran-mobile" {
+        t.Errorf("deployed %s with profile %q", deployment.Name, deployment.Profile)
+    }
+    if deployment.UUID != "6f1c1f0e-3b1a-4d55-9d1e-2a8f0b1c3d4e" || len(deployment.TrPass) != 20 {
+        t.Errorf("credential settings were not used: %+v", deployment)
+    }
+    if deployment.KVID != "0123456789abcdef0123456789abcdef" || len(backend.namespaces) != 0 {
+        t.Errorf("KV namespace was not reused: %s, created %v", deployment.KVID, backend.namespaces)
+    }
+    if deployment.ProxyIP != "1.2.3.4,proxy.example.com" || deployment.Fallback != "www.example.org" {
+        t.Errorf("proxy settings = %s, %s", deployment.ProxyIP, deployment.Fallback)
+    }
+    if backend.secrets[deployment.Name]["UUID"] != deployment.UUID {
+        t.Error("secrets_mode from the profile was not used")
+    }
+    vars := readWranglerConfig(t, installDir)["vars"].(map[string]any)
+    if vars["REGION"] != "ir" || vars["LOG_LEVEL"] != "debug" {
+        t.Errorf("extra vars missing from wrangler.json: %v", vars)
+    }
+}
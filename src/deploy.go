@@ -0,0 +1,288 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+var loginRetryPolicy = retryPolicy{
+    maxAttempts: 3,
+    baseDelay:   time.Second,
+    maxDelay:    5 * time.Second,
+    deadline:    10 * time.Minute,
+}
+
+func abort(message string, err error) error {
+    failMessage(message, err)
+    if currentRun != nil {
+        fmt.Printf("%s Details of this run are in %s (view with: logs show)\n", infoPrefix, currentRun.path)
+    }
+    if err != nil {
+        return fmt.Errorf("%s: %w", message, err)
+    }
+    return errors.New(message)
+}
+
+func loginCloudflare(backend Backend) error {
+    logStep("login")
+    fmt.Printf("\n%s Starting Cloudflare login process...\n", titlePrefix)
+    if err := loginRetryPolicy.do("Cloudflare login", backend.Login); err != nil {
+        return abort("Error logging into Cloudflare", err)
+    }
+    successMessage("Successfully logged into Cloudflare!")
+    return nil
+}
+
+// panelf prints a progress line. Batch deploys label each line with the
+// panel it belongs to because several panels report at once.
+func panelf(label, prefix, format string, args ...any) {
+    if label != "" {
+        format = "[" + label + "] " + format
+    } else if prefix == titlePrefix {
+        fmt.Println()
+    }
+    fmt.Printf("%s "+format+"\n", append([]any{prefix}, args...)...)
+}
+
+// stagePanel clears the old wrangler.json and src directory from dir, the
+// directory Wrangler runs in for this panel.
+func stagePanel(dir string) error {
+    wranglerConfigPath := filepath.Join(dir, "wrangler.json")
+    if _, err := os.Stat(wranglerConfigPath); !errors.Is(err, os.ErrNotExist) {
+        if err := os.Remove(wranglerConfigPath); err != nil {
+            return abort("Error deleting old worker config.", err)
+        }
+    }
+    if err := os.RemoveAll(filepath.Join(dir, "src")); err != nil {
+        return abort("Error deleting old worker.js file.", err)
+    }
+    return nil
+}
+
+// planPanel picks a name, sets up the credentials and prepares worker.js
+// in dir from the current settings. Nothing is created on Cloudflare yet.
+// taken, when set, rejects names already planned for other panels.
+func planPanel(installDir, dir string, backend Backend, taken func(string) bool) (*Deployment, error) {
+    fmt.Printf("\n%s Configuring Worker settings...\n", titlePrefix)
+
+    fmt.Printf("\n%s Using deployment type: %s%s%s\n", infoPrefix, bold+green, map[string]string{"1": "Workers", "2": "Pages"}[deployType], reset)
+    if deployType == "2" {
+        fmt.Printf("%s With %sPages%s, you cannot modify settings later from Cloudflare dashboard.\n", warnPrefix, bold+green, reset)
+        fmt.Printf("%s With %sPages%s, it may take up to 5 minutes to access the panel.\n", warnPrefix, bold+green, reset)
+    }
+
+    generateName, err := newNameGenerator(deployType)
+    if err != nil {
+        return nil, abort("Invalid naming options", err)
+    }
+    if taken != nil {
+        generate := generateName
+        generateName = func() (string, error) {
+            for i := 0; i < maxNameBatches*nameBatchSize; i++ {
+                name, err := generate()
+                if err != nil || !taken(name) {
+                    return name, err
+                }
+            }
+            return "", fmt.Errorf("every generated name is already used by another panel in this batch")
+        }
+    }
+    logStep("choose-name")
+    fmt.Printf("\n%s Checking worker name availability...\n", infoPrefix)
+    name, err := pickAvailableName(backend, deployType, generateName)
+    if err != nil {
+        return nil, abort("Could not find a free worker name, refusing to continue", err)
+    }
+    fmt.Printf("\n%s Using worker name (%sSubdomain%s): %s%s%s\n", infoPrefix, bold+green, reset, cyan, name, reset)
+    successMessage("Domain is available!")
+
+    deployment := &Deployment{
+        Name:              name,
+        DeployType:        deployType,
+        CustomDomain:      customDomain,
+        CompatibilityDate: time.Now().AddDate(0, 0, -1).Format("2006-01-02"),
+        SecretsMode:       secretsMode,
+        Profile:           profileName,
+        Vars:              panelSettings.Vars,
+        Tags:              mergeTags(panelSettings.Tags, deployTags, nil),
+    }
+    if accountID, err := backend.AccountID(); err == nil {
+        deployment.AccountID = accountID
+    } else {
+        fmt.Printf("%s Warning: Could not look up the Cloudflare account ID, fleet commands cannot select this panel by account: %v\n", warnPrefix, err)
+    }
+
+    logStep("credentials")
+    defaults := defaultPanelOptions()
+    source := func(configured bool) string {
+        if configured {
+            return "Configured"
+        }
+        return "Generated"
+    }
+
+    deployment.UUID = panelSettings.UUID
+    if deployment.UUID == "" {
+        deployment.UUID = uuid.NewString()
+    }
+    registerSecret(deployment.UUID)
+    fmt.Printf("\n%s %s %sUUID%s: %s%s%s\n", infoPrefix, source(panelSettings.UUID != ""), bold+green, reset, cyan, redact(deployment.UUID), reset)
+    successMessage(fmt.Sprintf("Using %s UUID.", strings.ToLower(source(panelSettings.UUID != ""))))
+
+    deployment.TrPass = panelSettings.TrPass
+    if deployment.TrPass == "" {
+        deployment.TrPass = generateTrPassword(panelSettings.TrPassLength)
+    }
+    registerSecret(deployment.TrPass)
+    fmt.Printf("\n%s %s %sTrojan password%s: %s%s%s\n", infoPrefix, source(panelSettings.TrPass != ""), bold+green, reset, cyan, redact(deployment.TrPass), reset)
+    successMessage(fmt.Sprintf("Using %s Trojan password.", strings.ToLower(source(panelSettings.TrPass != ""))))
+
+    deployment.ProxyIP = strings.Join(panelSettings.ProxyIPs, ",")
+    if deployment.ProxyIP == strings.Join(defaults.ProxyIPs, ",") {
+        fmt.Printf("\n%s Default %sProxy IP%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, deployment.ProxyIP, reset)
+        successMessage("Using default Proxy IP.")
+    } else {
+        fmt.Printf("\n%s Configured %sProxy IP%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, deployment.ProxyIP, reset)
+        successMessage("Using configured Proxy IP.")
+    }
+
+    deployment.Fallback = panelSettings.Fallback
+    if deployment.Fallback == defaults.Fallback {
+        fmt.Printf("\n%s Default %sFallback domain%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, deployment.Fallback, reset)
+        successMessage("Using default Fallback domain.")
+    } else {
+        fmt.Printf("\n%s Configured %sFallback domain%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, deployment.Fallback, reset)
+        successMessage("Using configured Fallback domain.")
+    }
+
+    deployment.SubPath = panelSettings.SubPath
+    if deployment.SubPath == "" {
+        deployment.SubPath = generateSubURIPath(panelSettings.SubPathLength)
+    }
+    registerSecret(deployment.SubPath)
+    fmt.Printf("\n%s %s %sSubscription path%s: %s%s%s\n", infoPrefix, source(panelSettings.SubPath != ""), bold+green, reset, cyan, redact(deployment.SubPath), reset)
+    successMessage(fmt.Sprintf("Using %s Subscription path.", strings.ToLower(source(panelSettings.SubPath != ""))))
+
+    logStep("prepare-worker")
+    fmt.Printf("\n%s Preparing %sworker.js%s...\n", titlePrefix, bold+green, reset)
+    srcPath := filepath.Join(dir, "src")
+    if err := os.MkdirAll(srcPath, 0700); err != nil {
+        return nil, abort("Could not create src directory", err)
+    }
+
+    var workerPath = filepath.Join(srcPath, "worker.js")
+    if deployType == "2" {
+        workerPath = filepath.Join(srcPath, "_worker.js")
+    }
+    script, err := prepareWorkerScript(installDir, workerPath)
+    if err != nil {
+        return nil, abort("Failed to prepare a verified worker.js, refusing to deploy", err)
+    }
+    fmt.Printf("%s SHA-256: %s%s%s\n", infoPrefix, cyan, script.SHA256, reset)
+    successMessage("Worker script verified successfully!")
+    deployment.WorkerVersion = script.Tag
+    deployment.WorkerSHA256 = script.SHA256
+    deployment.WorkerSource = script.Source
+    deployment.KVID = panelSettings.KVID
+    return deployment, nil
+}
+
+// executePanel creates the KV namespace unless one is set, writes
+// wrangler.json to dir and deploys the panel from there. A label means
+// other panels deploy at the same time, so steps are logged per panel.
+func executePanel(dir string, deployment *Deployment, backend Backend, label string) error {
+    step := logStep
+    if label != "" {
+        step = func(name string) { logPanelStep(label, name) }
+    }
+    step("create-kv")
+    if err := createKVNamespace(deployment, backend, label); err != nil {
+        return err
+    }
+
+    step("build-config")
+    panelf(label, titlePrefix, "Building panel configuration...")
+    if err := buildWranglerConfig(filepath.Join(dir, "wrangler.json"), deployment); err != nil {
+        return abort("Error building Wrangler configuration", err)
+    }
+    panelf(label, successPrefix, "Panel configuration built successfully!")
+
+    var secrets map[string]string
+    if deployment.SecretsMode {
+        secrets = panelSecrets(deployment)
+        panelf(label, infoPrefix, "UUID, Trojan password and subscription path will be uploaded as encrypted secrets.")
+    }
+
+    step("deploy")
+    attempt := 0
+    err := defaultRetryPolicy.do("Deploying panel "+deployment.Name, func() error {
+        attempt++
+        panelf(label, titlePrefix, "Deploying %sBPB Panel%s (Attempt %d)...", bold+blue, reset, attempt)
+        url, err := backend.Deploy(dir, deployment.Name, deployment.DeployType, secrets)
+        if err != nil {
+            return err
+        }
+        deployment.PanelURL = url + "/panel"
+        return nil
+    })
+    if err != nil {
+        return abort(fmt.Sprintf("Failed to deploy panel %s", deployment.Name), err)
+    }
+    return nil
+}
+
+func deployPanel(installDir string, backend Backend) (*Deployment, error) {
+    if err := stagePanel(installDir); err != nil {
+        return nil, err
+    }
+    deployment, err := planPanel(installDir, installDir, backend, nil)
+    if err != nil {
+        return nil, err
+    }
+    if err := executePanel(installDir, deployment, backend, ""); err != nil {
+        return nil, err
+    }
+    successMessage("Panel deployed successfully!")
+
+    logStep("record")
+    if err := recordDeployment(installDir, *deployment); err != nil {
+        fmt.Printf("%s Warning: Could not save deployment record: %v\n", warnPrefix, err)
+    }
+    if err := tightenPermissions(installDir); err != nil {
+        fmt.Printf("%s Warning: Could not restrict permissions in %s: %v\n", warnPrefix, installDir, err)
+    }
+    return deployment, nil
+}
+
+// createKVNamespace creates a namespace for the panel unless it already
+// has one, either configured or shared with the rest of a batch.
+func createKVNamespace(deployment *Deployment, backend Backend, label string) error {
+    if deployment.KVID != "" {
+        panelf(label, infoPrefix, "Reusing KV namespace %s%s%s", cyan, deployment.KVID, reset)
+        return nil
+    }
+    if label == "" {
+        fmt.Printf("\n%s This program creates a new KV namespace each time it runs.\n   Check your Cloudflare account and delete unused KV namespaces to avoid limits.\n", warnPrefix)
+    }
+    panelf(label, titlePrefix, "Creating KV namespace...")
+    err := defaultRetryPolicy.do("Creating KV namespace", func() error {
+        kvName := fmt.Sprintf("panel_kv_%s", generateRandomString("abcdefghijklmnopqrstuvwxyz0123456789", 8, false))
+        id, err := backend.CreateKV(kvName)
+        if err != nil {
+            return err
+        }
+        deployment.KVID = id
+        return nil
+    })
+    if err != nil {
+        return abort("Failed to create KV namespace. Check logs at ~/.config/.wrangler/logs/ for details", err)
+    }
+    panelf(label, successPrefix, "KV namespace created successfully!")
+    return nil
+}
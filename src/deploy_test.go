@@ -0,0 +1,268 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+const (
+    testOAuthOutput = "Attempting to login via OAuth...\nOpening a link in your default browser: https://dash.cloudflare.com/oauth2/auth?response_type=code&client_id=test\n"
+    testKVOutput    = "Add the following to your configuration file:\n{\n  \"binding\": \"kv\",\n  \"id\": \"0123456789abcdef0123456789abcdef\"\n}\n"
+)
+
+func readWranglerConfig(t *testing.T, installDir string) map[string]any {
+    t.Helper()
+    data, err := os.ReadFile(filepath.Join(installDir, "wrangler.json"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var config map[string]any
+    if err := json.Unmarshal(data, &config); err != nil {
+        t.Fatal(err)
+    }
+    return config
+}
+
+func newTestWranglerBackend(t *testing.T, installDir string) (*wranglerBackend, *fakeRunner, *fakeCloudflare) {
+    api := newFakeCloudflare(t)
+    runner := &fakeRunner{}
+    runner.on("wrangler' login", ok(testOAuthOutput))
+    runner.on("kv namespace create", ok(testKVOutput))
+    return &wranglerBackend{installDir: installDir, runner: runner}, runner, api
+}
+
+func TestWorkersDeployWithWrangler(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    backend, runner, api := newTestWranglerBackend(t, installDir)
+    runner.on("deploy ./src/worker.js", ok("Uploaded panel\nDeployed panel triggers\n  https://panel.example.workers.dev\n"))
+
+    if err := loginCloudflare(backend); err != nil {
+        t.Fatalf("login: %v", err)
+    }
+    deployment, err := deployPanel(installDir, backend)
+    if err != nil {
+        t.Fatalf("deploy: %v", err)
+    }
+
+    if deployment.PanelURL != "https://panel.example.workers.dev/panel" {
+        t.Errorf("panel URL = %q", deployment.PanelURL)
+    }
+    if deployment.KVID != "0123456789abcdef0123456789abcdef" {
+        t.Errorf("KV ID = %q", deployment.KVID)
+    }
+    if deployment.WorkerVersion != "local" {
+        t.Errorf("worker version = %q, want local", deployment.WorkerVersion)
+    }
+    if _, err := os.Stat(filepath.Join(installDir, "src", "worker.js")); err != nil {
+        t.Errorf("worker.js was not prepared: %v", err)
+    }
+
+    config := readWranglerConfig(t, installDir)
+    if config["name"] != deployment.Name || config["main"] != "./src/worker.js" {
+        t.Errorf("unexpected wrangler.json: %v", config)
+    }
+    vars := config["vars"].(map[string]any)
+    if vars["UUID"] != deployment.UUID || vars["TR_PASS"] != deployment.TrPass {
+        t.Errorf("wrangler.json vars do not match the deployment: %v", vars)
+    }
+
+    record, err := findDeployment(installDir, deployment.Name)
+    if err != nil {
+        t.Fatalf("deployment was not recorded: %v", err)
+    }
+    if record.PanelURL != deployment.PanelURL {
+        t.Errorf("recorded panel URL = %q", record.PanelURL)
+    }
+
+    if api.count("/accounts/test-account/workers/scripts/"+deployment.Name+"/settings") != 1 {
+        t.Error("name availability was not checked against the account's scripts")
+    }
+    if runner.count("telemetry disable") != 1 {
+        t.Error("telemetry was not disabled after login")
+    }
+    if runner.count("oauth2/auth") != 1 {
+        t.Error("OAuth URL was not opened in a browser")
+    }
+    for _, call := range runner.calls {
+        if !strings.HasPrefix(call, shellQuote(localWranglerBin(installDir))) && !strings.Contains(call, "oauth2/auth") {
+            t.Errorf("command did not use the local wrangler: %s", call)
+        }
+    }
+}
+
+func TestPagesDeployWithWrangler(t *testing.T) {
+    installDir := setupDeploy(t, "2")
+    backend, runner, api := newTestWranglerBackend(t, installDir)
+    runner.on("pages project create", ok("Successfully created the project"))
+    runner.on("pages deploy --commit-dirty", ok("Deployment complete!"))
+
+    if err := loginCloudflare(backend); err != nil {
+        t.Fatalf("login: %v", err)
+    }
+    deployment, err := deployPanel(installDir, backend)
+    if err != nil {
+        t.Fatalf("deploy: %v", err)
+    }
+
+    if want := "https://" + deployment.Name + ".pages.dev/panel"; deployment.PanelURL != want {
+        t.Errorf("panel URL = %q, want %q", deployment.PanelURL, want)
+    }
+    if _, err := os.Stat(filepath.Join(installDir, "src", "_worker.js")); err != nil {
+        t.Errorf("_worker.js was not prepared: %v", err)
+    }
+    config := readWranglerConfig(t, installDir)
+    if config["pages_build_output_dir"] != "./src/" {
+        t.Errorf("unexpected wrangler.json: %v", config)
+    }
+    if runner.count("pages project create "+deployment.Name) != 1 {
+        t.Errorf("Pages project was not created for %s", deployment.Name)
+    }
+    if api.count("/accounts/test-account/pages/projects/"+deployment.Name) != 1 {
+        t.Error("name availability was not checked against Pages")
+    }
+}
+
+func TestWranglerDeployRetries(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    api := newFakeCloudflare(t)
+    api.taken = 1
+    runner := &fakeRunner{}
+    backend := &wranglerBackend{installDir: installDir, runner: runner}
+    runner.on("kv namespace create", fail("fetch failed"), fail("fetch failed"), fail("fetch failed"), ok(testKVOutput))
+    runner.on("deploy ./src/worker.js", fail("A request to the Cloudflare API failed. [code: 503]"), fail("socket hang up"), fail("fetch failed"), ok("https://panel.example.workers.dev"))
+
+    deployment, err := deployPanel(installDir, backend)
+    if err != nil {
+        t.Fatalf("deploy: %v", err)
+    }
+    if got := api.count("/workers/scripts/"); got != nameBatchSize {
+        t.Errorf("expected one batch of %d name checks, got %d", nameBatchSize, got)
+    }
+    if got := runner.count("kv namespace create"); got != 4 {
+        t.Errorf("kv namespace create ran %d times, want 4", got)
+    }
+    if got := runner.count("deploy ./src/worker.js"); got != 4 {
+        t.Errorf("deploy ran %d times, want 4", got)
+    }
+    if deployment.PanelURL != "https://panel.example.workers.dev/panel" {
+        t.Errorf("panel URL = %q", deployment.PanelURL)
+    }
+}
+
+func TestWranglerDeployFailure(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    backend, runner, _ := newTestWranglerBackend(t, installDir)
+    runner.on("deploy ./src/worker.js", fail("Authentication error [code: 10000]"))
+
+    _, err := deployPanel(installDir, backend)
+    if err == nil || !strings.Contains(err.Error(), "Failed to deploy panel") {
+        t.Fatalf("expected a deploy failure, got %v", err)
+    }
+    if got := runner.count("deploy ./src/worker.js"); got != 1 {
+        t.Errorf("deploy ran %d times after an authentication error, want 1", got)
+    }
+    deployments, err := loadDeployments(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(deployments) != 0 {
+        t.Errorf("failed deployment was recorded: %v", deployments)
+    }
+}
+
+func TestWranglerDeployGivesUpOnTransientErrors(t *testing.T) {
+    installDir := setupDeploy(t, "2")
+    backend, runner, _ := newTestWranglerBackend(t, installDir)
+    runner.on("pages project create", ok("Successfully created the project"))
+    runner.on("pages deploy --commit-dirty", fail("fetch failed"))
+
+    if _, err := deployPanel(installDir, backend); err == nil {
+        t.Fatal("expected the deploy to fail")
+    }
+    if got := runner.count("pages deploy --commit-dirty"); got != defaultRetryPolicy.maxAttempts {
+        t.Errorf("pages deploy ran %d times, want %d", got, defaultRetryPolicy.maxAttempts)
+    }
+    if got := runner.count("pages project create"); got != 1 {
+        t.Errorf("Pages project was created %d times, want 1", got)
+    }
+}
+
+func TestWranglerLoginTimeout(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    loginURLTimeout = 20 * time.Millisecond
+    runner := &fakeRunner{}
+    runner.on("login", ok("no URL here"))
+    backend := &wranglerBackend{installDir: installDir, runner: runner}
+
+    err := loginCloudflare(backend)
+    if !errors.Is(err, errLoginTimeout) {
+        t.Fatalf("expected a login timeout, got %v", err)
+    }
+    if runner.count("login") != 1 {
+        t.Errorf("login was retried after a timeout")
+    }
+}
+
+func TestLoginRetries(t *testing.T) {
+    setupDeploy(t, "1")
+    backend := newMemoryBackend()
+    backend.loginFailures = 2
+    if err := loginCloudflare(backend); err != nil {
+        t.Fatalf("login: %v", err)
+    }
+    if backend.logins != 3 {
+        t.Errorf("login ran %d times, want 3", backend.logins)
+    }
+
+    backend = newMemoryBackend()
+    backend.loginFailures = loginRetryPolicy.maxAttempts
+    if err := loginCloudflare(backend); err == nil {
+        t.Fatal("expected login to fail")
+    }
+}
+
+func TestMemoryBackendDeploy(t *testing.T) {
+    for _, kind := range []string{"1", "2"} {
+        installDir := setupDeploy(t, kind)
+        backend := newMemoryBackend()
+        backend.takenChecks = 2
+        backend.kvFailures = 2
+        backend.deployFailures = 2
+
+        deployment, err := deployPanel(installDir, backend)
+        if err != nil {
+            t.Fatalf("deploy type %s: %v", kind, err)
+        }
+        if len(backend.nameChecks) != nameBatchSize {
+            t.Errorf("deploy type %s: %d name checks, want %d", kind, len(backend.nameChecks), nameBatchSize)
+        }
+        if backend.deployed[deployment.Name]+"/panel" != deployment.PanelURL {
+            t.Errorf("deploy type %s: panel URL %q not served by the backend", kind, deployment.PanelURL)
+        }
+        if deployment.DeployType != kind {
+            t.Errorf("deploy type %s: recorded type %q", kind, deployment.DeployType)
+        }
+    }
+}
+
+func TestMemoryBackendKVFailure(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    backend := newMemoryBackend()
+    backend.kvFailures = defaultRetryPolicy.maxAttempts
+
+    _, err := deployPanel(installDir, backend)
+    if err == nil || !strings.Contains(err.Error(), "KV namespace") {
+        t.Fatalf("expected a KV failure, got %v", err)
+    }
+    if len(backend.deployed) != 0 {
+        t.Error("panel was deployed without a KV namespace")
+    }
+    if _, err := os.Stat(filepath.Join(installDir, "wrangler.json")); !errors.Is(err, os.ErrNotExist) {
+        t.Error("wrangler.json was written without a KV namespace")
+    }
+}
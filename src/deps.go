@@ -0,0 +1,236 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "os/exec"
+    "time"
+)
+
+type packageManager struct {
+    name        string
+    update      string
+    installNode string
+    // upgradeNode replaces a Node.js older than minNodeMajor. Some
+    // managers leave an installed package alone on install.
+    upgradeNode string
+    installNpm  string
+    needsRoot   bool
+}
+
+var packageManagers = []packageManager{
+    {
+        name:        "pkg",
+        update:      "pkg update -y",
+        installNode: "pkg install -y nodejs-lts",
+        upgradeNode: "pkg install -y nodejs-lts",
+        installNpm:  "pkg install -y nodejs-lts",
+    },
+    {
+        name:        "apt-get",
+        update:      "apt-get update",
+        installNode: "apt-get install -y ca-certificates curl && curl -fsSL https://deb.nodesource.com/setup_lts.x | bash - && apt-get install -y nodejs",
+        upgradeNode: "apt-get install -y ca-certificates curl && curl -fsSL https://deb.nodesource.com/setup_lts.x | bash - && apt-get install -y nodejs",
+        installNpm:  "apt-get install -y npm",
+        needsRoot:   true,
+    },
+    {
+        name:        "dnf",
+        update:      "dnf makecache",
+        installNode: "dnf install -y nodejs npm",
+        upgradeNode: "dnf upgrade -y nodejs npm",
+        installNpm:  "dnf install -y npm",
+        needsRoot:   true,
+    },
+    {
+        name:        "pacman",
+        update:      "pacman -Sy --noconfirm",
+        installNode: "pacman -S --noconfirm --needed nodejs npm",
+        upgradeNode: "pacman -S --noconfirm nodejs npm",
+        installNpm:  "pacman -S --noconfirm --needed npm",
+        needsRoot:   true,
+    },
+    {
+        name:        "brew",
+        update:      "brew update",
+        installNode: "brew install node",
+        upgradeNode: "brew upgrade node",
+        installNpm:  "brew install node",
+    },
+}
+
+func detectPackageManager() (*packageManager, error) {
+    for i := range packageManagers {
+        manager := &packageManagers[i]
+        if manager.name == "pkg" && detectPlatform() != "Termux" {
+            continue
+        }
+        if _, err := exec.LookPath(manager.name); err == nil {
+            return manager, nil
+        }
+    }
+    return nil, fmt.Errorf("no supported package manager found (apt, pkg, dnf, pacman or brew)")
+}
+
+func (m *packageManager) command(command string) string {
+    if !m.needsRoot || os.Geteuid() == 0 {
+        return command
+    }
+    if _, err := exec.LookPath("sudo"); err == nil {
+        return "sudo sh -c " + shellQuote(command)
+    }
+    return command
+}
+
+// nodeCommand installs Node.js, or upgrades the one already installed.
+func (m *packageManager) nodeCommand(installed bool) string {
+    if installed {
+        return m.upgradeNode
+    }
+    return m.installNode
+}
+
+func runInteractive(command string, attempts int) error {
+    return defaultRetryPolicy.withAttempts(attempts).do("Command", func() error {
+        fmt.Printf("%s %s%s%s\n", infoPrefix, cyan, command, reset)
+        cmd := exec.Command("sh", "-c", command)
+        cmd.Env = commandEnv()
+        cmd.Stdout = os.Stdout
+        cmd.Stderr = os.Stderr
+        cmd.Stdin = os.Stdin
+        start := time.Now()
+        err := cmd.Run()
+        logCommand(command, start, "", err)
+        return err
+    })
+}
+
+func ensureNode(manager *packageManager) error {
+    err := checkNode()
+    if err == nil {
+        major, _ := nodeMajorVersion()
+        successMessage(fmt.Sprintf("Node.js v%d meets the minimum of v%d.", major, minNodeMajor))
+        return nil
+    }
+    fmt.Printf("%s %s\n", warnPrefix, redact(err.Error()))
+    _, lookErr := exec.LookPath("node")
+    fmt.Printf("%s Installing Node.js v%d or higher with %s...\n", infoPrefix, minNodeMajor, manager.name)
+    if err := runInteractive(manager.command(manager.nodeCommand(lookErr == nil)), 3); err != nil {
+        return err
+    }
+    return checkNode()
+}
+
+func ensureNpm(manager *packageManager, upgrade bool) error {
+    if err := checkNpm(); err != nil {
+        fmt.Printf("%s Installing npm with %s...\n", infoPrefix, manager.name)
+        if err := runInteractive(manager.command(manager.installNpm), 3); err != nil {
+            return err
+        }
+        if err := checkNpm(); err != nil {
+            return err
+        }
+    }
+    if upgrade {
+        fmt.Printf("%s Upgrading npm...\n", infoPrefix)
+        if err := runInteractive(npmGlobalCommand("npm install -g npm@latest"), 3); err != nil {
+            fmt.Printf("%s Warning: Could not upgrade npm, continuing with the installed version: %s\n", warnPrefix, redact(err.Error()))
+        }
+    }
+    version, _ := commandVersion("npm", "-v")
+    successMessage(fmt.Sprintf("npm %s is ready.", version))
+    return nil
+}
+
+func npmGlobalCommand(command string) string {
+    if os.Geteuid() == 0 || detectPlatform() == "Termux" {
+        return command
+    }
+    prefix, err := commandVersion("npm", "prefix", "-g")
+    if err != nil || isWritableDir(prefix) {
+        return command
+    }
+    if _, err := exec.LookPath("sudo"); err == nil {
+        return "sudo " + command
+    }
+    return command
+}
+
+func isWritableDir(dir string) bool {
+    probe, err := os.CreateTemp(dir, ".bpb-write-test-*")
+    if err != nil {
+        return false
+    }
+    probe.Close()
+    os.Remove(probe.Name())
+    return true
+}
+
+func ensureWrangler(installDir string) error {
+    if err := ensureLocalWrangler(installDir); err != nil {
+        return err
+    }
+    if err := checkWrangler(installDir); err != nil {
+        return err
+    }
+    successMessage(fmt.Sprintf("Wrangler %s is ready.", pinnedWranglerVersion()))
+    return nil
+}
+
+func runInstallDeps(args []string) {
+    fs := flag.NewFlagSet("install-deps", flag.ExitOnError)
+    upgrade := fs.Bool("upgrade", false, "Upgrade npm even if it is already installed")
+    skipUpdate := fs.Bool("skip-update", false, "Do not refresh the package manager index first")
+    fs.StringVar(&wranglerVersionFlag, "wrangler-version", "", "Override the tested Wrangler version (for testing)")
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    if wranglerVersionFlag != "" && !isValidWranglerVersion(wranglerVersionFlag) {
+        failMessage("Invalid -wrangler-version value. Use an exact version such as 4.20.0.", nil)
+        return
+    }
+    installDir, err := getInstallDir()
+    if err != nil {
+        failMessage("Error getting home directory", err)
+        return
+    }
+
+    fmt.Printf("\n%s Installing %sBPB Terminal Wizard%s dependencies...\n", titlePrefix, bold+blue, reset)
+    fmt.Printf("%s Platform: %s%s%s\n", infoPrefix, cyan, detectPlatform(), reset)
+    if detectPlatform() == "Termux" {
+        fmt.Printf("%s Wrangler is best supported inside proot-distro Ubuntu on Termux; install.sh sets that up for you.\n", warnPrefix)
+    }
+
+    manager, err := detectPackageManager()
+    if err != nil {
+        failMessage("Cannot install dependencies automatically", err)
+        os.Exit(1)
+    }
+    fmt.Printf("%s Package manager: %s%s%s\n", infoPrefix, cyan, manager.name, reset)
+
+    if !*skipUpdate {
+        if err := runInteractive(manager.command(manager.update), 3); err != nil {
+            fmt.Printf("%s Warning: Could not update package index, continuing anyway: %s\n", warnPrefix, redact(err.Error()))
+        }
+    }
+
+    if err := ensureNode(manager); err != nil {
+        failMessage(fmt.Sprintf("Could not install Node.js v%d or higher", minNodeMajor), err)
+        os.Exit(1)
+    }
+    if err := ensureNpm(manager, *upgrade); err != nil {
+        failMessage("Could not install npm", err)
+        os.Exit(1)
+    }
+    if err := ensureWrangler(installDir); err != nil {
+        failMessage("Could not install Wrangler", err)
+        os.Exit(1)
+    }
+
+    successMessage("All dependencies are installed!")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestDetectPackageManager(t *testing.T) {
+    if detectPlatform() == "Termux" {
+        t.Skip("pkg is preferred on Termux")
+    }
+    tests := []struct {
+        tools []string
+        want  string
+    }{
+        {[]string{"apt-get", "dnf", "brew"}, "apt-get"},
+        {[]string{"brew", "pacman"}, "pacman"},
+        {[]string{"brew"}, "brew"},
+        {[]string{"pkg", "dnf"}, "dnf"},
+        {[]string{"pkg"}, ""},
+        {nil, ""},
+    }
+    for _, tt := range tests {
+        dir := t.TempDir()
+        for _, tool := range tt.tools {
+            if err := os.WriteFile(filepath.Join(dir, tool), []byte("#!/bin/sh\n"), 0700); err != nil {
+                t.Fatal(err)
+            }
+        }
+        t.Setenv("PATH", dir)
+        manager, err := detectPackageManager()
+        switch {
+        case tt.want == "" && err == nil:
+            t.Errorf("%v: chose %s, want no package manager", tt.tools, manager.name)
+        case tt.want != "" && (err != nil || manager.name != tt.want):
+            t.Errorf("%v: got %v, %v, want %s", tt.tools, manager, err, tt.want)
+        }
+    }
+}
+
+func TestNodeCommand(t *testing.T) {
+    tests := []struct {
+        manager   string
+        installed bool
+        want      string
+    }{
+        {"dnf", false, "dnf install -y nodejs npm"},
+        {"dnf", true, "dnf upgrade -y nodejs npm"},
+        {"pacman", false, "pacman -S --noconfirm --needed nodejs npm"},
+        {"pacman", true, "pacman -S --noconfirm nodejs npm"},
+        {"brew", false, "brew install node"},
+        {"brew", true, "brew upgrade node"},
+    }
+    for _, tt := range tests {
+        for i := range packageManagers {
+            if manager := &packageManagers[i]; manager.name == tt.manager {
+                if got := manager.nodeCommand(tt.installed); got != tt.want {
+                    t.Errorf("%s installed=%v: %q, want %q", tt.manager, tt.installed, got, tt.want)
+                }
+            }
+        }
+    }
+    for _, manager := range packageManagers {
+        if manager.upgradeNode == "" || strings.Contains(manager.upgradeNode, "--needed") {
+            t.Errorf("%s cannot upgrade an old Node.js: %q", manager.name, manager.upgradeNode)
+        }
+    }
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+    "context"
+    "crypto/tls"
+    "flag"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "runtime"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    statusPass           = "PASS"
+    statusWarn           = "WARN"
+    statusFail           = "FAIL"
+
+    minFreeDiskMB        = 200
+    doctorCommandTimeout = 45 * time.Second
+)
+
+type DoctorCheck struct {
+    Name   string `json:"name"`
+    Status string `json:"status"`
+    Detail string `json:"detail"`
+    Hint   string `json:"hint,omitempty"`
+}
+
+func commandVersion(name string, args ...string) (string, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), doctorCommandTimeout)
+    defer cancel()
+    cmd := exec.CommandContext(ctx, name, args...)
+    cmd.Env = commandEnv()
+    output, err := cmd.CombinedOutput()
+    return strings.TrimSpace(string(output)), err
+}
+
+func isProot() bool {
+    data, err := os.ReadFile("/proc/self/status")
+    if err != nil {
+        return false
+    }
+    for _, line := range strings.Split(string(data), "\n") {
+        pid, found := strings.CutPrefix(line, "TracerPid:")
+        if !found {
+            continue
+        }
+        pid = strings.TrimSpace(pid)
+        if pid == "0" {
+            return false
+        }
+        comm, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+        return err == nil && strings.Contains(string(comm), "proot")
+    }
+    return false
+}
+
+func detectPlatform() string {
+    if runtime.GOOS == "darwin" {
+        return "macOS"
+    }
+    _, termuxErr := os.Stat("/data/data/com.termux")
+    if isProot() || (termuxErr == nil && fileExists("/etc/os-release")) {
+        return "proot-distro"
+    }
+    if termuxErr == nil {
+        return "Termux"
+    }
+    return "Linux"
+}
+
+func fileExists(path string) bool {
+    _, err := os.Stat(path)
+    return err == nil
+}
+
+func checkNodeVersion() DoctorCheck {
+    check := DoctorCheck{Name: "Node.js"}
+    major, err := nodeMajorVersion()
+    if err != nil {
+        check.Status, check.Detail = statusFail, "not found"
+        check.Hint = fmt.Sprintf("Install Node.js v%d or higher.", minNodeMajor)
+        return check
+    }
+    version, _ := commandVersion("node", "-v")
+    check.Detail = fmt.Sprintf("%s (minimum v%d)", version, minNodeMajor)
+    check.Status = statusPass
+    if major < minNodeMajor {
+        check.Status = statusFail
+        check.Hint = fmt.Sprintf("Upgrade Node.js to v%d or higher.", minNodeMajor)
+    }
+    return check
+}
+
+func checkNpmVersion() DoctorCheck {
+    check := DoctorCheck{Name: "npm"}
+    version, err := commandVersion("npm", "-v")
+    if err != nil {
+        check.Status, check.Detail = statusFail, "not found"
+        check.Hint = "Install npm (it usually ships with Node.js)."
+        return check
+    }
+    check.Status, check.Detail = statusPass, version
+    return check
+}
+
+func checkWranglerVersion(installDir string) DoctorCheck {
+    check := DoctorCheck{Name: "Wrangler"}
+    pinned := pinnedWranglerVersion()
+    installed, err := installedWranglerVersion(installDir)
+    if err != nil {
+        check.Status, check.Detail = statusWarn, "not installed (tested version "+pinned+")"
+        check.Hint = "Run install-deps, or let the wizard install it during deployment."
+        return check
+    }
+    check.Detail = fmt.Sprintf("%s (tested version %s)", installed, pinned)
+    check.Status = statusPass
+    if installed != pinned {
+        check.Status = statusWarn
+        check.Hint = "Run install-deps to switch to the tested Wrangler version."
+    }
+    return check
+}
+
+func checkPlatform() DoctorCheck {
+    return DoctorCheck{
+        Name:   "Platform",
+        Status: statusPass,
+        Detail: fmt.Sprintf("%s (%s/%s)", detectPlatform(), runtime.GOOS, runtime.GOARCH),
+    }
+}
+
+func checkBrowserOpener() DoctorCheck {
+    check := DoctorCheck{Name: "Browser opener"}
+    var candidates []string
+    switch detectPlatform() {
+    case "macOS":
+        candidates = []string{"open"}
+    case "Termux", "proot-distro":
+        candidates = []string{"termux-open-url", "xdg-open"}
+    default:
+        candidates = []string{"xdg-open"}
+    }
+    for _, candidate := range candidates {
+        if path, err := exec.LookPath(candidate); err == nil {
+            check.Status, check.Detail = statusPass, path
+            return check
+        }
+    }
+    check.Status = statusWarn
+    check.Detail = strings.Join(candidates, "/") + " not found"
+    check.Hint = "The OAuth URL must be opened manually. On Termux install termux-tools; on Linux install xdg-utils."
+    return check
+}
+
+func checkInstallDir(installDir string) DoctorCheck {
+    check := DoctorCheck{Name: "Install directory"}
+    info, err := os.Stat(installDir)
+    if err != nil {
+        check.Status, check.Detail = statusWarn, installDir+" does not exist yet"
+        check.Hint = "It will be created on the first deployment."
+        return check
+    }
+    probe := filepath.Join(installDir, ".doctor-write-test")
+    if err := os.WriteFile(probe, []byte("ok"), 0600); err != nil {
+        check.Status, check.Detail = statusFail, installDir+" is not writable"
+        check.Hint = "Fix ownership with: chown -R $(id -u) " + installDir
+        return check
+    }
+    os.Remove(probe)
+    check.Status = statusPass
+    check.Detail = fmt.Sprintf("%s (%#o)", installDir, info.Mode().Perm())
+    if info.Mode().Perm()&0022 != 0 {
+        check.Status = statusWarn
+        check.Hint = "Restrict permissions with: chmod 700 " + installDir
+    }
+    return check
+}
+
+func checkWranglerAuth(installDir string) DoctorCheck {
+    check := DoctorCheck{Name: "Cloudflare login"}
+    if _, err := installedWranglerVersion(installDir); err != nil {
+        check.Status, check.Detail = statusWarn, "unknown, Wrangler is not installed"
+        return check
+    }
+    output, err := commandVersion(localWranglerBin(installDir), "whoami")
+    switch {
+    case strings.Contains(output, "You are logged in"):
+        check.Status, check.Detail = statusPass, "logged in"
+    case err != nil && !strings.Contains(output, "not authenticated"):
+        check.Status, check.Detail = statusWarn, "could not determine login state"
+        check.Hint = "Run: " + localWranglerBin(installDir) + " whoami"
+    default:
+        check.Status, check.Detail = statusWarn, "not logged in"
+        check.Hint = "The wizard will start the Cloudflare login during deployment."
+    }
+    return check
+}
+
+func checkClockSkew() DoctorCheck {
+    check := DoctorCheck{Name: "Clock skew"}
+    req, err := http.NewRequest(http.MethodHead, "https://api.cloudflare.com/client/v4/ips", nil)
+    if err != nil {
+        check.Status, check.Detail = statusWarn, err.Error()
+        return check
+    }
+    start := time.Now()
+    resp, err := newHTTPClient(15 * time.Second).Do(req)
+    if err != nil {
+        check.Status, check.Detail = statusWarn, "could not reach Cloudflare to compare clocks"
+        return check
+    }
+    resp.Body.Close()
+    serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+    if err != nil {
+        check.Status, check.Detail = statusWarn, "server did not report its time"
+        return check
+    }
+    localTime := start.Add(time.Since(start) / 2)
+    skew := localTime.Sub(serverTime).Round(time.Second)
+    check.Detail = fmt.Sprintf("%s off Cloudflare time", skew)
+    switch abs := max(skew, -skew); {
+    case abs > 5*time.Minute:
+        check.Status = statusFail
+        check.Hint = "Fix the system clock; Cloudflare OAuth fails with large clock skew."
+    case abs > 30*time.Second:
+        check.Status = statusWarn
+        check.Hint = "Consider syncing the system clock."
+    default:
+        check.Status = statusPass
+    }
+    return check
+}
+
+func checkEndpoint(name, host string) DoctorCheck {
+    check := DoctorCheck{Name: name}
+    ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+    defer cancel()
+
+    if activeNetwork.proxy == nil {
+        var ips []string
+        var err error
+        if activeNetwork.resolver != nil {
+            ips, err = activeNetwork.resolver.lookup(ctx, host)
+        } else {
+            ips, err = net.DefaultResolver.LookupHost(ctx, host)
+        }
+        if err != nil || len(ips) == 0 {
+            check.Status, check.Detail = statusFail, "DNS lookup failed"
+            check.Hint = "DNS may be blocked or poisoned. Try -doh https://1.1.1.1/dns-query or -proxy."
+            return check
+        }
+    }
+
+    start := time.Now()
+    conn, err := activeNetwork.dial(ctx, "tcp", net.JoinHostPort(host, "443"))
+    if err != nil {
+        check.Status, check.Detail = statusFail, "TCP connection failed"
+        check.Hint = "The host is unreachable from this network. Try -proxy."
+        return check
+    }
+    defer conn.Close()
+    tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+    tlsConn.SetDeadline(time.Now().Add(15 * time.Second))
+    if err := tlsConn.Handshake(); err != nil {
+        check.Status, check.Detail = statusFail, "TLS handshake failed"
+        check.Hint = "TLS may be intercepted or filtered. Try -proxy."
+        return check
+    }
+    check.Status = statusPass
+    check.Detail = fmt.Sprintf("DNS+TLS ok in %dms", time.Since(start).Milliseconds())
+    return check
+}
+
+func checkDiskSpace(installDir string) DoctorCheck {
+    check := DoctorCheck{Name: "Free disk space"}
+    dir := installDir
+    if !fileExists(dir) {
+        dir = filepath.Dir(dir)
+    }
+    output, err := exec.Command("df", "-Pk", dir).Output()
+    if err != nil {
+        check.Status, check.Detail = statusWarn, "could not run df"
+        return check
+    }
+    lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+    fields := strings.Fields(lines[len(lines)-1])
+    if len(fields) < 4 {
+        check.Status, check.Detail = statusWarn, "could not parse df output"
+        return check
+    }
+    availableKB, err := strconv.ParseInt(fields[3], 10, 64)
+    if err != nil {
+        check.Status, check.Detail = statusWarn, "could not parse df output"
+        return check
+    }
+    check.Detail = formatBytes(availableKB*1024) + " available"
+    check.Status = statusPass
+    if availableKB/1024 < minFreeDiskMB {
+        check.Status = statusFail
+        check.Hint = fmt.Sprintf("Free at least %d MB for Node modules and the worker cache.", minFreeDiskMB)
+    }
+    return check
+}
+
+func runDoctorChecks(installDir string) []DoctorCheck {
+    return []DoctorCheck{
+        checkPlatform(),
+        checkNodeVersion(),
+        checkNpmVersion(),
+        checkWranglerVersion(installDir),
+        checkBrowserOpener(),
+        checkInstallDir(installDir),
+        checkDiskSpace(installDir),
+        checkWranglerAuth(installDir),
+        checkClockSkew(),
+        checkEndpoint("GitHub", "github.com"),
+        checkEndpoint("npm registry", "registry.npmjs.org"),
+        checkEndpoint("Cloudflare API", "api.cloudflare.com"),
+    }
+}
+
+func printDoctorChecks(checks []DoctorCheck) {
+    fmt.Printf("\n  %-6s %-18s %s\n", "STATUS", "CHECK", "DETAIL")
+    for _, check := range checks {
+        color := green
+        switch check.Status {
+        case statusWarn:
+            color = yellow
+        case statusFail:
+            color = red
+        }
+        fmt.Printf("  %s%-6s%s %-18s %s\n", bold+color, check.Status, reset, check.Name, check.Detail)
+    }
+
+    var hints []DoctorCheck
+    for _, check := range checks {
+        if check.Hint != "" && check.Status != statusPass {
+            hints = append(hints, check)
+        }
+    }
+    if len(hints) > 0 {
+        fmt.Printf("\n%s Remediation hints:\n", infoPrefix)
+        for _, check := range hints {
+            fmt.Printf("  - %s%s%s: %s\n", bold, check.Name, reset, check.Hint)
+        }
+    }
+}
+
+func runDoctor(args []string) {
+    fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    installDir, err := getInstallDir()
+    if err != nil {
+        failMessage("Error getting home directory", err)
+        return
+    }
+
+    fmt.Printf("\n%s Running %sBPB Terminal Wizard%s diagnostics...\n", titlePrefix, bold+blue, reset)
+    checks := runDoctorChecks(installDir)
+    printDoctorChecks(checks)
+
+    failed := 0
+    for _, check := range checks {
+        if check.Status == statusFail {
+            failed++
+        }
+    }
+    if failed > 0 {
+        fmt.Printf("\n%s %d check(s) failed.\n", errorPrefix, failed)
+        os.Exit(1)
+    }
+    successMessage("No blocking problems found.")
+}
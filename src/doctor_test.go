@@ -0,0 +1,59 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestCheckNodeVersion(t *testing.T) {
+    tests := []struct {
+        name   string
+        output string
+        want   string
+    }{
+        {"current release", "v22.1.0", statusPass},
+        {"minimum", "v20.0.0", statusPass},
+        {"too old", "v18.19.0", statusFail},
+        {"not installed", "", statusFail},
+    }
+    for _, tt := range tests {
+        dir := t.TempDir()
+        if tt.output != "" {
+            writeScript(t, filepath.Join(dir, "node"), "echo "+tt.output)
+        }
+        t.Setenv("PATH", dir)
+        if check := checkNodeVersion(); check.Status != tt.want || (check.Status != statusPass) != (check.Hint != "") {
+            t.Errorf("%s: %+v, want %s with a hint unless it passes", tt.name, check, tt.want)
+        }
+    }
+}
+
+func TestCheckInstallDir(t *testing.T) {
+    tests := []struct {
+        name string
+        mode os.FileMode
+        want string
+    }{
+        {"private", 0700, statusPass},
+        {"writable by the group", 0770, statusWarn},
+        {"read-only", 0500, statusFail},
+    }
+    for _, tt := range tests {
+        if tt.mode&0200 == 0 && os.Geteuid() == 0 {
+            continue // root can write to any directory
+        }
+        dir := filepath.Join(t.TempDir(), "install")
+        if err := os.Mkdir(dir, tt.mode); err != nil {
+            t.Fatal(err)
+        }
+        os.Chmod(dir, tt.mode)
+        if check := checkInstallDir(dir); check.Status != tt.want {
+            t.Errorf("%s: %+v, want %s", tt.name, check, tt.want)
+        }
+        os.Chmod(dir, 0700)
+    }
+    if check := checkInstallDir(filepath.Join(t.TempDir(), "missing")); check.Status != statusWarn {
+        t.Errorf("missing directory: %+v", check)
+    }
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+    "time"
+)
+
+const (
+    connectTimeout  = 15 * time.Second
+    apiTimeout      = 30 * time.Second
+    downloadTimeout = 5 * time.Minute
+)
+
+func newHTTPClient(timeout time.Duration) *http.Client {
+    return &http.Client{Transport: activeNetwork.transport(), Timeout: timeout}
+}
+
+func isTerminal(f *os.File) bool {
+    info, err := f.Stat()
+    if err != nil {
+        return false
+    }
+    return info.Mode()&os.ModeCharDevice != 0
+}
+
+func formatBytes(n int64) string {
+    const unit = 1024
+    if n < unit {
+        return fmt.Sprintf("%d B", n)
+    }
+    div, exp := int64(unit), 0
+    for v := n / unit; v >= unit; v /= unit {
+        div *= unit
+        exp++
+    }
+    return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// progressWriter shows download progress. resumed is what an earlier
+// attempt had already fetched; it counts toward the bar but not the speed.
+type progressWriter struct {
+    total     int64
+    written   int64
+    resumed   int64
+    start     time.Time
+    lastPrint time.Time
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+    p.written += int64(len(b))
+    if time.Since(p.lastPrint) >= 200*time.Millisecond {
+        p.print()
+        p.lastPrint = time.Now()
+    }
+    return len(b), nil
+}
+
+func (p *progressWriter) print() {
+    elapsed := time.Since(p.start).Seconds()
+    speed := int64(0)
+    if elapsed > 0 {
+        speed = int64(float64(p.written-p.resumed) / elapsed)
+    }
+    if p.total > 0 {
+        const width = 24
+        filled := int(float64(width) * float64(p.written) / float64(p.total))
+        filled = max(0, min(filled, width))
+        bar := strings.Repeat("#", filled) + strings.Repeat(".", width-filled)
+        fmt.Printf("\r  [%s] %s / %s  %s/s   ", bar, formatBytes(p.written), formatBytes(p.total), formatBytes(speed))
+        return
+    }
+    fmt.Printf("\r  %s  %s/s   ", formatBytes(p.written), formatBytes(speed))
+}
+
+func (p *progressWriter) finish() {
+    p.print()
+    fmt.Println()
+}
+
+// partFilePath is where a download of url into dest is kept until it
+// completes. It is keyed by URL so a resume never splices bytes from two
+// different sources into one file.
+func partFilePath(url, dest string) string {
+    sum := sha256.Sum256([]byte(url))
+    return dest + "." + hex.EncodeToString(sum[:6]) + ".part"
+}
+
+func downloadOnce(url, dest string, header http.Header, maxSize int64) (int, http.Header, error) {
+    partPath := partFilePath(url, dest)
+    conditional := header.Get("If-None-Match") != "" || header.Get("If-Modified-Since") != ""
+
+    var offset int64
+    if conditional {
+        os.Remove(partPath)
+    } else if info, err := os.Stat(partPath); err == nil {
+        offset = info.Size()
+    }
+
+    req, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return 0, nil, fmt.Errorf("error creating request: %v", err)
+    }
+    for key, values := range header {
+        req.Header[key] = values
+    }
+    req.Header.Set("User-Agent", "BPB-Terminal-Wizard")
+    if offset > 0 {
+        req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+    }
+
+    start := time.Now()
+    resp, err := newHTTPClient(downloadTimeout).Do(req)
+    if err != nil {
+        logRequest(http.MethodGet, url, 0, start, err)
+        return 0, nil, fmt.Errorf("error making GET request: %v", err)
+    }
+    defer resp.Body.Close()
+    logRequest(http.MethodGet, url, resp.StatusCode, start, nil)
+
+    flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+    switch resp.StatusCode {
+    case http.StatusOK:
+        offset = 0
+    case http.StatusPartialContent:
+        flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+        fmt.Printf("%s Resuming download at %s\n", infoPrefix, formatBytes(offset))
+    case http.StatusNotModified:
+        return resp.StatusCode, resp.Header, nil
+    case http.StatusRequestedRangeNotSatisfiable:
+        os.Remove(partPath)
+        return resp.StatusCode, resp.Header, &httpStatusError{status: resp.StatusCode, message: fmt.Sprintf("server rejected resume of partial download (HTTP %d)", resp.StatusCode)}
+    default:
+        return resp.StatusCode, resp.Header, &httpStatusError{
+            status:     resp.StatusCode,
+            retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+            message:    fmt.Sprintf("failed to download file: %s (HTTP %d)", url, resp.StatusCode),
+        }
+    }
+
+    if resp.ContentLength > maxSize {
+        return resp.StatusCode, resp.Header, fmt.Errorf("file is too large (%d bytes, limit %d)", resp.ContentLength, maxSize)
+    }
+
+    out, err := os.OpenFile(partPath, flags, 0640)
+    if err != nil {
+        return resp.StatusCode, resp.Header, fmt.Errorf("error creating file: %v", err)
+    }
+
+    var writer io.Writer = out
+    var progress *progressWriter
+    if isTerminal(os.Stdout) {
+        total := int64(-1)
+        if resp.ContentLength > 0 {
+            total = offset + resp.ContentLength
+        }
+        progress = &progressWriter{total: total, written: offset, resumed: offset, start: time.Now()}
+        writer = io.MultiWriter(out, progress)
+    }
+
+    written, err := io.Copy(writer, io.LimitReader(resp.Body, maxSize+1-offset))
+    if progress != nil {
+        progress.finish()
+    }
+    if closeErr := out.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return resp.StatusCode, resp.Header, fmt.Errorf("error writing to file: %v", err)
+    }
+    if offset+written > maxSize {
+        os.Remove(partPath)
+        return resp.StatusCode, resp.Header, fmt.Errorf("file is too large (limit %d bytes)", maxSize)
+    }
+    if err := os.Rename(partPath, dest); err != nil {
+        return resp.StatusCode, resp.Header, fmt.Errorf("error moving download into place: %v", err)
+    }
+    return resp.StatusCode, resp.Header, nil
+}
+
+func downloadFile(url, dest string, maxSize int64, attempts int) error {
+    return defaultRetryPolicy.withAttempts(attempts).do("Download", func() error {
+        _, _, err := downloadOnce(url, dest, http.Header{}, maxSize)
+        return err
+    })
+}
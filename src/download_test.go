@@ -0,0 +1,139 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestMirrorSwitchDoesNotResume(t *testing.T) {
+    setupDeploy(t, "1")
+    broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Length", "4096")
+        w.Write([]byte("export default { fetch() { return 'from the broken mirror' } };\n"))
+        w.(http.Flusher).Flush()
+        panic(http.ErrAbortHandler)
+    }))
+    defer broken.Close()
+    good := "export default { fetch() { return new Response('ok'); } };\n"
+    var ranged atomic.Bool
+    mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Range") != "" {
+            ranged.Store(true)
+        }
+        w.Write([]byte(good))
+    }))
+    defer mirror.Close()
+
+    dest := filepath.Join(t.TempDir(), "worker.js")
+    used, _, err := downloadFromMirrors([]string{broken.URL, mirror.URL}, dest, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, _ := os.ReadFile(dest)
+    if used != mirror.URL || string(data) != good {
+        t.Errorf("downloaded %q from %s", data, used)
+    }
+    if ranged.Load() {
+        t.Error("the second mirror was asked to resume the first mirror's partial download")
+    }
+    leftovers, _ := filepath.Glob(dest + ".*.part")
+    if len(leftovers) != 0 {
+        t.Errorf("partial downloads left behind: %v", leftovers)
+    }
+}
+
+func TestDownloadResumesFromTheSameMirror(t *testing.T) {
+    setupDeploy(t, "1")
+    var requests atomic.Int32
+    var resumedAt string
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if requests.Add(1) == 1 {
+            w.Header().Set("Content-Length", strconv.Itoa(len(testWorker)))
+            w.Write([]byte(testWorker[:20]))
+            w.(http.Flusher).Flush()
+            panic(http.ErrAbortHandler)
+        }
+        resumedAt = r.Header.Get("Range")
+        w.Header().Set("Content-Range", fmt.Sprintf("bytes 20-%d/%d", len(testWorker)-1, len(testWorker)))
+        w.WriteHeader(http.StatusPartialContent)
+        w.Write([]byte(testWorker[20:]))
+    }))
+    defer server.Close()
+
+    dest := filepath.Join(t.TempDir(), "worker.js")
+    if _, _, err := downloadFromMirrors([]string{server.URL}, dest, sha256Hex(testWorker)); err != nil {
+        t.Fatal(err)
+    }
+    if resumedAt != "bytes=20-" {
+        t.Errorf("retry sent Range %q, want bytes=20-", resumedAt)
+    }
+}
+
+func TestProgressSpeedIgnoresResumedBytes(t *testing.T) {
+    progress := &progressWriter{total: 2000, written: 1000, resumed: 1000, start: time.Now().Add(-time.Second)}
+    output := captureStdout(t, progress.print)
+    if !strings.Contains(output, "  0 B/s") {
+        t.Errorf("resumed bytes counted toward the speed: %q", output)
+    }
+}
+
+func TestDownloadFromMirrorsOrder(t *testing.T) {
+    setupDeploy(t, "1")
+    behaviours := map[string]func(w http.ResponseWriter){
+        "good":     func(w http.ResponseWriter) { w.Write([]byte(testWorker)) },
+        "missing":  func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+        "tampered": func(w http.ResponseWriter) { w.Write([]byte("export default { evil: true };\n")) },
+        "html":     func(w http.ResponseWriter) { w.Write([]byte("<!DOCTYPE html><html>rate limited</html>")) },
+    }
+    tests := []struct {
+        name    string
+        mirrors []string
+        want    int
+    }{
+        {"first mirror works", []string{"good", "good"}, 0},
+        {"falls back after an HTTP error", []string{"missing", "good"}, 1},
+        {"falls back after a digest mismatch", []string{"tampered", "good"}, 1},
+        {"falls back after an HTML page", []string{"html", "good", "good"}, 1},
+        {"tries each mirror in turn", []string{"missing", "tampered", "good"}, 2},
+        {"all mirrors fail", []string{"missing", "tampered", "html"}, -1},
+    }
+    for _, tt := range tests {
+        var urls []string
+        hits := make([]atomic.Int32, len(tt.mirrors))
+        for i, behaviour := range tt.mirrors {
+            server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                hits[i].Add(1)
+                behaviours[behaviour](w)
+            }))
+            defer server.Close()
+            urls = append(urls, server.URL+"/worker.js")
+        }
+
+        dest := filepath.Join(t.TempDir(), "worker.js")
+        var used string
+        var err error
+        captureStdout(t, func() { used, _, err = downloadFromMirrors(urls, dest, sha256Hex(testWorker)) })
+        if tt.want < 0 {
+            if err == nil || !strings.Contains(err.Error(), "all download sources failed") {
+                t.Errorf("%s: got %v, want every mirror to fail", tt.name, err)
+            }
+            continue
+        }
+        if err != nil || used != urls[tt.want] {
+            t.Errorf("%s: used %q, %v, want mirror %d", tt.name, used, err, tt.want)
+        }
+        for i := range tt.mirrors {
+            if contacted := hits[i].Load() > 0; contacted != (i <= tt.want) {
+                t.Errorf("%s: mirror %d contacted = %v", tt.name, i, contacted)
+            }
+        }
+    }
+}
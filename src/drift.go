@@ -0,0 +1,519 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "net/url"
+    "os"
+    "slices"
+    "sort"
+    "strings"
+    "time"
+)
+
+const (
+    // secretMark stands for a secret whose value the API does not return.
+    secretMark = "(secret)"
+    // unknownMark is a field a source does not track; it is never a difference.
+    unknownMark = "?"
+)
+
+var credentialVars = []string{"UUID", "TR_PASS", "SUB_PATH"}
+
+// panelState flattens a panel's settings so the record, the generated
+// config and the live panel can be compared field by field. Variables are
+// stored as "var.NAME"; a missing key means the field is not set.
+type panelState map[string]string
+
+// livePanel is what Cloudflare reports for a deployed panel.
+type livePanel struct {
+    State      panelState
+    Version    string
+    DeployedAt time.Time
+}
+
+func recordedState(deployment *Deployment) panelState {
+    state := panelState{
+        "kv":                  deployment.KVID,
+        "compatibility_date":  deployment.CompatibilityDate,
+        "compatibility_flags": unknownMark,
+        "routes":              deployment.CustomDomain,
+        "var.PROXY_IP":        deployment.ProxyIP,
+        "var.FALLBACK":        deployment.Fallback,
+    }
+    if deployment.CompatibilityDate == "" {
+        state["compatibility_date"] = unknownMark
+    }
+    for name, value := range deployment.Vars {
+        state["var."+name] = value
+    }
+    for name, value := range panelSecrets(deployment) {
+        if deployment.SecretsMode {
+            value = secretMark
+        }
+        state["var."+name] = value
+    }
+    return state
+}
+
+func configState(deployment *Deployment) panelState {
+    config := wranglerConfig(deployment)
+    state := panelState{
+        "kv":                  config["kv_namespaces"].([]map[string]string)[0]["id"],
+        "compatibility_date":  config["compatibility_date"].(string),
+        "compatibility_flags": strings.Join(config["compatibility_flags"].([]string), ","),
+    }
+    if routes, ok := config["routes"].([]map[string]any); ok {
+        var patterns []string
+        for _, route := range routes {
+            patterns = append(patterns, fmt.Sprint(route["route"]))
+        }
+        state["routes"] = strings.Join(patterns, ",")
+    }
+    for name, value := range config["vars"].(map[string]string) {
+        state["var."+name] = value
+    }
+    if deployment.SecretsMode {
+        for name := range panelSecrets(deployment) {
+            state["var."+name] = secretMark
+        }
+    }
+    return state
+}
+
+func (c *cloudflareClient) liveWorker(name, customDomain string) (*livePanel, error) {
+    var settings struct {
+        Bindings           []scriptBinding `json:"bindings"`
+        CompatibilityDate  string          `json:"compatibility_date"`
+        CompatibilityFlags []string        `json:"compatibility_flags"`
+    }
+    if err := c.fetch(fmt.Sprintf("/accounts/%s/workers/scripts/%s/settings", c.accountID, url.PathEscape(name)), "Reading worker settings", &settings); err != nil {
+        return nil, err
+    }
+    live := &livePanel{State: panelState{
+        "compatibility_date":  settings.CompatibilityDate,
+        "compatibility_flags": strings.Join(settings.CompatibilityFlags, ","),
+    }}
+    for _, binding := range settings.Bindings {
+        switch binding.Type {
+        case "kv_namespace":
+            if binding.Name == "kv" {
+                live.State["kv"] = binding.NamespaceID
+            }
+        case "plain_text":
+            live.State["var."+binding.Name] = binding.Text
+        case "secret_text":
+            live.State["var."+binding.Name] = secretMark
+        }
+    }
+
+    var deployments struct {
+        Deployments []struct {
+            CreatedOn time.Time `json:"created_on"`
+            Versions  []struct {
+                VersionID string `json:"version_id"`
+            } `json:"versions"`
+        } `json:"deployments"`
+    }
+    if err := c.fetch(fmt.Sprintf("/accounts/%s/workers/scripts/%s/deployments", c.accountID, url.PathEscape(name)), "Reading worker deployments", &deployments); err == nil && len(deployments.Deployments) > 0 {
+        latest := deployments.Deployments[0]
+        live.DeployedAt = latest.CreatedOn
+        if len(latest.Versions) > 0 {
+            live.Version = latest.Versions[0].VersionID
+        }
+    }
+
+    // Routes live on zones, so only the zone of the recorded domain is checked.
+    live.State["routes"] = unknownMark
+    if customDomain != "" {
+        if routes, err := c.workerRoutes(name, customDomain); err == nil {
+            live.State["routes"] = strings.Join(routes, ",")
+        }
+    }
+    return live, nil
+}
+
+// workerRoutes returns the routes of script in the zone of domain.
+func (c *cloudflareClient) workerRoutes(script, domain string) ([]string, error) {
+    host := strings.TrimPrefix(strings.SplitN(domain, "/", 2)[0], "*.")
+    labels := strings.Split(host, ".")
+    for i := 0; i < len(labels)-1; i++ {
+        var zones []struct {
+            ID string `json:"id"`
+        }
+        if err := c.fetch("/zones?name="+url.QueryEscape(strings.Join(labels[i:], ".")), "Looking up zone", &zones); err != nil {
+            return nil, err
+        }
+        if len(zones) == 0 {
+            continue
+        }
+        var patterns []string
+        err := c.list(fmt.Sprintf("/zones/%s/workers/routes", zones[0].ID), "Listing worker routes", func(page json.RawMessage) error {
+            var routes []struct {
+                Pattern string `json:"pattern"`
+                Script  string `json:"script"`
+            }
+            if err := json.Unmarshal(page, &routes); err != nil {
+                return err
+            }
+            for _, route := range routes {
+                if route.Script == script {
+                    patterns = append(patterns, route.Pattern)
+                }
+            }
+            return nil
+        })
+        sort.Strings(patterns)
+        return patterns, err
+    }
+    return nil, fmt.Errorf("no zone found for %s", host)
+}
+
+func (c *cloudflareClient) livePages(name string) (*livePanel, error) {
+    var project struct {
+        Configs struct {
+            Production struct {
+                EnvVars map[string]struct {
+                    Type  string `json:"type"`
+                    Value string `json:"value"`
+                } `json:"env_vars"`
+                KVNamespaces map[string]struct {
+                    NamespaceID string `json:"namespace_id"`
+                } `json:"kv_namespaces"`
+                CompatibilityDate  string   `json:"compatibility_date"`
+                CompatibilityFlags []string `json:"compatibility_flags"`
+            } `json:"production"`
+        } `json:"deployment_configs"`
+        Domains          []string `json:"domains"`
+        LatestDeployment struct {
+            ID        string    `json:"id"`
+            CreatedOn time.Time `json:"created_on"`
+        } `json:"latest_deployment"`
+    }
+    if err := c.fetch(fmt.Sprintf("/accounts/%s/pages/projects/%s", c.accountID, url.PathEscape(name)), "Reading Pages project", &project); err != nil {
+        return nil, err
+    }
+    config := project.Configs.Production
+    live := &livePanel{
+        State: panelState{
+            "kv":                  config.KVNamespaces["kv"].NamespaceID,
+            "compatibility_date":  config.CompatibilityDate,
+            "compatibility_flags": strings.Join(config.CompatibilityFlags, ","),
+        },
+        Version:    project.LatestDeployment.ID,
+        DeployedAt: project.LatestDeployment.CreatedOn,
+    }
+    var routes []string
+    for _, domain := range project.Domains {
+        if domain != name+".pages.dev" {
+            routes = append(routes, domain)
+        }
+    }
+    live.State["routes"] = strings.Join(routes, ",")
+    for name, variable := range config.EnvVars {
+        value := variable.Value
+        if variable.Type == "secret_text" {
+            value = secretMark
+        }
+        live.State["var."+name] = value
+    }
+    return live, nil
+}
+
+func (c *cloudflareClient) livePanel(deployment *Deployment) (*livePanel, error) {
+    if deployment.DeployType == "2" {
+        return c.livePages(deployment.Name)
+    }
+    return c.liveWorker(deployment.Name, deployment.CustomDomain)
+}
+
+// driftRow is one field of a diff. Missing values are empty.
+type driftRow struct {
+    Field    string
+    Recorded string
+    Config   string
+    Live     string
+}
+
+// differs reports whether the sources that track the field disagree.
+func (r driftRow) differs() bool {
+    var values []string
+    for _, value := range []string{r.Recorded, r.Config, r.Live} {
+        if value != unknownMark && !slices.Contains(values, value) {
+            values = append(values, value)
+        }
+    }
+    return len(values) > 1
+}
+
+func diffPanel(recorded, config, live panelState) []driftRow {
+    fields := map[string]bool{}
+    for _, state := range []panelState{recorded, config, live} {
+        for field := range state {
+            fields[field] = true
+        }
+    }
+    var rows []driftRow
+    for field := range fields {
+        rows = append(rows, driftRow{Field: field, Recorded: recorded[field], Config: config[field], Live: live[field]})
+    }
+    sort.Slice(rows, func(i, j int) bool {
+        // Settings first, then variables.
+        iVar, jVar := strings.HasPrefix(rows[i].Field, "var."), strings.HasPrefix(rows[j].Field, "var.")
+        if iVar != jVar {
+            return jVar
+        }
+        return rows[i].Field < rows[j].Field
+    })
+    return rows
+}
+
+func driftValue(value string) string {
+    switch value {
+    case "":
+        return "-"
+    case secretMark, unknownMark:
+        return value
+    }
+    value = redact(value)
+    if len(value) > 28 {
+        value = value[:25] + "..."
+    }
+    return value
+}
+
+func printDiff(rows []driftRow, all bool) int {
+    differing := 0
+    fmt.Printf("\n  %-22s %-28s %-28s %s\n", "FIELD", "RECORDED", "CONFIG", "LIVE")
+    for _, row := range rows {
+        differs := row.differs()
+        if differs {
+            differing++
+        } else if !all {
+            continue
+        }
+        color := ""
+        if differs {
+            color = bold + yellow
+        }
+        fmt.Printf("  %s%-22s%s %-28s %-28s %s\n", color, row.Field, reset, driftValue(row.Recorded), driftValue(row.Config), driftValue(row.Live))
+    }
+    return differing
+}
+
+// adoptLive copies the live values into the record and returns the
+// fields it changed. Secrets keep their recorded values because the API
+// does not return them.
+func adoptLive(deployment *Deployment, live panelState) []string {
+    var changed []string
+    set := func(field string, target *string) {
+        value, ok := live[field]
+        if !ok || value == unknownMark || value == secretMark || value == *target {
+            return
+        }
+        *target = value
+        changed = append(changed, field)
+    }
+    set("kv", &deployment.KVID)
+    set("compatibility_date", &deployment.CompatibilityDate)
+    if routes, ok := live["routes"]; ok && routes != unknownMark {
+        route, _, _ := strings.Cut(routes, ",")
+        if route != deployment.CustomDomain {
+            deployment.CustomDomain = route
+            changed = append(changed, "routes")
+        }
+    }
+    set("var.PROXY_IP", &deployment.ProxyIP)
+    set("var.FALLBACK", &deployment.Fallback)
+    set("var.UUID", &deployment.UUID)
+    set("var.TR_PASS", &deployment.TrPass)
+    set("var.SUB_PATH", &deployment.SubPath)
+    if deployment.SecretsMode && live["var.UUID"] != secretMark && live["var.UUID"] != "" {
+        deployment.SecretsMode = false
+        changed = append(changed, "secrets_mode")
+    }
+
+    vars := map[string]string{}
+    for field, value := range live {
+        name, isVar := strings.CutPrefix(field, "var.")
+        if !isVar || name == "PROXY_IP" || name == "FALLBACK" || slices.Contains(credentialVars, name) || value == secretMark {
+            continue
+        }
+        vars[name] = value
+        if deployment.Vars[name] != value {
+            changed = append(changed, field)
+        }
+    }
+    for name, value := range deployment.Vars {
+        if _, ok := vars[name]; !ok {
+            if live["var."+name] == secretMark {
+                vars[name] = value
+                continue
+            }
+            changed = append(changed, "var."+name)
+        }
+    }
+    deployment.Vars = vars
+    if len(vars) == 0 {
+        deployment.Vars = nil
+    }
+    sort.Strings(changed)
+    return changed
+}
+
+// openPanel reads the record of name and its live state.
+func openPanel(installDir, name string) (*Deployment, *livePanel, bool) {
+    deployment, err := findDeployment(installDir, name)
+    if err != nil {
+        failMessage("Unknown panel", err)
+        return nil, nil, false
+    }
+    api, err := newWranglerBackend(installDir).cloudflare()
+    if err != nil {
+        failMessage("Could not use the Cloudflare API. Log in with a deployment first or set CLOUDFLARE_API_TOKEN", err)
+        return nil, nil, false
+    }
+    if deployment.AccountID != "" && deployment.AccountID != api.accountID {
+        failMessage(fmt.Sprintf("%s belongs to account %s, but the API is using %s. Set CLOUDFLARE_ACCOUNT_ID to switch.", name, shortAccount(deployment.AccountID), shortAccount(api.accountID)), nil)
+        return nil, nil, false
+    }
+    live, err := api.livePanel(deployment)
+    if err != nil {
+        failMessage("Could not read the live panel", err)
+        return nil, nil, false
+    }
+    return deployment, live, true
+}
+
+func runStatus(installDir string, args []string) {
+    fs := flag.NewFlagSet("status", flag.ExitOnError)
+    addNetworkFlags(fs)
+    fs.Parse(args)
+    if fs.NArg() != 1 {
+        failMessage("Usage: status <name>", nil)
+        return
+    }
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    deployment, live, ok := openPanel(installDir, fs.Arg(0))
+    if !ok {
+        os.Exit(1)
+    }
+
+    fmt.Printf("\n%s %s%s%s\n", titlePrefix, bold+cyan, deployment.Name, reset)
+    fmt.Printf("   Type:      %s\n", map[string]string{"1": "Workers", "2": "Pages"}[deployment.DeployType])
+    fmt.Printf("   URL:       %s%s%s\n", blue, deployment.PanelURL, reset)
+    fmt.Printf("   Account:   %s\n", shortAccount(deployment.AccountID))
+    if len(deployment.Tags) > 0 {
+        fmt.Printf("   Tags:      %s\n", strings.Join(deployment.Tags, ", "))
+    }
+    fmt.Printf("   Recorded:  worker %s from %s, updated %s\n", deployment.WorkerVersion, deployment.WorkerSource, deployment.UpdatedAt.Local().Format("2006-01-02 15:04"))
+    if live.Version != "" {
+        fmt.Printf("   Live:      version %s, deployed %s\n", live.Version, live.DeployedAt.Local().Format("2006-01-02 15:04"))
+    }
+    if !live.DeployedAt.IsZero() && live.DeployedAt.After(deployment.UpdatedAt.Add(time.Minute)) {
+        fmt.Printf("%s The live panel was deployed after the record was last updated.\n", warnPrefix)
+    }
+
+    health := checkPanelHealth(*deployment)
+    color := green
+    if !health.ok() {
+        color = red
+    }
+    fmt.Printf("   Health:    %s%s%s (%s)\n", bold+color, health.Status, reset, health.Detail)
+
+    differing := 0
+    for _, row := range diffPanel(recordedState(deployment), configState(deployment), live.State) {
+        if row.differs() {
+            differing++
+        }
+    }
+    if differing == 0 {
+        successMessage("The live panel matches the record.")
+        return
+    }
+    fmt.Printf("%s %d field(s) differ from the record. Run %sdiff %s%s to see them.\n", warnPrefix, differing, cyan, deployment.Name, reset)
+}
+
+func runDiff(installDir string, args []string) {
+    fs := flag.NewFlagSet("diff", flag.ExitOnError)
+    all := fs.Bool("all", false, "Show every field, not only the ones that differ")
+    adopt := fs.Bool("adopt", false, "Update the record with the live values")
+    reapply := fs.Bool("reapply", false, "Redeploy the panel from the record")
+    yes := fs.Bool("yes", false, "Do not ask for confirmation")
+    addWorkerFlags(fs)
+    addNetworkFlags(fs)
+    fs.Parse(args)
+    if fs.NArg() != 1 {
+        failMessage("Usage: diff [-all] [-adopt | -reapply [-worker-version ... | -worker-file ... | -worker-url ...]] [-yes] <name>", nil)
+        return
+    }
+    if *adopt && *reapply {
+        failMessage("Use either -adopt or -reapply, not both.", nil)
+        return
+    }
+    workerFlags := workerFlagsSet(fs)
+    if workerFlags && !*reapply {
+        failMessage("Worker flags only apply to -reapply.", nil)
+        return
+    }
+    if err := checkWorkerFlags(); err != nil {
+        failMessage(err.Error(), nil)
+        return
+    }
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    deployment, live, ok := openPanel(installDir, fs.Arg(0))
+    if !ok {
+        os.Exit(1)
+    }
+
+    differing := printDiff(diffPanel(recordedState(deployment), configState(deployment), live.State), *all)
+    if differing == 0 {
+        successMessage("The live panel matches the record.")
+        return
+    }
+    fmt.Printf("\n%s %d field(s) differ. CONFIG is what a redeploy from the record would upload.\n", infoPrefix, differing)
+
+    switch {
+    case *adopt:
+        updated := *deployment
+        changed := adoptLive(&updated, live.State)
+        if len(changed) == 0 {
+            fmt.Printf("%s The live panel has nothing the record can take over; secrets cannot be read back.\n", infoPrefix)
+            return
+        }
+        if !confirmFleet(fmt.Sprintf("Update %s in the record with the live values?", strings.Join(changed, ", ")), *yes) {
+            return
+        }
+        if err := recordDeployment(installDir, updated); err != nil {
+            failMessage("Could not save the deployment record", err)
+            return
+        }
+        successMessage("Record updated from the live panel.")
+    case *reapply:
+        if !confirmFleet(fmt.Sprintf("Redeploy %s from the record, replacing the live settings?", deployment.Name), *yes) {
+            return
+        }
+        if err := startRunLog(installDir, os.Args); err != nil {
+            fmt.Printf("%s Warning: Could not start the run log: %v\n", warnPrefix, err)
+        }
+        defer finishRunLog()
+        if !prepareDependencies(installDir) {
+            return
+        }
+        backend := newWranglerBackend(installDir)
+        if err := loginCloudflare(backend); err != nil {
+            return
+        }
+        results := redeployFleet(installDir, backend, []Deployment{*deployment}, "reapply", !workerFlags, 1, func(*Deployment) {})
+        printFleetReport(results)
+    default:
+        fmt.Printf("%s Run with -adopt to take over the live values or -reapply to redeploy the recorded ones.\n", infoPrefix)
+    }
+}
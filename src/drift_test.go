@@ -0,0 +1,121 @@
+package main
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "testing"
+)
+
+func driftDeployment() *Deployment {
+    return &Deployment{
+        Name:              "panel-one",
+        DeployType:        "1",
+        KVID:              "kv1",
+        UUID:              "6f1c1f0e-3b1a-4d55-9d1e-2a8f0b1c3d4e",
+        TrPass:            "trojan-pass",
+        SubPath:           "sub-path",
+        ProxyIP:           "1.2.3.4",
+        Fallback:          "speed.cloudflare.com",
+        CompatibilityDate: "2026-01-01",
+        Vars:              map[string]string{"REGION": "eu"},
+    }
+}
+
+func TestDiffPanel(t *testing.T) {
+    deployment := driftDeployment()
+    live := recordedState(deployment)
+    live["compatibility_flags"] = "nodejs_compat"
+    live["routes"] = unknownMark
+    live["var.PROXY_IP"] = "5.6.7.8"
+    live["var.DEBUG"] = "1"
+    delete(live, "var.REGION")
+
+    var differing []string
+    for _, row := range diffPanel(recordedState(deployment), configState(deployment), live) {
+        if row.differs() {
+            differing = append(differing, row.Field)
+        }
+    }
+    if !slices.Equal(differing, []string{"var.DEBUG", "var.PROXY_IP", "var.REGION"}) {
+        t.Errorf("differing fields: %v", differing)
+    }
+
+    deployment.SecretsMode = true
+    live = recordedState(deployment)
+    live["compatibility_flags"] = "nodejs_compat"
+    for _, row := range diffPanel(recordedState(deployment), configState(deployment), live) {
+        if row.differs() {
+            t.Errorf("secrets mode: %s differs: %+v", row.Field, row)
+        }
+    }
+}
+
+func TestAdoptLive(t *testing.T) {
+    deployment := driftDeployment()
+    live := recordedState(deployment)
+    live["var.FALLBACK"] = "www.example.org"
+    live["var.DEBUG"] = "1"
+    live["var.TR_PASS"] = secretMark
+    delete(live, "var.REGION")
+
+    changed := adoptLive(deployment, live)
+    if !slices.Equal(changed, []string{"var.DEBUG", "var.FALLBACK", "var.REGION"}) {
+        t.Errorf("changed %v", changed)
+    }
+    if deployment.Fallback != "www.example.org" || deployment.Vars["DEBUG"] != "1" || deployment.Vars["REGION"] != "" {
+        t.Errorf("record after adopting: %+v", deployment)
+    }
+    if deployment.TrPass != "trojan-pass" {
+        t.Error("a secret was overwritten with a placeholder")
+    }
+}
+
+func TestLiveWorker(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        switch r.URL.Path {
+        case "/accounts/acc/workers/scripts/panel-one/settings":
+            io.WriteString(w, `{"success":true,"errors":[],"result":{"compatibility_date":"2026-01-01","compatibility_flags":["nodejs_compat"],"bindings":[{"name":"kv","type":"kv_namespace","namespace_id":"kv1"},{"name":"PROXY_IP","type":"plain_text","text":"1.2.3.4"},{"name":"UUID","type":"secret_text"}]}}`)
+        case "/accounts/acc/workers/scripts/panel-one/deployments":
+            io.WriteString(w, `{"success":true,"errors":[],"result":{"deployments":[{"created_on":"2026-02-01T10:00:00Z","versions":[{"version_id":"v-123"}]}]}}`)
+        case "/zones":
+            if r.URL.Query().Get("name") == "example.com" {
+                io.WriteString(w, `{"success":true,"errors":[],"result":[{"id":"zone1"}]}`)
+                return
+            }
+            io.WriteString(w, `{"success":true,"errors":[],"result":[]}`)
+        case "/zones/zone1/workers/routes":
+            io.WriteString(w, `{"success":true,"errors":[],"result":[{"pattern":"panel.example.com","script":"panel-one"},{"pattern":"blog.example.com/*","script":"blog"}]}`)
+        default:
+            writeNotFound(w, r.URL.Path)
+        }
+    }))
+    defer server.Close()
+    savedAPI := cloudflareAPI
+    cloudflareAPI = server.URL
+    defer func() { cloudflareAPI = savedAPI }()
+
+    api := &cloudflareClient{token: "test-token", accountID: "acc"}
+    live, err := api.liveWorker("panel-one", "panel.example.com")
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := panelState{
+        "kv":                  "kv1",
+        "compatibility_date":  "2026-01-01",
+        "compatibility_flags": "nodejs_compat",
+        "routes":              "panel.example.com",
+        "var.PROXY_IP":        "1.2.3.4",
+        "var.UUID":            secretMark,
+    }
+    for field, value := range want {
+        if live.State[field] != value {
+            t.Errorf("%s = %q, want %q", field, live.State[field], value)
+        }
+    }
+    if live.Version != "v-123" || live.DeployedAt.IsZero() {
+        t.Errorf("version %q deployed %v", live.Version, live.DeployedAt)
+    }
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+type fakeResult struct {
+    output string
+    err    error
+}
+
+func ok(output string) fakeResult {
+    return fakeResult{output: output}
+}
+
+func fail(output string) fakeResult {
+    return fakeResult{output: output, err: errors.New("exit status 1")}
+}
+
+type fakeRule struct {
+    match   string
+    results []fakeResult
+}
+
+// fakeRunner records every command and answers with scripted results.
+// Each rule replays its results in order and then repeats the last one.
+type fakeRunner struct {
+    mu      sync.Mutex
+    rules   []*fakeRule
+    calls   []string
+    inspect func(command string)
+}
+
+func (r *fakeRunner) on(match string, results ...fakeResult) {
+    r.rules = append(r.rules, &fakeRule{match: match, results: results})
+}
+
+func (r *fakeRunner) next(command string) fakeResult {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.calls = append(r.calls, command)
+    if r.inspect != nil {
+        r.inspect(command)
+    }
+    for _, rule := range r.rules {
+        if !strings.Contains(command, rule.match) {
+            continue
+        }
+        result := rule.results[0]
+        if len(rule.results) > 1 {
+            rule.results = rule.results[1:]
+        }
+        return result
+    }
+    return fakeResult{}
+}
+
+func (r *fakeRunner) Run(dir, command string) (string, error) {
+    result := r.next(command)
+    return result.output, result.err
+}
+
+func (r *fakeRunner) Start(dir, command string, stdout io.Writer) (Process, error) {
+    result := r.next(command)
+    io.WriteString(stdout, result.output)
+    return fakeProcess{err: result.err}, nil
+}
+
+func (r *fakeRunner) count(match string) int {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    n := 0
+    for _, call := range r.calls {
+        if strings.Contains(call, match) {
+            n++
+        }
+    }
+    return n
+}
+
+type fakeProcess struct {
+    err error
+}
+
+func (p fakeProcess) Wait() error {
+    return p.err
+}
+
+// memoryBackend is an in-memory Cloudflare account.
+type memoryBackend struct {
+    mu             sync.Mutex
+    loginFailures  int
+    takenChecks    int
+    unknownChecks  int
+    kvFailures     int
+    deployFailures int
+    logins         int
+    nameChecks     []string
+    namespaces     map[string]string
+    deployed       map[string]string
+    secrets        map[string]map[string]string
+}
+
+func newMemoryBackend() *memoryBackend {
+    return &memoryBackend{namespaces: map[string]string{}, deployed: map[string]string{}, secrets: map[string]map[string]string{}}
+}
+
+func (b *memoryBackend) Login() error {
+    b.logins++
+    if b.loginFailures > 0 {
+        b.loginFailures--
+        return errors.New("login cancelled")
+    }
+    return nil
+}
+
+func (b *memoryBackend) NameStatus(name, deployType string) (nameStatus, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.nameChecks = append(b.nameChecks, name)
+    if b.unknownChecks > 0 {
+        b.unknownChecks--
+        return nameUnknown, errors.New("Cloudflare API returned HTTP 503")
+    }
+    if b.takenChecks > 0 {
+        b.takenChecks--
+        return nameExists, nil
+    }
+    if _, taken := b.deployed[name]; taken {
+        return nameExists, nil
+    }
+    return nameFree, nil
+}
+
+func (b *memoryBackend) AccountID() (string, error) {
+    return "memory-account", nil
+}
+
+func (b *memoryBackend) CreateKV(title string) (string, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.kvFailures > 0 {
+        b.kvFailures--
+        return "", errors.New("fetch failed")
+    }
+    id := fmt.Sprintf("kv%030d", len(b.namespaces)+1)
+    b.namespaces[title] = id
+    return id, nil
+}
+
+func (b *memoryBackend) Deploy(dir, name, deployType string, secrets map[string]string) (string, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.deployFailures > 0 {
+        b.deployFailures--
+        return "", errors.New("deploy failed")
+    }
+    url := "https://" + name + ".example.workers.dev"
+    if deployType == "2" {
+        url = "https://" + name + ".pages.dev"
+    }
+    b.deployed[name] = url
+    if len(secrets) > 0 {
+        b.secrets[name] = secrets
+    }
+    return url, nil
+}
+
+// fakeCloudflare serves the Cloudflare API lookups used for name checks.
+type fakeCloudflare struct {
+    mu       sync.Mutex
+    taken    int
+    status   int
+    requests []string
+}
+
+func newFakeCloudflare(t *testing.T) *fakeCloudflare {
+    t.Helper()
+    api := &fakeCloudflare{}
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        api.mu.Lock()
+        defer api.mu.Unlock()
+        api.requests = append(api.requests, r.URL.Path)
+        w.Header().Set("Content-Type", "application/json")
+        if r.Header.Get("Authorization") != "Bearer test-token" {
+            w.WriteHeader(http.StatusUnauthorized)
+            io.WriteString(w, `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`)
+            return
+        }
+        switch {
+        case api.status != 0:
+            w.WriteHeader(api.status)
+            io.WriteString(w, `{"success":false,"errors":[{"code":10013,"message":"simulated failure"}]}`)
+        case r.URL.Path == "/accounts":
+            io.WriteString(w, `{"success":true,"errors":[],"result":[{"id":"test-account","name":"Test"}]}`)
+        case api.taken > 0:
+            api.taken--
+            io.WriteString(w, `{"success":true,"errors":[],"result":{}}`)
+        default:
+            writeNotFound(w, r.URL.Path)
+        }
+    }))
+    savedAPI := cloudflareAPI
+    cloudflareAPI = server.URL
+    t.Cleanup(func() {
+        cloudflareAPI = savedAPI
+        server.Close()
+    })
+    t.Setenv("CLOUDFLARE_API_TOKEN", "test-token")
+    t.Setenv("CLOUDFLARE_ACCOUNT_ID", "test-account")
+    return api
+}
+
+// writeNotFound answers the way Cloudflare does for a missing worker
+// script or Pages project.
+func writeNotFound(w http.ResponseWriter, path string) {
+    w.WriteHeader(http.StatusNotFound)
+    if strings.Contains(path, "/pages/projects/") {
+        io.WriteString(w, `{"success":false,"errors":[{"code":8000007,"message":"Project not found."}]}`)
+        return
+    }
+    io.WriteString(w, `{"success":false,"errors":[{"code":10007,"message":"This Worker does not exist on your account."}]}`)
+}
+
+func (api *fakeCloudflare) count(match string) int {
+    api.mu.Lock()
+    defer api.mu.Unlock()
+    n := 0
+    for _, path := range api.requests {
+        if strings.Contains(path, match) {
+            n++
+        }
+    }
+    return n
+}
+
+// setupDeploy points the global deploy settings at a temporary install
+// directory and a local worker file so no test touches the network.
+func setupDeploy(t *testing.T, kind string) string {
+    t.Helper()
+    worker := filepath.Join(t.TempDir(), "worker.js")
+    if err := os.WriteFile(worker, []byte("export default { fetch() { return new Response('ok'); } };\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    savedType, savedFile, savedVersion, savedSHA := deployType, workerFile, workerVersion, workerSHA256
+    savedDomain, savedSleep, savedSecrets, savedShow := customDomain, sleep, secretsMode, showSecrets
+    savedTimeout, savedPoll := loginURLTimeout, loginPollInterval
+    savedNaming := [3]string{namePrefix, nameStyle, nameTemplate}
+    t.Cleanup(func() {
+        namePrefix, nameStyle, nameTemplate = savedNaming[0], savedNaming[1], savedNaming[2]
+        panelSettings, profileName, workerURLs = defaultPanelOptions(), "", nil
+        deployType, workerFile, workerVersion, workerSHA256 = savedType, savedFile, savedVersion, savedSHA
+        customDomain, sleep, secretsMode, showSecrets = savedDomain, savedSleep, savedSecrets, savedShow
+        loginURLTimeout, loginPollInterval = savedTimeout, savedPoll
+        secretValues = nil
+    })
+
+    deployType = kind
+    workerFile = worker
+    workerVersion = workerLatestTag
+    workerSHA256 = ""
+    customDomain = ""
+    secretsMode = false
+    showSecrets = false
+    secretValues = nil
+    panelSettings, profileName = defaultPanelOptions(), ""
+    sleep = func(time.Duration) {}
+    vaultKey, vaultKeySalt = nil, nil
+    vaultScryptN = 1 << 10
+    t.Setenv(vaultPassphraseEnv, "test passphrase")
+    t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+    loginURLTimeout = 2 * time.Second
+    loginPollInterval = time.Millisecond
+    return t.TempDir()
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+    "golang.org/x/term"
+)
+
+// deployTags are added to every panel deployed in this run.
+var deployTags stringList
+
+const fleetUsage = "Usage: fleet list|health|update-worker|rotate|set|tag [flags] <selector>...\n   Selectors: all, tag:<tag>, account:<id>, type:workers|pages or a panel name"
+
+// fleetSelector picks recorded panels. Terms of the same kind are
+// alternatives; terms of different kinds must all match.
+type fleetSelector map[string][]string
+
+func parseSelector(args []string) (fleetSelector, error) {
+    if len(args) == 0 {
+        return nil, errors.New("choose panels with all, tag:<tag>, account:<id>, type:workers|pages or a panel name")
+    }
+    selector := fleetSelector{}
+    for _, arg := range args {
+        kind, value, found := strings.Cut(arg, ":")
+        switch {
+        case arg == "all":
+            continue
+        case !found:
+            kind, value = "name", arg
+        case kind == "type":
+            switch value {
+            case "workers", "1":
+                value = "1"
+            case "pages", "2":
+                value = "2"
+            default:
+                return nil, fmt.Errorf("type must be workers or pages, not %q", value)
+            }
+        case kind != "tag" && kind != "account":
+            return nil, fmt.Errorf("unknown selector %q", arg)
+        }
+        if value == "" {
+            return nil, fmt.Errorf("selector %q has no value", arg)
+        }
+        selector[kind] = append(selector[kind], value)
+    }
+    return selector, nil
+}
+
+func (s fleetSelector) matches(deployment Deployment) bool {
+    for kind, values := range s {
+        if !slices.ContainsFunc(values, func(value string) bool {
+            switch kind {
+            case "tag":
+                return slices.Contains(deployment.Tags, value)
+            case "account":
+                // Account IDs are long; a prefix as shown by fleet list is enough.
+                return deployment.AccountID != "" && strings.HasPrefix(deployment.AccountID, value)
+            case "type":
+                return deployment.DeployType == value
+            default:
+                return deployment.Name == value
+            }
+        }) {
+            return false
+        }
+    }
+    return true
+}
+
+// mergeTags returns base with add appended and remove dropped, in order
+// and without duplicates.
+func mergeTags(base, add, remove []string) []string {
+    var tags []string
+    for _, tag := range append(append([]string(nil), base...), add...) {
+        if !slices.Contains(tags, tag) && !slices.Contains(remove, tag) {
+            tags = append(tags, tag)
+        }
+    }
+    return tags
+}
+
+// fleetResult is one row of a fleet report.
+type fleetResult struct {
+    Name    string  `json:"name"`
+    Action  string  `json:"action"`
+    Status  string  `json:"status"`
+    Detail  string  `json:"detail,omitempty"`
+    Seconds float64 `json:"seconds"`
+}
+
+func (r fleetResult) ok() bool {
+    return r.Status == "updated" || r.Status == "healthy" || r.Status == "tagged" || r.Status == "deleted"
+}
+
+func shortAccount(id string) string {
+    if id == "" {
+        return "-"
+    }
+    return id[:min(len(id), 8)]
+}
+
+func printFleet(deployments []Deployment) {
+    fmt.Printf("\n  %-34s %-8s %-9s %-10s %s\n", "NAME", "TYPE", "ACCOUNT", "WORKER", "TAGS")
+    for _, deployment := range deployments {
+        tags := strings.Join(deployment.Tags, ",")
+        if tags == "" {
+            tags = "-"
+        }
+        fmt.Printf("  %s%-34s%s %-8s %-9s %-10s %s\n", cyan, deployment.Name, reset, map[string]string{"1": "workers", "2": "pages"}[deployment.DeployType], shortAccount(deployment.AccountID), deployment.WorkerVersion, tags)
+    }
+}
+
+// confirmFleet asks before changing live panels. Without a terminal the
+// user has to pass -yes.
+func confirmFleet(question string, yes bool) bool {
+    if yes {
+        return true
+    }
+    if !term.IsTerminal(int(os.Stdin.Fd())) {
+        failMessage("Refusing to change panels without confirmation. Rerun with -yes.", nil)
+        return false
+    }
+    fmt.Printf("\n%s %s [y/N]: ", warnPrefix, question)
+    answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+    answer = strings.ToLower(strings.TrimSpace(answer))
+    return answer == "y" || answer == "yes"
+}
+
+func checkPanelHealth(deployment Deployment) fleetResult {
+    result := fleetResult{Name: deployment.Name, Action: "health"}
+    start := time.Now()
+    resp, err := newHTTPClient(apiTimeout).Get(deployment.PanelURL)
+    result.Seconds = time.Since(start).Seconds()
+    if err != nil {
+        logRequest(http.MethodGet, deployment.PanelURL, 0, start, err)
+        result.Status, result.Detail = "unreachable", redact(err.Error())
+        return result
+    }
+    resp.Body.Close()
+    logRequest(http.MethodGet, deployment.PanelURL, resp.StatusCode, start, nil)
+    result.Status = "healthy"
+    if resp.StatusCode >= 400 {
+        result.Status = "unhealthy"
+    }
+    result.Detail = fmt.Sprintf("HTTP %d in %dms", resp.StatusCode, time.Since(start).Milliseconds())
+    return result
+}
+
+func checkFleetHealth(deployments []Deployment, concurrency int) []fleetResult {
+    results := make([]fleetResult, len(deployments))
+    runLimited(len(deployments), concurrency, func(i int) {
+        if deployments[i].PanelURL == "" {
+            results[i] = fleetResult{Name: deployments[i].Name, Action: "health", Status: "skipped", Detail: "no panel URL recorded"}
+            return
+        }
+        results[i] = checkPanelHealth(deployments[i])
+    })
+    return results
+}
+
+// redeployFleet applies change to each panel and deploys it again with
+// its KV namespace. With keepWorker each panel keeps the release it was
+// deployed with; otherwise the worker chosen by the worker flags is used.
+// Workers are prepared one panel at a time and deployed concurrently.
+func redeployFleet(installDir string, backend Backend, deployments []Deployment, action string, keepWorker bool, concurrency int, change func(*Deployment)) []fleetResult {
+    accountID, err := backend.AccountID()
+    if err != nil {
+        fmt.Printf("%s Warning: Could not look up the logged-in account, panels of other accounts may fail: %v\n", warnPrefix, err)
+    }
+
+    base := captureSettings()
+    defer base.restore()
+
+    fleetDir := filepath.Join(installDir, "fleet")
+    if err := os.RemoveAll(fleetDir); err != nil {
+        fmt.Printf("%s Warning: Could not clear %s: %v\n", warnPrefix, fleetDir, err)
+    }
+
+    logStep("prepare-worker")
+    results := make([]fleetResult, len(deployments))
+    updated := make([]*Deployment, len(deployments))
+    for i, deployment := range deployments {
+        results[i] = fleetResult{Name: deployment.Name, Action: action, Status: "failed"}
+        switch {
+        case deployment.AccountID != "" && accountID != "" && deployment.AccountID != accountID:
+            results[i].Status = "skipped"
+            results[i].Detail = fmt.Sprintf("belongs to account %s, logged in to %s", shortAccount(deployment.AccountID), shortAccount(accountID))
+            continue
+        case deployment.KVID == "":
+            results[i].Detail = "the record has no KV namespace"
+            continue
+        }
+
+        base.restore()
+        if keepWorker {
+            if deployment.WorkerVersion == unknownWorkerVersion {
+                results[i].Detail = "imported without a known worker release, choose the worker with -worker-version, -worker-file or -worker-url"
+                continue
+            }
+            if !isValidReleaseTag(deployment.WorkerVersion) {
+                results[i].Detail = fmt.Sprintf("deployed from %s, choose the worker with -worker-version, -worker-file or -worker-url", deployment.WorkerSource)
+                continue
+            }
+            workerVersion, workerSHA256, workerFile, workerURLs = deployment.WorkerVersion, deployment.WorkerSHA256, "", nil
+        }
+
+        fmt.Printf("\n%s Preparing %s%s%s...\n", titlePrefix, cyan, deployment.Name, reset)
+        dir := filepath.Join(fleetDir, deployment.Name)
+        srcPath := filepath.Join(dir, "src")
+        if err := os.MkdirAll(srcPath, 0700); err != nil {
+            results[i].Detail = redact(err.Error())
+            continue
+        }
+        workerPath := filepath.Join(srcPath, "worker.js")
+        if deployment.DeployType == "2" {
+            workerPath = filepath.Join(srcPath, "_worker.js")
+        }
+        script, err := prepareWorkerScript(installDir, workerPath)
+        if err != nil {
+            results[i].Detail = "worker.js: " + redact(err.Error())
+            continue
+        }
+
+        next := deployment
+        next.WorkerVersion, next.WorkerSHA256, next.WorkerSource = script.Tag, script.SHA256, script.Source
+        if next.AccountID == "" {
+            next.AccountID = accountID
+        }
+        change(&next)
+        if next.UUID == "" || next.TrPass == "" || next.SubPath == "" {
+            // Imported panels may keep credentials as unreadable secrets;
+            // redeploying would replace them with empty values.
+            results[i].Detail = "the record has no credentials, import it again with -uuid, -trojan-password and -sub-path or run fleet rotate"
+            continue
+        }
+        updated[i] = &next
+    }
+    base.restore()
+
+    logStep("deploy")
+    fmt.Printf("\n%s Redeploying panels, %d at a time...\n", titlePrefix, min(max(concurrency, 1), maxBatchConcurrency))
+    runLimited(len(updated), concurrency, func(i int) {
+        deployment := updated[i]
+        if deployment == nil {
+            return
+        }
+        start := time.Now()
+        err := executePanel(filepath.Join(fleetDir, deployment.Name), deployment, backend, deployment.Name)
+        results[i].Seconds = time.Since(start).Seconds()
+        if err != nil {
+            results[i].Detail = redact(err.Error())
+            return
+        }
+        panelf(deployment.Name, successPrefix, "Panel updated successfully!")
+        results[i].Status = "updated"
+        results[i].Detail = "worker " + deployment.WorkerVersion
+        if err := recordDeployment(installDir, *deployment); err != nil {
+            panelf(deployment.Name, warnPrefix, "Warning: Could not save deployment record: %v", err)
+        }
+    })
+
+    if err := tightenPermissions(installDir); err != nil {
+        fmt.Printf("%s Warning: Could not restrict permissions in %s: %v\n", warnPrefix, installDir, err)
+    }
+    return results
+}
+
+// tagFleet changes the tags of the selected records; nothing is deployed.
+func tagFleet(installDir string, selected []Deployment, add, remove []string) ([]fleetResult, error) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+    deployments, err := loadDeployments(installDir)
+    if err != nil {
+        return nil, err
+    }
+    var results []fleetResult
+    for i := range deployments {
+        if !slices.ContainsFunc(selected, func(d Deployment) bool { return d.Name == deployments[i].Name }) {
+            continue
+        }
+        deployments[i].Tags = mergeTags(deployments[i].Tags, add, remove)
+        deployments[i].UpdatedAt = time.Now().UTC()
+        results = append(results, fleetResult{Name: deployments[i].Name, Action: "tag", Status: "tagged", Detail: strings.Join(deployments[i].Tags, ",")})
+    }
+    return results, saveDeployments(installDir, deployments)
+}
+
+func printFleetReport(results []fleetResult) int {
+    failed := 0
+    fmt.Printf("\n  %-34s %-14s %-11s %s\n", "NAME", "ACTION", "STATUS", "DETAIL")
+    for _, result := range results {
+        color := green
+        if !result.ok() {
+            color = red
+            failed++
+        }
+        fmt.Printf("  %-34s %-14s %s%-11s%s %s\n", result.Name, result.Action, bold+color, result.Status, reset, result.Detail)
+    }
+    if failed == 0 {
+        successMessage(fmt.Sprintf("All %d panels done.", len(results)))
+    } else {
+        fmt.Printf("\n%s %d of %d panels done, %d failed or skipped.\n", warnPrefix, len(results)-failed, len(results), failed)
+    }
+    return failed
+}
+
+func writeFleetReport(path string, results []fleetResult) error {
+    data, err := json.MarshalIndent(results, "", "  ")
+    if err != nil {
+        return fmt.Errorf("error encoding report: %v", err)
+    }
+    if err := os.WriteFile(path, data, 0600); err != nil {
+        return fmt.Errorf("error writing report: %v", err)
+    }
+    return nil
+}
+
+// addWorkerFlags adds the flags that choose the worker.js a redeploy
+// uploads. Without any of them the recorded release is kept.
+func addWorkerFlags(fs *flag.FlagSet) {
+    fs.StringVar(&workerVersion, "worker-version", workerLatestTag, "BPB-Worker-Panel release tag to deploy")
+    fs.StringVar(&workerSHA256, "worker-sha256", "", "Expected SHA-256 digest of worker.js")
+    fs.StringVar(&workerFile, "worker-file", "", "Deploy a local worker.js/_worker.js file")
+    fs.Var(&workerURLs, "worker-url", "Download worker.js from this URL; repeat or comma-separate to try several in order")
+    fs.BoolVar(&offlineMode, "offline", false, "Use only the local worker cache")
+    fs.BoolVar(&allowNoDigest, "allow-unverified", false, "Deploy the latest or a -worker-url worker.js even when no SHA-256 digest is available")
+}
+
+// workerFlagsSet reports whether a worker flag was given after fs.Parse.
+func workerFlagsSet(fs *flag.FlagSet) bool {
+    set := false
+    fs.Visit(func(f *flag.Flag) {
+        if strings.HasPrefix(f.Name, "worker-") || f.Name == "offline" {
+            set = true
+        }
+    })
+    return set
+}
+
+func runFleet(installDir string, args []string) {
+    if len(args) == 0 {
+        failMessage(fleetUsage, nil)
+        return
+    }
+    command := args[0]
+    fs := flag.NewFlagSet("fleet "+command, flag.ExitOnError)
+    concurrency := fs.Int("concurrency", batchConcurrency, "Number of panels handled at the same time")
+    yes := fs.Bool("yes", false, "Do not ask for confirmation")
+    dryRun := fs.Bool("dry-run", false, "Only show which panels would be affected")
+    reportPath := fs.String("report", "", "Also write the per-panel report to this JSON file")
+    var proxyIPs, addTags, removeTags stringList
+    var fallback string
+    var rotateUUID, rotateTrPass, rotateSubPath bool
+    switch command {
+    case "list", "health":
+    case "update-worker", "rotate", "set":
+        addWorkerFlags(fs)
+        switch command {
+        case "rotate":
+            fs.BoolVar(&rotateUUID, "uuid", false, "Rotate the UUID")
+            fs.BoolVar(&rotateTrPass, "trojan", false, "Rotate the Trojan password")
+            fs.BoolVar(&rotateSubPath, "sub-path", false, "Rotate the subscription path")
+        case "set":
+            fs.Var(&proxyIPs, "proxy-ip", "New PROXY_IP; repeat or comma-separate for several")
+            fs.StringVar(&fallback, "fallback", "", "New FALLBACK domain")
+        }
+    case "tag":
+        fs.Var(&addTags, "add", "Tags to add; repeat or comma-separate")
+        fs.Var(&removeTags, "remove", "Tags to remove; repeat or comma-separate")
+    default:
+        failMessage(fmt.Sprintf("Unknown fleet command %q.\n%s", command, fleetUsage), nil)
+        return
+    }
+    addNetworkFlags(fs)
+    fs.Parse(args[1:])
+    workerFlags := workerFlagsSet(fs)
+
+    selectorArgs := fs.Args()
+    if command == "list" && len(selectorArgs) == 0 {
+        selectorArgs = []string{"all"}
+    }
+    selector, err := parseSelector(selectorArgs)
+    if err != nil {
+        failMessage("Invalid selector", err)
+        return
+    }
+    if *concurrency < 1 || *concurrency > maxBatchConcurrency {
+        failMessage(fmt.Sprintf("Invalid -concurrency value. Use a number between 1 and %d.", maxBatchConcurrency), nil)
+        return
+    }
+    if err := checkWorkerFlags(); err != nil {
+        failMessage(err.Error(), nil)
+        return
+    }
+    for _, value := range proxyIPs {
+        if !proxyIPRe.MatchString(value) {
+            failMessage(fmt.Sprintf("Invalid -proxy-ip value %q. Use a host name or IP address.", value), nil)
+            return
+        }
+    }
+    if fallback != "" && !hostnameRe.MatchString(fallback) {
+        failMessage(fmt.Sprintf("Invalid -fallback value %q. Use a host name.", fallback), nil)
+        return
+    }
+    if command == "set" && len(proxyIPs) == 0 && fallback == "" {
+        failMessage("Nothing to set. Pass -proxy-ip and/or -fallback.", nil)
+        return
+    }
+    for _, tag := range append(append([]string(nil), addTags...), removeTags...) {
+        if !tagRe.MatchString(tag) {
+            failMessage(fmt.Sprintf("Invalid tag %q. Use lowercase letters, digits, hyphens and underscores.", tag), nil)
+            return
+        }
+    }
+    if command == "tag" && len(addTags) == 0 && len(removeTags) == 0 {
+        failMessage("Nothing to change. Pass -add and/or -remove.", nil)
+        return
+    }
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+
+    deployments, err := loadDeployments(installDir)
+    if err != nil {
+        failMessage("Could not read the deployment records", err)
+        os.Exit(1)
+    }
+    var selected []Deployment
+    for _, deployment := range deployments {
+        if selector.matches(deployment) {
+            selected = append(selected, deployment)
+        }
+    }
+    if len(selected) == 0 {
+        failMessage("No recorded panels match the selector.", nil)
+        return
+    }
+    printFleet(selected)
+    if command == "list" {
+        return
+    }
+
+    description := map[string]string{
+        "health":        "Check the health of",
+        "update-worker": "Deploy worker " + workerVersion + " to",
+        "rotate":        "Rotate the credentials of",
+        "set":           "Change PROXY_IP/FALLBACK of",
+        "tag":           "Change the tags of",
+    }[command]
+    fmt.Printf("\n%s %s %d panel(s).\n", infoPrefix, description, len(selected))
+    if *dryRun || (command != "health" && !confirmFleet("Continue?", *yes)) {
+        return
+    }
+
+    if err := os.MkdirAll(installDir, 0700); err != nil {
+        failMessage("Error creating install directory", err)
+        return
+    }
+    if err := startRunLog(installDir, os.Args); err != nil {
+        fmt.Printf("%s Warning: Could not start the run log: %v\n", warnPrefix, err)
+    }
+    defer finishRunLog()
+
+    var results []fleetResult
+    switch command {
+    case "health":
+        fmt.Printf("\n%s Checking %d panel(s)...\n", titlePrefix, len(selected))
+        results = checkFleetHealth(selected, *concurrency)
+    case "tag":
+        if results, err = tagFleet(installDir, selected, addTags, removeTags); err != nil {
+            failMessage("Could not save the deployment records", err)
+            return
+        }
+    default:
+        if !prepareDependencies(installDir) {
+            return
+        }
+        backend := newWranglerBackend(installDir)
+        if err := loginCloudflare(backend); err != nil {
+            return
+        }
+        if !rotateUUID && !rotateTrPass && !rotateSubPath {
+            rotateUUID, rotateTrPass, rotateSubPath = true, true, true
+        }
+        proxyIP := strings.Join(proxyIPs, ",")
+        keepWorker := command != "update-worker" && !workerFlags
+        results = redeployFleet(installDir, backend, selected, command, keepWorker, *concurrency, func(deployment *Deployment) {
+            switch command {
+            case "rotate":
+                rotateCredentials(deployment, rotateUUID, rotateTrPass, rotateSubPath)
+            case "set":
+                if proxyIP != "" {
+                    deployment.ProxyIP = proxyIP
+                }
+                if fallback != "" {
+                    deployment.Fallback = fallback
+                }
+            }
+        })
+        if command == "rotate" {
+            fmt.Printf("\n%s New credentials are saved in the vault; use vault export to see them.\n", infoPrefix)
+        }
+    }
+
+    failed := printFleetReport(results)
+    if *reportPath != "" {
+        if err := writeFleetReport(*reportPath, results); err != nil {
+            fmt.Printf("%s Warning: %v\n", warnPrefix, err)
+        } else {
+            fmt.Printf("%s Report saved to %s%s%s\n", infoPrefix, cyan, *reportPath, reset)
+        }
+    }
+    if failed > 0 {
+        finishRunLog()
+        os.Exit(1)
+    }
+}
+
+// rotateCredentials replaces the chosen credentials with new random ones
+// of the same length.
+func rotateCredentials(deployment *Deployment, rotateUUID, rotateTrPass, rotateSubPath bool) {
+    if rotateUUID {
+        deployment.UUID = uuid.NewString()
+        registerSecret(deployment.UUID)
+    }
+    if rotateTrPass {
+        deployment.TrPass = generateTrPassword(max(len(deployment.TrPass), defaultPanelOptions().TrPassLength))
+        registerSecret(deployment.TrPass)
+    }
+    if rotateSubPath {
+        deployment.SubPath = generateSubURIPath(max(len(deployment.SubPath), defaultPanelOptions().SubPathLength))
+        registerSecret(deployment.SubPath)
+    }
+}
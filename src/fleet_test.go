@@ -0,0 +1,181 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "slices"
+    "strings"
+    "testing"
+)
+
+func TestFleetSelector(t *testing.T) {
+    deployments := []Deployment{
+        {Name: "eu-one", DeployType: "1", Tags: []string{"eu"}, AccountID: "aaaaaaaa1111"},
+        {Name: "eu-two", DeployType: "2", Tags: []string{"eu", "mobile"}, AccountID: "bbbbbbbb2222"},
+        {Name: "us-one", DeployType: "1", Tags: []string{"us"}, AccountID: "aaaaaaaa1111"},
+    }
+    for _, tc := range []struct {
+        args []string
+        want []string
+    }{
+        {[]string{"all"}, []string{"eu-one", "eu-two", "us-one"}},
+        {[]string{"tag:eu"}, []string{"eu-one", "eu-two"}},
+        {[]string{"tag:eu", "tag:us"}, []string{"eu-one", "eu-two", "us-one"}},
+        {[]string{"tag:eu", "type:workers"}, []string{"eu-one"}},
+        {[]string{"account:aaaaaaaa"}, []string{"eu-one", "us-one"}},
+        {[]string{"type:pages"}, []string{"eu-two"}},
+        {[]string{"us-one"}, []string{"us-one"}},
+    } {
+        selector, err := parseSelector(tc.args)
+        if err != nil {
+            t.Fatalf("%v: %v", tc.args, err)
+        }
+        var got []string
+        for _, deployment := range deployments {
+            if selector.matches(deployment) {
+                got = append(got, deployment.Name)
+            }
+        }
+        if !slices.Equal(got, tc.want) {
+            t.Errorf("%v selected %v, want %v", tc.args, got, tc.want)
+        }
+    }
+
+    for _, args := range [][]string{nil, {"type:kv"}, {"zone:x"}, {"tag:"}} {
+        if _, err := parseSelector(args); err == nil {
+            t.Errorf("%v: expected an error", args)
+        }
+    }
+}
+
+func TestMergeTags(t *testing.T) {
+    got := mergeTags([]string{"eu", "old"}, []string{"mobile", "eu"}, []string{"old"})
+    if !slices.Equal(got, []string{"eu", "mobile"}) {
+        t.Errorf("got %v", got)
+    }
+}
+
+func TestFleetRotate(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    backend := newMemoryBackend()
+    first, err := deployPanel(installDir, backend)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if first.AccountID != "memory-account" {
+        t.Errorf("recorded account %q", first.AccountID)
+    }
+    before, err := findDeployment(installDir, first.Name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    other := Deployment{Name: "elsewhere", DeployType: "1", KVID: "kv1", AccountID: "another-account"}
+
+    results := redeployFleet(installDir, backend, []Deployment{*before, other}, "rotate", false, 2, func(deployment *Deployment) {
+        rotateCredentials(deployment, true, true, false)
+    })
+    if results[0].Status != "updated" {
+        t.Fatalf("rotate: %s (%s)", results[0].Status, results[0].Detail)
+    }
+    if results[1].Status != "skipped" || !strings.Contains(results[1].Detail, "another-") {
+        t.Errorf("panel of another account: %s (%s)", results[1].Status, results[1].Detail)
+    }
+    if len(backend.namespaces) != 1 {
+        t.Errorf("rotation created %d KV namespaces, want to reuse the panel's", len(backend.namespaces))
+    }
+
+    rotated, err := findDeployment(installDir, first.Name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if rotated.UUID == first.UUID || rotated.TrPass == first.TrPass {
+        t.Error("UUID and Trojan password were not rotated")
+    }
+    if rotated.SubPath != first.SubPath || len(rotated.TrPass) != len(first.TrPass) {
+        t.Error("rotation changed more than it should have")
+    }
+    if rotated.KVID != before.KVID || !rotated.CreatedAt.Equal(before.CreatedAt) {
+        t.Error("rotation lost the panel's KV namespace or creation time")
+    }
+}
+
+func TestFleetKeepsUnknownWorker(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    backend := newMemoryBackend()
+    deployment := Deployment{Name: "local-panel", DeployType: "1", KVID: "kv1", WorkerVersion: "local", WorkerSource: "local file /tmp/worker.js"}
+
+    results := redeployFleet(installDir, backend, []Deployment{deployment}, "set", true, 1, func(d *Deployment) { d.ProxyIP = "1.2.3.4" })
+    if results[0].Status != "failed" || !strings.Contains(results[0].Detail, "-worker-file") {
+        t.Errorf("got %s (%s), want a hint to pass the worker", results[0].Status, results[0].Detail)
+    }
+    if len(backend.deployed) != 0 {
+        t.Error("panel was redeployed with a different worker")
+    }
+
+    imported, _ := importDeployment("imported", "1", "", panelState{"kv": "kv1", "var.UUID": "uuid-value", "var.TR_PASS": "pass-value", "var.SUB_PATH": "sub-value"})
+    results = redeployFleet(installDir, backend, []Deployment{*imported}, "set", true, 1, func(*Deployment) {})
+    if results[0].Status != "failed" || !strings.Contains(results[0].Detail, "imported without a known worker release") {
+        t.Errorf("imported panel: %s (%s)", results[0].Status, results[0].Detail)
+    }
+}
+
+func TestFleetHealth(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if strings.HasPrefix(r.URL.Path, "/broken") {
+            w.WriteHeader(http.StatusInternalServerError)
+        }
+    }))
+    defer server.Close()
+
+    results := checkFleetHealth([]Deployment{
+        {Name: "good", PanelURL: server.URL + "/panel"},
+        {Name: "bad", PanelURL: server.URL + "/broken/panel"},
+        {Name: "unknown"},
+    }, 2)
+    for i, want := range []string{"healthy", "unhealthy", "skipped"} {
+        if results[i].Status != want {
+            t.Errorf("%s: %s (%s), want %s", results[i].Name, results[i].Status, results[i].Detail, want)
+        }
+    }
+}
+
+func TestFleetKeepsLoadedCredentialsOutOfLogs(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    t.Cleanup(finishRunLog)
+    backend, runner, _ := newTestWranglerBackend(t, installDir)
+    record := Deployment{Name: "panel-one", DeployType: "1", KVID: "kv1", UUID: "6f1c1f0e-3b1a-4d55-9d1e-2a8f0b1c3d4e", TrPass: "trojan-pass-value", SubPath: "sub-path-value"}
+    if err := recordDeployment(installDir, record); err != nil {
+        t.Fatal(err)
+    }
+    // A fresh run knows nothing but what it loads from the vault.
+    secretValues = nil
+    runner.on("deploy ./src/worker.js", fail("Your worker has access to the following bindings:\n- Vars:\n  - UUID: \""+record.UUID+"\"\n  - TR_PASS: \""+record.TrPass+"\"\n  - SUB_PATH: \""+record.SubPath+"\"\n"))
+
+    if err := startRunLog(installDir, []string{"bpb-wizard", "fleet", "set", "all"}); err != nil {
+        t.Fatal(err)
+    }
+    deployments, err := loadDeployments(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var results []fleetResult
+    console := captureStdout(t, func() {
+        results = redeployFleet(installDir, backend, deployments, "set", false, 1, func(d *Deployment) { d.ProxyIP = "1.2.3.4" })
+    })
+    path := currentRun.path
+    finishRunLog()
+
+    if results[0].Status != "failed" {
+        t.Fatalf("got %s, want the scripted deploy failure", results[0].Status)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, secret := range []string{record.UUID, record.TrPass, record.SubPath} {
+        if strings.Contains(string(data), secret) || strings.Contains(console, secret) || strings.Contains(results[0].Detail, secret) {
+            t.Errorf("run log, console or report contains %q", secret)
+        }
+    }
+}
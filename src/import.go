@@ -0,0 +1,293 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "flag"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+const (
+    importedSource = "imported from Cloudflare"
+    // unknownWorkerVersion marks an imported panel whose worker.js release
+    // could not be recognised; redeploys must choose one explicitly.
+    unknownWorkerVersion = "unknown"
+)
+
+// panelVersionRe finds the version BPB builds embed in worker.js.
+var panelVersionRe = regexp.MustCompile(`panelVersion\W{1,8}(\d+\.\d+\.\d+)`)
+
+// importDeployment builds a record from a live panel. Values the API
+// cannot return, such as secrets, are left empty and reported.
+func importDeployment(name, deployType, accountID string, live panelState) (*Deployment, []string) {
+    deployment := &Deployment{
+        Name:          name,
+        DeployType:    deployType,
+        AccountID:     accountID,
+        KVID:          live["kv"],
+        ProxyIP:       live["var.PROXY_IP"],
+        Fallback:      live["var.FALLBACK"],
+        WorkerVersion: unknownWorkerVersion,
+        WorkerSource:  importedSource,
+    }
+    if date := live["compatibility_date"]; date != unknownMark {
+        deployment.CompatibilityDate = date
+    }
+    if routes := live["routes"]; routes != unknownMark && routes != "" {
+        deployment.CustomDomain, _, _ = strings.Cut(routes, ",")
+    }
+
+    var warnings []string
+    if deployment.KVID == "" {
+        warnings = append(warnings, "no KV namespace is bound as kv")
+    }
+    credentials := map[string]*string{"UUID": &deployment.UUID, "TR_PASS": &deployment.TrPass, "SUB_PATH": &deployment.SubPath}
+    for _, varName := range credentialVars {
+        switch value := live["var."+varName]; value {
+        case secretMark:
+            deployment.SecretsMode = true
+        case "":
+            warnings = append(warnings, varName+" is not set on the panel")
+        default:
+            *credentials[varName] = value
+        }
+    }
+    for field, value := range live {
+        varName, isVar := strings.CutPrefix(field, "var.")
+        if !isVar || varName == "PROXY_IP" || varName == "FALLBACK" || credentials[varName] != nil {
+            continue
+        }
+        if value == secretMark {
+            warnings = append(warnings, fmt.Sprintf("secret %s cannot be read and is not recorded", varName))
+            continue
+        }
+        if deployment.Vars == nil {
+            deployment.Vars = map[string]string{}
+        }
+        deployment.Vars[varName] = value
+    }
+    sort.Strings(warnings)
+    return deployment, warnings
+}
+
+// detectWorkerVersion matches the script against the releases this
+// install has seen, then falls back to the version string in the script.
+func detectWorkerVersion(installDir string, script []byte, records []Deployment) (string, string) {
+    sum := sha256.Sum256(script)
+    digest := hex.EncodeToString(sum[:])
+    if hashes, err := loadTrustedHashes(installDir); err == nil {
+        for tag, known := range hashes {
+            if strings.EqualFold(known.SHA256, digest) {
+                return tag, digest
+            }
+        }
+    }
+    if cache, err := openWorkerCache(installDir); err == nil {
+        for _, entry := range cache.Entries {
+            if strings.EqualFold(entry.SHA256, digest) && isValidReleaseTag(entry.Tag) {
+                return entry.Tag, digest
+            }
+        }
+    }
+    for _, record := range records {
+        if strings.EqualFold(record.WorkerSHA256, digest) && isValidReleaseTag(record.WorkerVersion) {
+            return record.WorkerVersion, digest
+        }
+    }
+    // Wrangler bundles the script on upload, so the digest rarely matches
+    // and only the tag is known.
+    if match := panelVersionRe.FindSubmatch(script); match != nil {
+        return "v" + string(match[1]), ""
+    }
+    return "", ""
+}
+
+func (c *cloudflareClient) workersSubdomain() (string, error) {
+    var result struct {
+        Subdomain string `json:"subdomain"`
+    }
+    err := c.fetch(fmt.Sprintf("/accounts/%s/workers/subdomain", c.accountID), "Reading workers.dev subdomain", &result)
+    return result.Subdomain, err
+}
+
+// detectDeployType finds whether name is a worker script or a Pages
+// project. wanted, when set, is the only type considered.
+func (c *cloudflareClient) detectDeployType(name, wanted string) (string, error) {
+    var found []string
+    for _, deployType := range []string{"1", "2"} {
+        if wanted != "" && wanted != deployType {
+            continue
+        }
+        status, err := c.nameStatus(name, deployType)
+        if err != nil {
+            return "", err
+        }
+        if status == nameExists {
+            found = append(found, deployType)
+        }
+    }
+    switch len(found) {
+    case 0:
+        return "", fmt.Errorf("no worker script or Pages project named %s in account %s", name, shortAccount(c.accountID))
+    case 1:
+        return found[0], nil
+    default:
+        return "", fmt.Errorf("%s is both a worker script and a Pages project, choose one with -type", name)
+    }
+}
+
+func runImport(installDir string, args []string) {
+    fs := flag.NewFlagSet("import", flag.ExitOnError)
+    typeFlag := fs.String("type", "", "Import the worker script (workers) or the Pages project (pages) when both exist")
+    uuidFlag := fs.String("uuid", "", "UUID of a panel that stores it as a secret")
+    trPassFlag := fs.String("trojan-password", "", "Trojan password of a panel that stores it as a secret")
+    subPathFlag := fs.String("sub-path", "", "Subscription path of a panel that stores it as a secret")
+    force := fs.Bool("force", false, "Replace an existing record, or import something that does not look like a BPB panel")
+    fs.BoolVar(&showSecrets, "show-secrets", false, "Print the imported UUID, Trojan password and subscription path")
+    var tags stringList
+    fs.Var(&tags, "tag", "Tag the imported panel; repeat or comma-separate")
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if fs.NArg() != 1 {
+        failMessage("Usage: import [-type workers|pages] [-uuid ...] [-trojan-password ...] [-sub-path ...] [-tag ...] <worker-or-project-name>", nil)
+        return
+    }
+    name := fs.Arg(0)
+    wanted := map[string]string{"": "", "workers": "1", "pages": "2"}[*typeFlag]
+    if *typeFlag != "" && wanted == "" {
+        failMessage("Invalid -type value. Use workers or pages.", nil)
+        return
+    }
+    for _, tag := range tags {
+        if !tagRe.MatchString(tag) {
+            failMessage(fmt.Sprintf("Invalid tag %q. Use lowercase letters, digits, hyphens and underscores.", tag), nil)
+            return
+        }
+    }
+    for _, value := range []string{*uuidFlag, *trPassFlag, *subPathFlag} {
+        registerSecret(value)
+    }
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    if err := ensureVault(installDir); err != nil {
+        failMessage("Cannot open the credentials vault", err)
+        os.Exit(1)
+    }
+    records, err := loadDeployments(installDir)
+    if err != nil {
+        failMessage("Could not read the deployment records", err)
+        os.Exit(1)
+    }
+    if _, err := findDeployment(installDir, name); err == nil && !*force {
+        failMessage(fmt.Sprintf("%s is already recorded. Use diff -adopt %s to update it, or -force to replace the record.", name, name), nil)
+        return
+    }
+
+    api, err := newWranglerBackend(installDir).cloudflare()
+    if err != nil {
+        failMessage("Could not use the Cloudflare API. Log in with a deployment first or set CLOUDFLARE_API_TOKEN", err)
+        os.Exit(1)
+    }
+    fmt.Printf("\n%s Importing %s%s%s from account %s...\n", titlePrefix, cyan, name, reset, shortAccount(api.accountID))
+    deployType, err := api.detectDeployType(name, wanted)
+    if err != nil {
+        failMessage("Could not find the panel", err)
+        os.Exit(1)
+    }
+    live, err := api.livePanel(&Deployment{Name: name, DeployType: deployType})
+    if err != nil {
+        failMessage("Could not read the live panel", err)
+        os.Exit(1)
+    }
+    var vars []string
+    for field := range live.State {
+        if varName, isVar := strings.CutPrefix(field, "var."); isVar {
+            vars = append(vars, varName)
+        }
+    }
+    if !looksLikePanel(live.State["kv"] != "", vars) && !*force {
+        failMessage(fmt.Sprintf("%s does not look like a BPB panel (no kv binding with UUID and TR_PASS). Use -force to import it anyway.", name), nil)
+        return
+    }
+
+    deployment, warnings := importDeployment(name, deployType, api.accountID, live.State)
+    for _, credential := range []struct {
+        target *string
+        value  string
+        flag   string
+    }{
+        {&deployment.UUID, *uuidFlag, "-uuid"},
+        {&deployment.TrPass, *trPassFlag, "-trojan-password"},
+        {&deployment.SubPath, *subPathFlag, "-sub-path"},
+    } {
+        switch {
+        case credential.value == "":
+        case *credential.target != "":
+            warnings = append(warnings, fmt.Sprintf("%s ignored, the panel stores the value in plain text", credential.flag))
+        default:
+            *credential.target = credential.value
+        }
+    }
+    if deployment.SecretsMode && (deployment.UUID == "" || deployment.TrPass == "" || deployment.SubPath == "") {
+        warnings = append(warnings, "some credentials are secrets and were not given; redeploys are refused until fleet rotate sets new ones")
+    }
+    deployment.Tags = mergeTags(nil, tags, nil)
+    for _, value := range panelSecrets(deployment) {
+        registerSecret(value)
+    }
+
+    deployment.PanelURL = "https://" + name + ".pages.dev/panel"
+    if deployType == "1" {
+        if subdomain, err := api.workersSubdomain(); err == nil && subdomain != "" {
+            deployment.PanelURL = fmt.Sprintf("https://%s.%s.workers.dev/panel", name, subdomain)
+        } else {
+            deployment.PanelURL = ""
+            warnings = append(warnings, "the workers.dev subdomain could not be read, the panel URL is not recorded")
+        }
+        if deployment.CustomDomain != "" {
+            deployment.PanelURL = "https://" + strings.TrimSuffix(strings.TrimPrefix(deployment.CustomDomain, "*."), "/*") + "/panel"
+        }
+        script, err := api.fetchRaw(fmt.Sprintf("/accounts/%s/workers/scripts/%s/content/v2", api.accountID, url.PathEscape(name)), "Reading worker script")
+        if err == nil {
+            if tag, digest := detectWorkerVersion(installDir, script, records); tag != "" {
+                deployment.WorkerVersion, deployment.WorkerSHA256 = tag, digest
+            }
+        } else if status, ok := err.(*httpStatusError); !ok || status.status != http.StatusNotFound {
+            warnings = append(warnings, "the worker script could not be read to detect its version")
+        }
+    }
+    if deployment.WorkerVersion == unknownWorkerVersion {
+        warnings = append(warnings, "the worker.js release is unknown; fleet update-worker sets it on the next update")
+    }
+
+    if err := recordDeployment(installDir, *deployment); err != nil {
+        failMessage("Could not save the deployment record", err)
+        return
+    }
+    if err := tightenPermissions(installDir); err != nil {
+        fmt.Printf("%s Warning: Could not restrict permissions in %s: %v\n", warnPrefix, installDir, err)
+    }
+
+    fmt.Printf("\n   Type:      %s\n", map[string]string{"1": "Workers", "2": "Pages"}[deployType])
+    fmt.Printf("   URL:       %s%s%s\n", blue, deployment.PanelURL, reset)
+    fmt.Printf("   KV:        %s\n", deployment.KVID)
+    fmt.Printf("   Worker:    %s\n", deployment.WorkerVersion)
+    fmt.Printf("   Proxy IP:  %s\n   Fallback:  %s\n", deployment.ProxyIP, deployment.Fallback)
+    if deployment.SecretsMode {
+        fmt.Printf("   Credentials are stored as secrets on the panel.\n")
+    }
+    for _, warning := range warnings {
+        fmt.Printf("%s %s\n", warnPrefix, warning)
+    }
+    printCredentials(deployment)
+    successMessage(fmt.Sprintf("Imported %s. Fleet commands, status and diff can now manage it.", name))
+}
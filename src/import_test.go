@@ -0,0 +1,114 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "strings"
+    "testing"
+)
+
+func TestImportDeployment(t *testing.T) {
+    live := panelState{
+        "kv":                  "kv1",
+        "compatibility_date":  "2026-01-01",
+        "compatibility_flags": "nodejs_compat",
+        "routes":              "panel.example.com",
+        "var.UUID":            "6f1c1f0e-3b1a-4d55-9d1e-2a8f0b1c3d4e",
+        "var.TR_PASS":         "trojan-pass",
+        "var.SUB_PATH":        "sub-path",
+        "var.PROXY_IP":        "1.2.3.4",
+        "var.FALLBACK":        "speed.cloudflare.com",
+        "var.REGION":          "eu",
+    }
+    deployment, warnings := importDeployment("panel-one", "1", "acc", live)
+    if len(warnings) != 0 {
+        t.Errorf("warnings: %v", warnings)
+    }
+    if deployment.SecretsMode || deployment.TrPass != "trojan-pass" || deployment.KVID != "kv1" || deployment.CustomDomain != "panel.example.com" {
+        t.Errorf("record: %+v", deployment)
+    }
+    if len(deployment.Vars) != 1 || deployment.Vars["REGION"] != "eu" {
+        t.Errorf("vars: %v", deployment.Vars)
+    }
+    for _, row := range diffPanel(recordedState(deployment), configState(deployment), live) {
+        if row.differs() {
+            t.Errorf("imported record differs from the panel in %s: %+v", row.Field, row)
+        }
+    }
+
+    live["var.UUID"], live["var.TR_PASS"], live["var.TOKEN"] = secretMark, secretMark, secretMark
+    live["routes"] = unknownMark
+    deployment, warnings = importDeployment("panel-one", "1", "acc", live)
+    if !deployment.SecretsMode || deployment.UUID != "" || deployment.SubPath != "sub-path" || deployment.CustomDomain != "" {
+        t.Errorf("record with secrets: %+v", deployment)
+    }
+    if _, recorded := deployment.Vars["TOKEN"]; recorded || !slices.Equal(warnings, []string{"secret TOKEN cannot be read and is not recorded"}) {
+        t.Errorf("vars %v, warnings %v", deployment.Vars, warnings)
+    }
+}
+
+func TestDetectWorkerVersion(t *testing.T) {
+    installDir := t.TempDir()
+    script := []byte(`const panelVersion = "3.4.1"; export default {}`)
+    if tag, digest := detectWorkerVersion(installDir, script, nil); tag != "v3.4.1" || digest != "" {
+        t.Errorf("from the script: %q %q", tag, digest)
+    }
+
+    sum := sha256.Sum256(script)
+    records := []Deployment{{Name: "other", WorkerVersion: "v3.4.0", WorkerSHA256: hex.EncodeToString(sum[:])}}
+    if tag, digest := detectWorkerVersion(installDir, script, records); tag != "v3.4.0" || digest != records[0].WorkerSHA256 {
+        t.Errorf("from a record: %q %q", tag, digest)
+    }
+
+    if tag, _ := detectWorkerVersion(installDir, []byte("export default {}"), records); tag != "" {
+        t.Errorf("unknown script detected as %q", tag)
+    }
+}
+
+func TestDetectDeployType(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        if strings.HasPrefix(r.URL.Path, "/accounts/gone/") {
+            w.WriteHeader(http.StatusNotFound)
+            io.WriteString(w, `{"success":false,"errors":[{"code":7003,"message":"Could not route to /accounts/gone"}]}`)
+            return
+        }
+        switch r.URL.Path {
+        case "/accounts/acc/workers/scripts/both/settings", "/accounts/acc/pages/projects/both", "/accounts/acc/pages/projects/site":
+            io.WriteString(w, `{"success":true,"errors":[],"result":{}}`)
+        case "/accounts/acc/workers/subdomain":
+            io.WriteString(w, `{"success":true,"errors":[],"result":{"subdomain":"me"}}`)
+        default:
+            writeNotFound(w, r.URL.Path)
+        }
+    }))
+    defer server.Close()
+    savedAPI := cloudflareAPI
+    cloudflareAPI = server.URL
+    defer func() { cloudflareAPI = savedAPI }()
+
+    api := &cloudflareClient{token: "test-token", accountID: "acc"}
+    if deployType, err := api.detectDeployType("site", ""); deployType != "2" || err != nil {
+        t.Errorf("site: %q %v", deployType, err)
+    }
+    if _, err := api.detectDeployType("both", ""); err == nil {
+        t.Error("a name used by both types was not reported")
+    }
+    if deployType, err := api.detectDeployType("both", "1"); deployType != "1" || err != nil {
+        t.Errorf("both with -type workers: %q %v", deployType, err)
+    }
+    if _, err := api.detectDeployType("missing", ""); err == nil {
+        t.Error("a missing panel was not reported")
+    }
+    gone := &cloudflareClient{token: "test-token", accountID: "gone"}
+    if _, err := gone.detectDeployType("site", ""); err == nil || strings.Contains(err.Error(), "no worker script or Pages project") {
+        t.Errorf("an unreachable account was reported as a missing panel: %v", err)
+    }
+    if subdomain, err := api.workersSubdomain(); subdomain != "me" || err != nil {
+        t.Errorf("subdomain %q %v", subdomain, err)
+    }
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "time"
+)
+
+const maxWorkerSize = 10 * 1024 * 1024
+
+type TrustedHash struct {
+    SHA256    string    `json:"sha256"`
+    FirstSeen time.Time `json:"first_seen"`
+}
+
+func isValidSHA256(digest string) bool {
+    re, err := regexp.Compile(`^[a-fA-F0-9]{64}$`)
+    if err != nil {
+        return false
+    }
+    return re.MatchString(digest)
+}
+
+func fileSHA256(path string) (string, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return "", fmt.Errorf("error reading file: %v", err)
+    }
+    defer file.Close()
+    hash := sha256.New()
+    if _, err := io.Copy(hash, file); err != nil {
+        return "", fmt.Errorf("error reading file: %v", err)
+    }
+    return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func checkWorkerPayload(data []byte) error {
+    if len(bytes.TrimSpace(data)) == 0 {
+        return fmt.Errorf("downloaded worker script is empty")
+    }
+    if len(data) > maxWorkerSize {
+        return fmt.Errorf("downloaded worker script is too large (%d bytes, limit %d)", len(data), maxWorkerSize)
+    }
+    head := strings.ToLower(string(bytes.TrimSpace(data[:min(len(data), 512)])))
+    if strings.HasPrefix(head, "<!doctype") || strings.HasPrefix(head, "<html") || strings.HasPrefix(head, "<?xml") {
+        return fmt.Errorf("downloaded worker script looks like an HTML/XML error page")
+    }
+    return nil
+}
+
+func verifyWorkerScript(path, expectedSHA256 string) (string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return "", fmt.Errorf("error reading worker script: %v", err)
+    }
+    if err := checkWorkerPayload(data); err != nil {
+        return "", err
+    }
+    sum := sha256.Sum256(data)
+    digest := hex.EncodeToString(sum[:])
+    if expectedSHA256 != "" && !strings.EqualFold(digest, expectedSHA256) {
+        return digest, fmt.Errorf("SHA-256 mismatch: expected %s, got %s", strings.ToLower(expectedSHA256), digest)
+    }
+    return digest, nil
+}
+
+func trustedHashesPath(installDir string) string {
+    return filepath.Join(installDir, "worker-hashes.json")
+}
+
+func loadTrustedHashes(installDir string) (map[string]TrustedHash, error) {
+    hashes := map[string]TrustedHash{}
+    data, err := os.ReadFile(trustedHashesPath(installDir))
+    if errors.Is(err, os.ErrNotExist) {
+        return hashes, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("error reading trusted hashes: %v", err)
+    }
+    if err := json.Unmarshal(data, &hashes); err != nil {
+        return nil, fmt.Errorf("error parsing trusted hashes: %v", err)
+    }
+    return hashes, nil
+}
+
+func checkTrustedHash(installDir, tag, digest string, accept bool) (bool, error) {
+    if tag == workerLatestTag {
+        return true, nil
+    }
+    hashes, err := loadTrustedHashes(installDir)
+    if err != nil {
+        return false, err
+    }
+    if known, ok := hashes[tag]; ok && !accept {
+        return strings.EqualFold(known.SHA256, digest), nil
+    }
+    hashes[tag] = TrustedHash{SHA256: digest, FirstSeen: time.Now().UTC()}
+    jsonData, err := json.MarshalIndent(hashes, "", "  ")
+    if err != nil {
+        return false, fmt.Errorf("error marshaling trusted hashes: %v", err)
+    }
+    if err := os.WriteFile(trustedHashesPath(installDir), jsonData, 0600); err != nil {
+        return false, fmt.Errorf("error writing trusted hashes: %v", err)
+    }
+    return true, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+const testWorker = "export default { fetch() { return new Response('ok'); } };\n"
+
+func sha256Hex(data string) string {
+    sum := sha256.Sum256([]byte(data))
+    return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyWorkerScript(t *testing.T) {
+    digest := sha256Hex(testWorker)
+    tests := []struct {
+        name     string
+        content  string
+        expected string
+        wantErr  string
+    }{
+        {"no digest", testWorker, "", ""},
+        {"matching digest", testWorker, digest, ""},
+        {"upper-case digest", testWorker, strings.ToUpper(digest), ""},
+        {"mismatch", testWorker, sha256Hex("something else"), "SHA-256 mismatch"},
+        {"empty", "  \n", "", "empty"},
+        {"HTML error page", "<!DOCTYPE html><html><body>rate limited</body></html>", "", "HTML"},
+        {"too large", strings.Repeat("a", maxWorkerSize+1), "", "too large"},
+    }
+    dir := t.TempDir()
+    for _, tt := range tests {
+        path := filepath.Join(dir, "worker.js")
+        if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+            t.Fatal(err)
+        }
+        got, err := verifyWorkerScript(path, tt.expected)
+        switch {
+        case tt.wantErr == "" && err != nil:
+            t.Errorf("%s: %v", tt.name, err)
+        case tt.wantErr == "" && got != digest:
+            t.Errorf("%s: digest %s", tt.name, got)
+        case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+            t.Errorf("%s: got %v, want an error about %q", tt.name, err, tt.wantErr)
+        }
+    }
+}
+
+func TestCheckTrustedHash(t *testing.T) {
+    installDir := t.TempDir()
+    first, changed := sha256Hex("release v3.0.0"), sha256Hex("tampered v3.0.0")
+    tests := []struct {
+        name   string
+        tag    string
+        digest string
+        accept bool
+        want   bool
+    }{
+        {"first seen is trusted", "v3.0.0", first, false, true},
+        {"same digest again", "v3.0.0", first, false, true},
+        {"changed content", "v3.0.0", changed, false, false},
+        {"changed content stays refused", "v3.0.0", changed, false, false},
+        {"accepted with -worker-sha256", "v3.0.0", changed, true, true},
+        {"accepted digest is remembered", "v3.0.0", changed, false, true},
+        {"old digest is now refused", "v3.0.0", first, false, false},
+        {"latest is never pinned", workerLatestTag, changed, false, true},
+    }
+    for _, tt := range tests {
+        got, err := checkTrustedHash(installDir, tt.tag, tt.digest, tt.accept)
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if got != tt.want {
+            t.Errorf("%s: trusted = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+    hashes, err := loadTrustedHashes(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, stored := hashes[workerLatestTag]; stored || len(hashes) != 1 {
+        t.Errorf("trusted hashes: %v", hashes)
+    }
+    if info, err := os.Stat(trustedHashesPath(installDir)); err != nil || info.Mode().Perm() != 0600 {
+        t.Errorf("trusted hash database missing or readable by others: %v", err)
+    }
+}
+
+func TestResolveWorkerRelease(t *testing.T) {
+    setupDeploy(t, "1")
+    digest := sha256Hex(testWorker)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/latest", "/tags/v3.0.0":
+            io.WriteString(w, `{"tag_name":"v3.0.0","assets":[{"name":"worker.js","digest":"sha256:`+strings.ToUpper(digest)+`","browser_download_url":"https://example.com/worker.js"}]}`)
+        case "/tags/v2.0.0":
+            io.WriteString(w, `{"tag_name":"v2.0.0","assets":[{"name":"worker.zip"}]}`)
+        default:
+            w.WriteHeader(http.StatusNotFound)
+        }
+    }))
+    defer server.Close()
+    savedAPI := workerReleasesAPI
+    workerReleasesAPI = server.URL
+    defer func() { workerReleasesAPI = savedAPI }()
+
+    release, err := resolveWorkerRelease(workerLatestTag)
+    if err != nil || release.Tag != "v3.0.0" || release.SHA256 != digest {
+        t.Errorf("latest resolved to %+v, %v", release, err)
+    }
+    if _, err := resolveWorkerRelease("v2.0.0"); err == nil {
+        t.Error("a release without worker.js was accepted")
+    }
+    release, err = resolveWorkerRelease("v1.0.0")
+    if err == nil || release == nil || release.SHA256 != "" || !strings.Contains(release.URL, "/v1.0.0/") {
+        t.Errorf("unknown tag: %+v, %v", release, err)
+    }
+}
+
+func TestLatestWithoutDigestIsRefused(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNotFound)
+    }))
+    defer server.Close()
+    savedAPI := workerReleasesAPI
+    workerReleasesAPI = server.URL
+    defer func() { workerReleasesAPI = savedAPI }()
+    workerFile = ""
+
+    workerPath := filepath.Join(t.TempDir(), "worker.js")
+    if _, err := prepareWorkerScript(installDir, workerPath); err == nil || !strings.Contains(err.Error(), "-allow-unverified") {
+        t.Errorf("got %v, want latest without a digest refused", err)
+    }
+}
+
+func TestCorruptTrustedHashesFailClosed(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/tags/v3.0.0" {
+            io.WriteString(w, `{"tag_name":"v3.0.0","assets":[{"name":"worker.js","browser_download_url":"`+"http://"+r.Host+`/worker.js"}]}`)
+            return
+        }
+        io.WriteString(w, testWorker)
+    }))
+    defer server.Close()
+    savedAPI := workerReleasesAPI
+    workerReleasesAPI = server.URL
+    defer func() { workerReleasesAPI = savedAPI }()
+    workerFile, workerVersion = "", "v3.0.0"
+    if err := os.WriteFile(trustedHashesPath(installDir), []byte("{not json"), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    workerPath := filepath.Join(t.TempDir(), "worker.js")
+    if _, err := prepareWorkerScript(installDir, workerPath); err == nil || !strings.Contains(err.Error(), "trusted hash database") {
+        t.Errorf("got %v, want the deploy refused", err)
+    }
+    if _, err := os.Stat(workerPath); err == nil {
+        t.Error("the unchecked worker.js was left in place")
+    }
+}
+
+func TestCustomWorkerIsVerified(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    served := testWorker
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/tags/v3.0.0":
+            io.WriteString(w, `{"tag_name":"v3.0.0","assets":[{"name":"worker.js","digest":"sha256:`+sha256Hex(testWorker)+`","browser_download_url":"https://example.com/worker.js"}]}`)
+        case "/worker.js":
+            io.WriteString(w, served)
+        default:
+            w.WriteHeader(http.StatusNotFound)
+        }
+    }))
+    defer server.Close()
+    savedAPI := workerReleasesAPI
+    workerReleasesAPI = server.URL
+    defer func() { workerReleasesAPI = savedAPI }()
+    defer func() { allowNoDigest = false }()
+
+    tampered := "export default { evil: true };\n"
+    localFile := filepath.Join(t.TempDir(), "worker.js")
+    tests := []struct {
+        name    string
+        file    bool
+        version string
+        content string
+        allow   bool
+        wantTag string
+        wantErr string
+    }{
+        {"mirror of latest without a digest", false, workerLatestTag, testWorker, false, "", "-allow-unverified"},
+        {"mirror of latest allowed unchecked", false, workerLatestTag, testWorker, true, "custom", ""},
+        {"mirror of a release", false, "v3.0.0", testWorker, false, "v3.0.0", ""},
+        {"mirror not matching the release", false, "v3.0.0", tampered, false, "", "SHA-256 mismatch"},
+        {"local file of a release", true, "v3.0.0", testWorker, false, "v3.0.0", ""},
+        {"local file not matching the release", true, "v3.0.0", tampered, false, "", "SHA-256 mismatch"},
+        {"untagged local file", true, workerLatestTag, tampered, false, "local", ""},
+        {"unpublished release changed since first seen", true, "v2.0.0", tampered, false, "", "trusted hash"},
+    }
+    if _, err := checkTrustedHash(installDir, "v2.0.0", sha256Hex(testWorker), false); err != nil {
+        t.Fatal(err)
+    }
+    for _, tt := range tests {
+        served, workerVersion, allowNoDigest = tt.content, tt.version, tt.allow
+        workerFile, workerURLs = "", stringList{server.URL + "/worker.js"}
+        if tt.file {
+            if err := os.WriteFile(localFile, []byte(tt.content), 0600); err != nil {
+                t.Fatal(err)
+            }
+            workerFile, workerURLs = localFile, nil
+        }
+        workerPath := filepath.Join(t.TempDir(), "worker.js")
+        var script *WorkerScript
+        var err error
+        captureStdout(t, func() { script, err = prepareWorkerScript(installDir, workerPath) })
+        if tt.wantErr != "" {
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Errorf("%s: got %v, want an error about %q", tt.name, err, tt.wantErr)
+            }
+            if _, err := os.Stat(workerPath); err == nil {
+                t.Errorf("%s: the rejected worker.js was left in place", tt.name)
+            }
+            continue
+        }
+        if err != nil || script.Tag != tt.wantTag {
+            t.Errorf("%s: got %+v, %v, want tag %s", tt.name, script, err, tt.wantTag)
+        }
+    }
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "net/url"
+    "os"
+    "slices"
+    "strings"
+    "sync"
+    "time"
+)
+
+const wizardKVPrefix = "panel_kv_"
+
+// Inventory statuses.
+const (
+    statusRegistered   = "registered"
+    statusUnknownPanel = "unknown panel"
+    statusOther        = "other"
+    statusInUse        = "in use"
+    statusOrphan       = "orphan"
+    statusUnused       = "unused"
+)
+
+// cloudResource is a worker script, Pages project or KV namespace found
+// in the account.
+type cloudResource struct {
+    Kind   string   `json:"kind"`
+    Name   string   `json:"name"`
+    ID     string   `json:"id,omitempty"`
+    KVIDs  []string `json:"kv_ids,omitempty"`
+    Vars   []string `json:"vars,omitempty"`
+    Panel  bool     `json:"panel"`
+    Status string   `json:"status"`
+}
+
+// looksLikePanel reports whether the bindings are those of a BPB panel:
+// a KV namespace bound as kv plus the UUID and TR_PASS variables.
+func looksLikePanel(kvBinding bool, vars []string) bool {
+    return kvBinding && slices.Contains(vars, "UUID") && slices.Contains(vars, "TR_PASS")
+}
+
+// scriptBinding is a binding in a worker script's settings.
+type scriptBinding struct {
+    Name        string `json:"name"`
+    Type        string `json:"type"`
+    Text        string `json:"text"`
+    NamespaceID string `json:"namespace_id"`
+}
+
+type inventory struct {
+    AccountID string          `json:"account_id"`
+    Workers   []cloudResource `json:"workers"`
+    Pages     []cloudResource `json:"pages"`
+    KV        []cloudResource `json:"kv_namespaces"`
+    Missing   []string        `json:"records_without_panel,omitempty"`
+}
+
+func (c *cloudflareClient) listWorkerScripts() ([]cloudResource, error) {
+    var scripts []struct {
+        ID string `json:"id"`
+    }
+    err := c.list(fmt.Sprintf("/accounts/%s/workers/scripts", c.accountID), "Listing worker scripts", func(page json.RawMessage) error {
+        var batch []struct {
+            ID string `json:"id"`
+        }
+        err := json.Unmarshal(page, &batch)
+        scripts = append(scripts, batch...)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    resources := make([]cloudResource, len(scripts))
+    var mu sync.Mutex
+    var firstErr error
+    runLimited(len(scripts), maxBatchConcurrency, func(i int) {
+        resource := cloudResource{Kind: "worker", Name: scripts[i].ID}
+        var settings struct {
+            Bindings []scriptBinding `json:"bindings"`
+        }
+        err := c.fetch(fmt.Sprintf("/accounts/%s/workers/scripts/%s/settings", c.accountID, url.PathEscape(scripts[i].ID)), "Reading worker settings", &settings)
+        if err != nil {
+            mu.Lock()
+            if firstErr == nil {
+                firstErr = fmt.Errorf("error reading settings of %s: %v", scripts[i].ID, err)
+            }
+            mu.Unlock()
+            return
+        }
+        kvBinding := false
+        for _, binding := range settings.Bindings {
+            switch binding.Type {
+            case "kv_namespace":
+                resource.KVIDs = append(resource.KVIDs, binding.NamespaceID)
+                kvBinding = kvBinding || binding.Name == "kv"
+            case "plain_text", "secret_text":
+                resource.Vars = append(resource.Vars, binding.Name)
+            }
+        }
+        resource.Panel = looksLikePanel(kvBinding, resource.Vars)
+        resources[i] = resource
+    })
+    return resources, firstErr
+}
+
+func (c *cloudflareClient) listPagesProjects() ([]cloudResource, error) {
+    var resources []cloudResource
+    err := c.list(fmt.Sprintf("/accounts/%s/pages/projects", c.accountID), "Listing Pages projects", func(page json.RawMessage) error {
+        var projects []struct {
+            Name    string `json:"name"`
+            Configs struct {
+                Production struct {
+                    EnvVars      map[string]json.RawMessage `json:"env_vars"`
+                    KVNamespaces map[string]struct {
+                        NamespaceID string `json:"namespace_id"`
+                    } `json:"kv_namespaces"`
+                } `json:"production"`
+            } `json:"deployment_configs"`
+        }
+        if err := json.Unmarshal(page, &projects); err != nil {
+            return err
+        }
+        for _, project := range projects {
+            config := project.Configs.Production
+            resource := cloudResource{Kind: "pages", Name: project.Name}
+            for name := range config.EnvVars {
+                resource.Vars = append(resource.Vars, name)
+            }
+            slices.Sort(resource.Vars)
+            kvBinding := false
+            for name, namespace := range config.KVNamespaces {
+                resource.KVIDs = append(resource.KVIDs, namespace.NamespaceID)
+                kvBinding = kvBinding || name == "kv"
+            }
+            resource.Panel = looksLikePanel(kvBinding, resource.Vars)
+            resources = append(resources, resource)
+        }
+        return nil
+    })
+    return resources, err
+}
+
+func (c *cloudflareClient) listKVNamespaces() ([]cloudResource, error) {
+    var resources []cloudResource
+    err := c.list(fmt.Sprintf("/accounts/%s/storage/kv/namespaces?per_page=100", c.accountID), "Listing KV namespaces", func(page json.RawMessage) error {
+        var namespaces []KVNamespace
+        if err := json.Unmarshal(page, &namespaces); err != nil {
+            return err
+        }
+        for _, namespace := range namespaces {
+            resources = append(resources, cloudResource{Kind: "kv", Name: namespace.Title, ID: namespace.ID})
+        }
+        return nil
+    })
+    return resources, err
+}
+
+func (c *cloudflareClient) deleteResource(resource cloudResource) error {
+    switch resource.Kind {
+    case "worker":
+        return c.remove(fmt.Sprintf("/accounts/%s/workers/scripts/%s?force=true", c.accountID, url.PathEscape(resource.Name)), "Deleting worker "+resource.Name)
+    case "pages":
+        return c.remove(fmt.Sprintf("/accounts/%s/pages/projects/%s", c.accountID, url.PathEscape(resource.Name)), "Deleting Pages project "+resource.Name)
+    default:
+        return c.remove(fmt.Sprintf("/accounts/%s/storage/kv/namespaces/%s", c.accountID, resource.ID), "Deleting KV namespace "+resource.Name)
+    }
+}
+
+func (c *cloudflareClient) collectInventory(records []Deployment) (*inventory, error) {
+    workers, err := c.listWorkerScripts()
+    if err != nil {
+        return nil, err
+    }
+    pages, err := c.listPagesProjects()
+    if err != nil {
+        return nil, err
+    }
+    kv, err := c.listKVNamespaces()
+    if err != nil {
+        return nil, err
+    }
+    return classifyInventory(c.accountID, workers, pages, kv, records), nil
+}
+
+// classifyInventory links scripts and projects to the records of this
+// account and decides which KV namespaces are orphans. Only namespaces the
+// wizard created (or recorded) and nothing binds are orphans; other
+// unbound namespaces are left to the user.
+func classifyInventory(accountID string, workers, pages, kv []cloudResource, records []Deployment) *inventory {
+    inv := &inventory{AccountID: accountID, Workers: workers, Pages: pages, KV: kv}
+    recorded := map[string]Deployment{}
+    recordedKV := map[string]bool{}
+    for _, record := range records {
+        if record.AccountID != "" && record.AccountID != accountID {
+            continue
+        }
+        recorded[record.DeployType+"/"+record.Name] = record
+        recordedKV[record.KVID] = true
+    }
+
+    bound := map[string]bool{}
+    live := map[string]bool{}
+    for _, list := range [][]cloudResource{inv.Workers, inv.Pages} {
+        for i := range list {
+            resource := &list[i]
+            deployType := map[string]string{"worker": "1", "pages": "2"}[resource.Kind]
+            _, isRecorded := recorded[deployType+"/"+resource.Name]
+            switch {
+            case isRecorded:
+                resource.Status = statusRegistered
+                live[deployType+"/"+resource.Name] = true
+            case resource.Panel:
+                resource.Status = statusUnknownPanel
+            default:
+                resource.Status = statusOther
+            }
+            for _, id := range resource.KVIDs {
+                bound[id] = true
+            }
+        }
+    }
+
+    for i := range inv.KV {
+        namespace := &inv.KV[i]
+        switch {
+        case bound[namespace.ID]:
+            namespace.Status = statusInUse
+        case strings.HasPrefix(namespace.Name, wizardKVPrefix) || recordedKV[namespace.ID]:
+            namespace.Status = statusOrphan
+        default:
+            namespace.Status = statusUnused
+        }
+    }
+
+    for key, record := range recorded {
+        if !live[key] {
+            inv.Missing = append(inv.Missing, record.Name)
+        }
+    }
+    slices.Sort(inv.Missing)
+    return inv
+}
+
+// pruneTargets lists what prune -orphans removes: orphan KV namespaces.
+// Records are local to one machine, so unknown panels may be someone
+// else's; they and the wizard's namespaces only they use are added only
+// with unknownPanels.
+func (inv *inventory) pruneTargets(unknownPanels bool) []cloudResource {
+    var targets []cloudResource
+    keptKV := map[string]bool{}
+    for _, list := range [][]cloudResource{inv.Workers, inv.Pages} {
+        for _, resource := range list {
+            if resource.Status == statusUnknownPanel && unknownPanels {
+                targets = append(targets, resource)
+                continue
+            }
+            for _, id := range resource.KVIDs {
+                keptKV[id] = true
+            }
+        }
+    }
+    for _, namespace := range inv.KV {
+        if namespace.Status == statusOrphan || namespace.Status == statusInUse && !keptKV[namespace.ID] && strings.HasPrefix(namespace.Name, wizardKVPrefix) {
+            targets = append(targets, namespace)
+        }
+    }
+    return targets
+}
+
+func printInventory(inv *inventory) {
+    kinds := []struct {
+        title     string
+        resources []cloudResource
+    }{
+        {"Worker scripts", inv.Workers},
+        {"Pages projects", inv.Pages},
+    }
+    panels, unknown := 0, 0
+    for _, kind := range kinds {
+        fmt.Printf("\n%s %s (%d)\n", titlePrefix, kind.title, len(kind.resources))
+        for _, resource := range kind.resources {
+            panel := "-"
+            if resource.Panel {
+                panel = "BPB panel"
+                panels++
+            }
+            color := green
+            switch resource.Status {
+            case statusUnknownPanel:
+                color = red
+                unknown++
+            case statusOther:
+                color = ""
+            }
+            fmt.Printf("  %-34s %-10s %s%s%s\n", resource.Name, panel, bold+color, resource.Status, reset)
+        }
+    }
+
+    orphans := 0
+    fmt.Printf("\n%s KV namespaces (%d)\n", titlePrefix, len(inv.KV))
+    for _, namespace := range inv.KV {
+        color := green
+        switch namespace.Status {
+        case statusOrphan:
+            color = red
+            orphans++
+        case statusUnused:
+            color = yellow
+        }
+        fmt.Printf("  %-34s %-32s %s%s%s\n", namespace.Name, namespace.ID, bold+color, namespace.Status, reset)
+    }
+
+    if len(inv.Missing) > 0 {
+        fmt.Printf("\n%s Recorded panels not found in this account: %s\n", warnPrefix, strings.Join(inv.Missing, ", "))
+    }
+    fmt.Printf("\n%s %d BPB panel(s), %d not in the local records; %d orphan KV namespace(s).\n", infoPrefix, panels, unknown, orphans)
+    if unknown > 0 || orphans > 0 {
+        fmt.Printf("%s Run %sprune -orphans%s to remove the unknown panels and orphan namespaces.\n", infoPrefix, cyan, reset)
+    }
+}
+
+// openInventory reads the local records and the account's resources.
+func openInventory(installDir string) (*cloudflareClient, *inventory, bool) {
+    records, err := loadDeployments(installDir)
+    if err != nil {
+        failMessage("Could not read the deployment records, refusing to classify panels without them", err)
+        return nil, nil, false
+    }
+    api, err := newWranglerBackend(installDir).cloudflare()
+    if err != nil {
+        failMessage("Could not use the Cloudflare API. Log in with a deployment first or set CLOUDFLARE_API_TOKEN", err)
+        return nil, nil, false
+    }
+    fmt.Printf("%s Reading worker scripts, Pages projects and KV namespaces of account %s...\n", infoPrefix, shortAccount(api.accountID))
+    inv, err := api.collectInventory(records)
+    if err != nil {
+        failMessage("Could not list the account's resources", err)
+        return nil, nil, false
+    }
+    return api, inv, true
+}
+
+func runInventory(installDir string, args []string) {
+    fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+    asJSON := fs.Bool("json", false, "Print the inventory as JSON")
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    _, inv, ok := openInventory(installDir)
+    if !ok {
+        os.Exit(1)
+    }
+    if *asJSON {
+        data, err := json.MarshalIndent(inv, "", "  ")
+        if err != nil {
+            failMessage("Error encoding the inventory", err)
+            return
+        }
+        fmt.Println(string(data))
+        return
+    }
+    printInventory(inv)
+}
+
+func runPrune(installDir string, args []string) {
+    fs := flag.NewFlagSet("prune", flag.ExitOnError)
+    orphans := fs.Bool("orphans", false, "Remove orphan KV namespaces")
+    unknownPanels := fs.Bool("unknown-panels", false, "Also remove panels missing from the local records, with the namespaces only they use")
+    yes := fs.Bool("yes", false, "Do not ask for confirmation")
+    dryRun := fs.Bool("dry-run", false, "Only show what would be removed")
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if !*orphans {
+        failMessage("Usage: prune -orphans [-unknown-panels] [-dry-run] [-yes]", nil)
+        return
+    }
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    api, inv, ok := openInventory(installDir)
+    if !ok {
+        os.Exit(1)
+    }
+    targets := inv.pruneTargets(*unknownPanels)
+    if !*unknownPanels {
+        var unknown []string
+        for _, resource := range append(slices.Clone(inv.Workers), inv.Pages...) {
+            if resource.Status == statusUnknownPanel {
+                unknown = append(unknown, resource.Name)
+            }
+        }
+        if len(unknown) > 0 {
+            fmt.Printf("%s Left alone %d panel(s) missing from the local records: %s. They may have been deployed from another machine; record them with import <name>, or add -unknown-panels to delete them.\n", infoPrefix, len(unknown), strings.Join(unknown, ", "))
+        }
+    }
+    if len(targets) == 0 {
+        successMessage("Nothing to prune.")
+        return
+    }
+
+    fmt.Printf("\n%s These resources will be deleted from account %s:\n", warnPrefix, shortAccount(inv.AccountID))
+    for _, target := range targets {
+        fmt.Printf("  %-8s %s%-34s%s %s\n", target.Kind, cyan, target.Name, reset, target.ID)
+    }
+    if *dryRun || !confirmFleet(fmt.Sprintf("Delete %d resource(s)? This cannot be undone.", len(targets)), *yes) {
+        return
+    }
+
+    if err := startRunLog(installDir, os.Args); err != nil {
+        fmt.Printf("%s Warning: Could not start the run log: %v\n", warnPrefix, err)
+    }
+    defer finishRunLog()
+
+    // Panels go first so their namespaces are no longer bound.
+    results := make([]fleetResult, len(targets))
+    for i, target := range targets {
+        start := time.Now()
+        results[i] = fleetResult{Name: target.Name, Action: "delete " + target.Kind, Status: "deleted"}
+        if err := api.deleteResource(target); err != nil {
+            results[i].Status, results[i].Detail = "failed", redact(err.Error())
+        }
+        results[i].Seconds = time.Since(start).Seconds()
+    }
+    if failed := printFleetReport(results); failed > 0 {
+        finishRunLog()
+        os.Exit(1)
+    }
+}
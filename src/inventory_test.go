@@ -0,0 +1,124 @@
+package main
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func TestClassifyInventory(t *testing.T) {
+    workers := []cloudResource{
+        {Kind: "worker", Name: "known", KVIDs: []string{"kv-known"}, Vars: []string{"TR_PASS", "UUID"}, Panel: true},
+        {Kind: "worker", Name: "stray", KVIDs: []string{"kv-stray"}, Vars: []string{"TR_PASS", "UUID"}, Panel: true},
+        {Kind: "worker", Name: "blog"},
+    }
+    pages := []cloudResource{{Kind: "pages", Name: "known", Vars: []string{"UUID"}}}
+    kv := []cloudResource{
+        {Kind: "kv", Name: "panel_kv_known", ID: "kv-known"},
+        {Kind: "kv", Name: "panel_kv_stray", ID: "kv-stray"},
+        {Kind: "kv", Name: "panel_kv_left", ID: "kv-left"},
+        {Kind: "kv", Name: "cache", ID: "kv-cache"},
+    }
+    records := []Deployment{
+        {Name: "known", DeployType: "1", KVID: "kv-known", AccountID: "acc"},
+        {Name: "gone", DeployType: "1", AccountID: "acc"},
+        {Name: "elsewhere", DeployType: "1", AccountID: "other"},
+    }
+
+    inv := classifyInventory("acc", workers, pages, kv, records)
+    for i, want := range []string{statusRegistered, statusUnknownPanel, statusOther} {
+        if inv.Workers[i].Status != want {
+            t.Errorf("worker %s: %s, want %s", inv.Workers[i].Name, inv.Workers[i].Status, want)
+        }
+    }
+    if inv.Pages[0].Status != statusOther {
+        t.Errorf("a Pages project with a recorded worker's name was linked: %s", inv.Pages[0].Status)
+    }
+    for i, want := range []string{statusInUse, statusInUse, statusOrphan, statusUnused} {
+        if inv.KV[i].Status != want {
+            t.Errorf("namespace %s: %s, want %s", inv.KV[i].Name, inv.KV[i].Status, want)
+        }
+    }
+    if !slices.Equal(inv.Missing, []string{"gone"}) {
+        t.Errorf("records without a panel: %v", inv.Missing)
+    }
+
+    var names []string
+    for _, target := range inv.pruneTargets(false) {
+        names = append(names, target.Kind+":"+target.Name)
+    }
+    if !slices.Equal(names, []string{"kv:panel_kv_left"}) {
+        t.Errorf("prune targets: %v", names)
+    }
+    names = nil
+    for _, target := range inv.pruneTargets(true) {
+        names = append(names, target.Kind+":"+target.Name)
+    }
+    if !slices.Equal(names, []string{"worker:stray", "kv:panel_kv_stray", "kv:panel_kv_left"}) {
+        t.Errorf("prune targets with unknown panels: %v", names)
+    }
+}
+
+func TestCollectInventoryAndDelete(t *testing.T) {
+    var mu sync.Mutex
+    var deleted []string
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        if r.Method == http.MethodDelete {
+            mu.Lock()
+            deleted = append(deleted, r.URL.Path)
+            mu.Unlock()
+            io.WriteString(w, `{"success":true,"errors":[],"result":null}`)
+            return
+        }
+        switch {
+        case r.URL.Path == "/accounts/acc/workers/scripts":
+            io.WriteString(w, `{"success":true,"errors":[],"result":[{"id":"panel-one"},{"id":"site"}]}`)
+        case r.URL.Path == "/accounts/acc/workers/scripts/panel-one/settings":
+            io.WriteString(w, `{"success":true,"errors":[],"result":{"bindings":[{"name":"kv","type":"kv_namespace","namespace_id":"id1"},{"name":"UUID","type":"secret_text"},{"name":"TR_PASS","type":"plain_text","text":"x"}]}}`)
+        case r.URL.Path == "/accounts/acc/workers/scripts/site/settings":
+            io.WriteString(w, `{"success":true,"errors":[],"result":{"bindings":[]}}`)
+        case r.URL.Path == "/accounts/acc/pages/projects":
+            io.WriteString(w, `{"success":true,"errors":[],"result":[{"name":"pages-panel","deployment_configs":{"production":{"env_vars":{"UUID":{"type":"plain_text","value":"u"},"TR_PASS":{"type":"secret_text"}},"kv_namespaces":{"kv":{"namespace_id":"id2"}}}}}],"result_info":{"page":1,"total_pages":1}}`)
+        case r.URL.Path == "/accounts/acc/storage/kv/namespaces" && r.URL.Query().Get("page") == "1":
+            io.WriteString(w, `{"success":true,"errors":[],"result":[{"id":"id1","title":"panel_kv_one"}],"result_info":{"page":1,"total_pages":2}}`)
+        case r.URL.Path == "/accounts/acc/storage/kv/namespaces":
+            io.WriteString(w, `{"success":true,"errors":[],"result":[{"id":"id3","title":"panel_kv_old"}],"result_info":{"page":2,"total_pages":2}}`)
+        default:
+            writeNotFound(w, r.URL.Path)
+        }
+    }))
+    defer server.Close()
+    savedAPI := cloudflareAPI
+    cloudflareAPI = server.URL
+    defer func() { cloudflareAPI = savedAPI }()
+
+    api := &cloudflareClient{token: "test-token", accountID: "acc"}
+    inv, err := api.collectInventory([]Deployment{{Name: "pages-panel", DeployType: "2", KVID: "id2"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(inv.Workers) != 2 || !inv.Workers[0].Panel || inv.Workers[1].Panel {
+        t.Errorf("workers: %+v", inv.Workers)
+    }
+    if inv.Workers[0].Status != statusUnknownPanel || inv.Pages[0].Status != statusRegistered {
+        t.Errorf("statuses: worker %s, pages %s", inv.Workers[0].Status, inv.Pages[0].Status)
+    }
+    if len(inv.KV) != 2 || inv.KV[1].Status != statusOrphan {
+        t.Errorf("KV namespaces from both pages: %+v", inv.KV)
+    }
+
+    for _, target := range inv.pruneTargets(true) {
+        if err := api.deleteResource(target); err != nil {
+            t.Fatal(err)
+        }
+    }
+    want := []string{"/accounts/acc/workers/scripts/panel-one", "/accounts/acc/storage/kv/namespaces/id1", "/accounts/acc/storage/kv/namespaces/id3"}
+    if strings.Join(deleted, " ") != strings.Join(want, " ") {
+        t.Errorf("deleted %v, want %v", deleted, want)
+    }
+}
@@ -1,14 +1,12 @@
 package main
 
 import (
-    "bytes"
+    "crypto/rand"
     "encoding/json"
     "errors"
     "flag"
     "fmt"
-    "io"
-    "math/rand"
-    "net/http"
+    "math/big"
     "os"
     "os/exec"
     "path/filepath"
@@ -16,333 +14,403 @@ import (
     "strconv"
     "strings"
     "time"
-
-    "github.com/google/uuid"
 )
 
+const minNodeMajor = 20
+
 type KVNamespace struct {
     Title string `json:"title"`
     ID    string `json:"id"`
 }
 
 var (
-    kvID         string
-    projectName  string
-    customDomain string
-    deployType   string
-    UUID         string
-    TR_PASS      string
-    PROXY_IP     string
-    FALLBACK     string
-    SUB_PATH     string
-    red          = "\033[0;31m"
-    green        = "\033[0;32m"
-    yellow       = "\033[0;33m"
-    blue         = "\033[0;34m"
-    cyan         = "\033[0;36m"
-    reset        = "\033[0m"
-    bold         = "\033[1m"
-    titlePrefix  = bold + cyan + "◆" + reset
-    infoPrefix   = bold + blue + "❯" + reset
-    warnPrefix   = bold + yellow + "⚠" + reset
-    errorPrefix  = bold + red + "✗" + reset
-    successPrefix= bold + green + "✓" + reset
+    customDomain  string
+    deployType    string
+    version       = "dev"
+    commit        = "none"
+    workerVersion string
+    workerSHA256  string
+    workerFile    string
+    workerURLs    stringList
+    offlineMode   bool
+    allowNoDigest bool
+    red           = "\033[0;31m"
+    green         = "\033[0;32m"
+    yellow        = "\033[0;33m"
+    blue          = "\033[0;34m"
+    cyan          = "\033[0;36m"
+    reset         = "\033[0m"
+    bold          = "\033[1m"
+    titlePrefix   = bold + cyan + "◆" + reset
+    infoPrefix    = bold + blue + "❯" + reset
+    warnPrefix    = bold + yellow + "⚠" + reset
+    errorPrefix   = bold + red + "✗" + reset
+    successPrefix = bold + green + "✓" + reset
 )
 
 func main() {
+    if len(os.Args) > 1 {
+        switch os.Args[1] {
+        case "releases":
+            runReleases(os.Args[2:])
+            return
+        case "self-update":
+            runSelfUpdate(os.Args[2:])
+            return
+        case "install-deps":
+            runInstallDeps(os.Args[2:])
+            return
+        case "doctor":
+            runDoctor(os.Args[2:])
+            return
+        case "bug-report":
+            runBugReport(os.Args[2:])
+            return
+        case "preflight":
+            runPreflight(os.Args[2:])
+            return
+        case "cache":
+            installDir, err := getInstallDir()
+            if err != nil {
+                failMessage("Error getting home directory", err)
+                return
+            }
+            runCache(installDir, os.Args[2:])
+            return
+        case "vault":
+            installDir, err := getInstallDir()
+            if err != nil {
+                failMessage("Error getting home directory", err)
+                return
+            }
+            runVault(installDir, os.Args[2:])
+            return
+        case "logs":
+            installDir, err := getInstallDir()
+            if err != nil {
+                failMessage("Error getting home directory", err)
+                return
+            }
+            runLogs(installDir, os.Args[2:])
+            return
+        case "fleet":
+            installDir, err := getInstallDir()
+            if err != nil {
+                failMessage("Error getting home directory", err)
+                return
+            }
+            runFleet(installDir, os.Args[2:])
+            return
+        case "status", "diff":
+            installDir, err := getInstallDir()
+            if err != nil {
+                failMessage("Error getting home directory", err)
+                return
+            }
+            if os.Args[1] == "status" {
+                runStatus(installDir, os.Args[2:])
+            } else {
+                runDiff(installDir, os.Args[2:])
+            }
+            return
+        case "inventory", "prune":
+            installDir, err := getInstallDir()
+            if err != nil {
+                failMessage("Error getting home directory", err)
+                return
+            }
+            if os.Args[1] == "inventory" {
+                runInventory(installDir, os.Args[2:])
+            } else {
+                runPrune(installDir, os.Args[2:])
+            }
+            return
+        case "import":
+            installDir, err := getInstallDir()
+            if err != nil {
+                failMessage("Error getting home directory", err)
+                return
+            }
+            runImport(installDir, os.Args[2:])
+            return
+        case "deploy":
+            os.Args = append(os.Args[:1], os.Args[2:]...)
+        }
+    }
+
     var deployFlag string
+    var showVersion bool
+    flag.BoolVar(&showVersion, "version", false, "Print the wizard version and exit")
     flag.StringVar(&deployFlag, "deploy", "1", "Deployment type: 1 for Workers, 2 for Pages")
+    flag.StringVar(&workerVersion, "worker-version", workerLatestTag, "BPB-Worker-Panel release tag to deploy, e.g. v3.0.0 (default: latest)")
+    flag.StringVar(&workerSHA256, "worker-sha256", "", "Expected SHA-256 digest of worker.js (overrides the digest published for the release)")
+    flag.StringVar(&workerFile, "worker-file", "", "Deploy a local worker.js/_worker.js file instead of downloading one")
+    flag.Var(&workerURLs, "worker-url", "Download worker.js from this URL (fork or mirror); repeat or comma-separate to try several in order")
+    flag.StringVar(&wranglerVersionFlag, "wrangler-version", "", "Override the tested Wrangler version installed into the install directory (for testing)")
+    flag.BoolVar(&offlineMode, "offline", false, "Use only the local worker cache, never download worker.js")
+    flag.BoolVar(&allowNoDigest, "allow-unverified", false, "Deploy the latest or a -worker-url worker.js even when no SHA-256 digest is available to check it against")
+    flag.BoolVar(&verboseMode, "verbose", false, "Print every command, API request and retry from the run log as it happens")
+    flag.BoolVar(&showSecrets, "show-secrets", false, "Print the generated UUID, Trojan password and subscription path once after a successful deployment")
+    flag.BoolVar(&secretsMode, "secrets-mode", false, "Upload UUID, TR_PASS and SUB_PATH as encrypted Worker/Pages secrets instead of plain-text vars")
+    flag.StringVar(&namePrefix, "name-prefix", "", "Start generated worker names with this prefix, e.g. panel")
+    flag.StringVar(&nameStyle, "name-style", nameStyle, "Generated name style: random (gibberish) or words (e.g. calm-river-42)")
+    flag.StringVar(&nameTemplate, "name-template", "", "Name template using {prefix}, {adj}, {noun}, {rand:N} and {num:N}, e.g. {prefix}-{rand:6}")
+    flag.StringVar(&configPath, "config", "", "Read deployment settings from this YAML or JSON file")
+    flag.StringVar(&profileName, "profile", "", "Use this named profile from the config file")
+    flag.Var(&deployTags, "tag", "Tag the deployed panels for fleet commands; repeat or comma-separate")
+    flag.IntVar(&batchCount, "count", 1, "Deploy this many panels in one run (for each profile given with -profiles)")
+    flag.Var(&batchProfiles, "profiles", "Deploy one panel for each of these config profiles; repeat or comma-separate")
+    flag.IntVar(&batchConcurrency, "concurrency", batchConcurrency, "Number of panels deployed at the same time in a batch")
+    flag.BoolVar(&sharedKV, "shared-kv", false, "Let all panels of a batch share one KV namespace")
+    flag.StringVar(&batchResultsPath, "results", "", "Export batch results to this .json or .csv file, or to <path>.json and <path>.csv (default: install directory)")
+    addNetworkFlags(flag.CommandLine)
     flag.Parse()
 
-    if deployFlag != "1" && deployFlag != "2" {
-        failMessage("Invalid deploy type. Use -deploy=1 for Workers or -deploy=2 for Pages.", nil)
+    if showVersion {
+        fmt.Println(versionString())
         return
     }
-    deployType = deployFlag
 
-    homeDir, err := os.UserHomeDir()
-    if err != nil {
-        failMessage("Error getting home directory", err)
+    for _, tag := range deployTags {
+        if !tagRe.MatchString(tag) {
+            failMessage(fmt.Sprintf("Invalid tag %q. Use lowercase letters, digits, hyphens and underscores.", tag), nil)
+            return
+        }
+    }
+    if batchCount < 1 || batchCount > maxBatchCount {
+        failMessage(fmt.Sprintf("Invalid -count value. Deploy between 1 and %d panels per run.", maxBatchCount), nil)
+        return
+    }
+    if batchConcurrency < 1 || batchConcurrency > maxBatchConcurrency {
+        failMessage(fmt.Sprintf("Invalid -concurrency value. Use a number between 1 and %d.", maxBatchConcurrency), nil)
+        return
+    }
+    if profileName != "" && len(batchProfiles) > 0 {
+        failMessage("Use either -profile or -profiles, not both.", nil)
         return
     }
-    installDir := filepath.Join(homeDir, ".bpb-terminal-wizard")
-    wranglerConfigPath := filepath.Join(installDir, "wrangler.json")
-    workerURL := "https://github.com/bia-pain-bache/BPB-Worker-Panel/releases/latest/download/worker.js"
-    srsPath := filepath.Join(installDir, "src")
 
-    if _, err := os.Stat(wranglerConfigPath); !errors.Is(err, os.ErrNotExist) {
-        if err := os.Remove(wranglerConfigPath); err != nil {
-            failMessage("Error deleting old worker config.", err)
-            return
+    explicit := map[string]bool{}
+    flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+    var profiles []*panelProfile
+    if configPath != "" || profileName != "" || len(batchProfiles) > 0 {
+        if configPath == "" {
+            installDir, err := getInstallDir()
+            if err == nil {
+                configPath, err = findConfigFile(installDir)
+            }
+            if err != nil {
+                failMessage("Cannot load profiles", err)
+                return
+            }
+        }
+        names := []string(batchProfiles)
+        if len(names) == 0 {
+            names = []string{profileName}
+        }
+        for _, name := range names {
+            profile, err := loadConfig(configPath, name)
+            if err != nil {
+                failMessage("Invalid config file", err)
+                return
+            }
+            profiles = append(profiles, profile)
+        }
+        if len(batchProfiles) == 0 {
+            applyProfile(profiles[0], explicit, &deployFlag)
+            profiles = nil
         }
+        fmt.Printf("%s Using settings from %s%s%s\n", infoPrefix, cyan, configPath, reset)
     }
+    batchMode := batchCount > 1 || len(profiles) > 0
 
-    if err := os.RemoveAll(srsPath); err != nil {
-        failMessage("Error deleting old worker.js file.", err)
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
         return
     }
 
-    if err := os.MkdirAll(installDir, 0750); err != nil {
-        failMessage("Error creating install directory", err)
+    if wranglerVersionFlag != "" && !isValidWranglerVersion(wranglerVersionFlag) {
+        failMessage("Invalid -wrangler-version value. Use an exact version such as 4.20.0.", nil)
         return
     }
 
-    fmt.Printf("\n%s Installing %sBPB Terminal Wizard%s...\n", titlePrefix, bold+blue, reset)
-
-    if err := checkNode(); err != nil {
-        failMessage("Node.js is not installed or version is too old. Please ensure Node.js v18 or higher is installed.", err)
+    if err := checkWorkerFlags(); err != nil {
+        failMessage(err.Error(), nil)
         return
     }
 
-    if err := checkNpm(); err != nil {
-        failMessage("npm is not installed or not working. Please ensure npm is installed.", err)
+    if deployFlag != "1" && deployFlag != "2" {
+        failMessage("Invalid deploy type. Use -deploy=1 for Workers or -deploy=2 for Pages.", nil)
         return
     }
+    deployType = deployFlag
 
-    fmt.Printf("%s Installing Wrangler...\n", infoPrefix)
-    if err := checkWrangler(); err != nil {
-        failMessage("Wrangler is not installed or not working. Please ensure Wrangler is installed.", err)
+    if _, err := newNameGenerator(deployType); err != nil {
+        failMessage("Invalid naming options", err)
         return
     }
-    if _, err := runCommand(installDir, "npm cache clean --force", 1); err != nil {
-        fmt.Printf("%s Warning: Could not clean npm cache, continuing anyway...\n", warnPrefix)
-    }
-    output, err := runCommand(installDir, "npx wrangler --version", 1)
+
+    installDir, err := getInstallDir()
     if err != nil {
-        failMessage("Failed to verify Wrangler installation", fmt.Errorf("output: %s, error: %v", output, err))
+        failMessage("Error getting home directory", err)
         return
     }
-
-    successMessage("BPB Terminal Wizard dependencies are ready!")
-
-    fmt.Printf("\n%s Starting Cloudflare login process...\n", titlePrefix)
-    for {
-        cmd := exec.Command("sh", "-c", "npx wrangler login")
-        cmd.Dir = installDir
-        var stdoutBuf bytes.Buffer
-        cmd.Stdout = &stdoutBuf
-        cmd.Stderr = os.Stderr
-        cmd.Stdin = os.Stdin
-        if err := cmd.Start(); err != nil {
-            failMessage("Error starting Cloudflare login", err)
-            continue
-        }
-
-        timeout := time.After(60 * time.Second)
-        ticker := time.NewTicker(1 * time.Second)
-        defer ticker.Stop()
-
-        var oauthURL string
-        for {
-            select {
-            case <-timeout:
-                fmt.Printf("%s Debug: Wrangler output: %s\n", infoPrefix, stdoutBuf.String())
-                failMessage("Timeout waiting for OAuth URL", nil)
-                return
-            case <-ticker.C:
-                oauthURL, err = extractOAuthURL(stdoutBuf.String())
-                if err == nil {
-                    fmt.Printf("%s Found OAuth URL: %s%s%s\n", infoPrefix, blue, oauthURL, reset)
-                    if err := openURL(oauthURL); err != nil {
-                        fmt.Printf("%s Could not open browser automatically.\nPlease open this URL manually: %s%s%s\n", warnPrefix, blue, oauthURL, reset)
-                    } else {
-                        fmt.Printf("%s Browser opened with URL: %s%s%s\n", infoPrefix, blue, oauthURL, reset)
-                    }
-                    goto FoundURL
-                }
-            }
-        }
-    FoundURL:
-
-        if err := cmd.Wait(); err != nil {
-            failMessage("Error logging into Cloudflare", err)
-            continue
-        }
-
-        if _, err := runCommand(installDir, "npx wrangler telemetry disable", 1); err != nil {
-            fmt.Printf("%s Warning: Could not disable telemetry, continuing anyway...\n", warnPrefix)
-        }
-
-        successMessage("Successfully logged into Cloudflare!")
-        break
+    if err := os.MkdirAll(installDir, 0700); err != nil {
+        failMessage("Error creating install directory", err)
+        return
     }
-
-    fmt.Printf("\n%s Configuring Worker settings...\n", titlePrefix)
-
-    fmt.Printf("\n%s Using deployment type: %s%s%s\n", infoPrefix, bold+green, map[string]string{"1": "Workers", "2": "Pages"}[deployType], reset)
-    if deployType == "2" {
-        fmt.Printf("%s With %sPages%s, you cannot modify settings later from Cloudflare dashboard.\n", warnPrefix, bold+green, reset)
-        fmt.Printf("%s With %sPages%s, it may take up to 5 minutes to access the panel.\n", warnPrefix, bold+green, reset)
+    if err := startRunLog(installDir, os.Args); err != nil {
+        fmt.Printf("%s Warning: Could not start the run log: %v\n", warnPrefix, err)
     }
+    defer finishRunLog()
 
-    for {
-        projectName = generateRandomDomain(32)
-        fmt.Printf("\n%s Generated worker name (%sSubdomain%s): %s%s%s\n", infoPrefix, bold+green, reset, cyan, projectName, reset)
-        successMessage("Using generated worker name.")
+    fmt.Printf("\n%s Installing %sBPB Terminal Wizard%s...\n", titlePrefix, bold+blue, reset)
 
-        fmt.Printf("\n%s Checking domain availability...\n", infoPrefix)
-        if resp := isWorkerAvailable(installDir, projectName, deployType); resp {
-            continue
+    if proxyFlag != "" || dohFlag != "" {
+        logStep("preflight")
+        fmt.Printf("\n%s Checking connectivity through the configured network path...\n", titlePrefix)
+        if !runConnectivityPreflight() {
+            fmt.Printf("%s Some endpoints are unreachable, the deployment may fail.\n", warnPrefix)
         }
-        successMessage("Domain is available!")
-        break
     }
 
-    UUID = uuid.NewString()
-    fmt.Printf("\n%s Generated %sUUID%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, UUID, reset)
-    successMessage("Using generated UUID.")
-
-    TR_PASS = generateTrPassword(12)
-    fmt.Printf("\n%s Generated %sTrojan password%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, TR_PASS, reset)
-    successMessage("Using generated Trojan password.")
-
-    PROXY_IP = "bpb.yousef.isegaro.com"
-    fmt.Printf("\n%s Default %sProxy IP%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, PROXY_IP, reset)
-    successMessage("Using default Proxy IP.")
-
-    FALLBACK = "speed.cloudflare.com"
-    fmt.Printf("\n%s Default %sFallback domain%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, FALLBACK, reset)
-    successMessage("Using default Fallback domain.")
-
-    SUB_PATH = generateSubURIPath(16)
-    fmt.Printf("\n%s Generated %sSubscription path%s: %s%s%s\n", infoPrefix, bold+green, reset, cyan, SUB_PATH, reset)
-    successMessage("Using generated Subscription path.")
-
-    fmt.Printf("\n%s Downloading %sworker.js%s...\n", titlePrefix, bold+green, reset)
-    if err := os.Mkdir(srsPath, 0750); err != nil {
-        failMessage("Could not create src directory", err)
+    if !prepareDependencies(installDir) {
         return
     }
 
-    var workerPath = filepath.Join(srsPath, "worker.js")
-    if deployType == "2" {
-        workerPath = filepath.Join(srsPath, "_worker.js")
+    logStep("vault")
+    if err := ensureVault(installDir); err != nil {
+        failMessage("Cannot open the credentials vault, refusing to deploy without a place to save the panel credentials", err)
+        return
     }
-    for attempt := 1; attempt <= 3; attempt++ {
-        if err := downloadFile(workerURL, workerPath, 3); err == nil {
-            successMessage("Worker downloaded successfully!")
-            break
-        }
-        if attempt < 3 {
-            fmt.Printf("%s Retrying download in 5 seconds...\n", infoPrefix)
-            time.Sleep(5 * time.Second)
-        } else {
-            failMessage("Failed to download worker.js after multiple attempts.", err)
-            return
-        }
+
+    backend := newWranglerBackend(installDir)
+    if err := loginCloudflare(backend); err != nil {
+        return
     }
 
-    fmt.Printf("\n%s This program creates a new KV namespace each time it runs.\n   Check your Cloudflare account and delete unused KV namespaces to avoid limits.\n", warnPrefix)
-    fmt.Printf("\n%s Creating KV namespace...\n", titlePrefix)
-    for attempt := 1; attempt <= 3; attempt++ {
-        kvName := fmt.Sprintf("panel_kv_%s", generateRandomString("abcdefghijklmnopqrstuvwxyz0123456789", 8, false))
-        output, err := runCommand(installDir, fmt.Sprintf("npx wrangler kv namespace create %s", kvName), 3)
-        if err != nil {
-            message := fmt.Sprintf("Error creating KV on attempt %d! Output: %s. Check logs at ~/.config/.wrangler/logs/ for details.", attempt, output)
-            if strings.Contains(output, "fetch failed") && attempt < 3 {
-                fmt.Printf("%s Retrying after 5 seconds...\n", infoPrefix)
-                time.Sleep(5 * time.Second)
-                continue
-            }
-            failMessage(message, err)
-            continue
+    if batchMode {
+        results := deployBatch(installDir, backend, profiles, explicit)
+        printBatchSummary(results)
+        path := batchResultsPath
+        if path == "" {
+            path = defaultBatchResultsPath(installDir)
         }
-
-        id, err := extractKvID(output)
+        paths, err := writeBatchResults(path, results)
         if err != nil {
-            message := fmt.Sprintf("Error getting KV ID! Output: %s. Check logs at ~/.config/.wrangler/logs/ for details.", output)
-            failMessage(message, err)
-            continue
+            fmt.Printf("%s Warning: Could not export batch results: %v\n", warnPrefix, err)
+            return
+        }
+        fmt.Printf("%s Results saved to %s%s%s\n", infoPrefix, cyan, strings.Join(paths, ", "), reset)
+        if !showSecrets {
+            fmt.Printf("%s Credentials are not included in the results. Run with -show-secrets or use vault export to see them.\n", infoPrefix)
         }
-
-        kvID = id
-        break
-    }
-    if kvID == "" {
-        failMessage("Failed to create KV namespace after multiple attempts.", nil)
         return
     }
-    successMessage("KV namespace created successfully!")
 
-    fmt.Printf("\n%s Building panel configuration...\n", titlePrefix)
-    if err := buildWranglerConfig(wranglerConfigPath); err != nil {
-        failMessage("Error building Wrangler configuration", err)
+    deployment, err := deployPanel(installDir, backend)
+    if err != nil {
         return
     }
-    successMessage("Panel configuration built successfully!")
 
-    var panelURL string
-    for attempt := 1; attempt <= 3; attempt++ {
-        fmt.Printf("\n%s Deploying %sBPB Panel%s (Attempt %d)...\n", titlePrefix, bold+blue, reset, attempt)
-        if deployType == "1" {
-            output, err := runCommand(installDir, "npx wrangler deploy ./src/worker.js", 3)
-            if err != nil {
-                failMessage(fmt.Sprintf("Error deploying Panel! Output: %s", output), err)
-                if attempt < 3 {
-                    fmt.Printf("%s Retrying deployment in 5 seconds...\n", infoPrefix)
-                    time.Sleep(5 * time.Second)
-                }
-                continue
-            }
+    fmt.Printf("\n%s Panel installed successfully!\n%s Access it at: %s%s%s\n%s Worker: %s%s%s from %s\n%s Copy this URL and open it in your browser to access the BPB Panel.\n", successPrefix, infoPrefix, blue, deployment.PanelURL, reset, infoPrefix, cyan, deployment.WorkerVersion, reset, deployment.WorkerSource, infoPrefix)
+    printCredentials(deployment)
+}
 
-            successMessage("Panel deployed successfully!")
-            url, err := extractURL(output)
-            if err != nil {
-                failMessage("Error getting URL", err)
-                return
-            }
-            panelURL = url + "/panel"
-            break
+// checkWorkerFlags validates the flags that choose which worker.js is
+// deployed.
+func checkWorkerFlags() error {
+    if workerFile != "" && len(workerURLs) > 0 {
+        return errors.New("Use either -worker-file or -worker-url, not both.")
+    }
+    if offlineMode && len(workerURLs) > 0 {
+        return errors.New("-offline cannot be combined with -worker-url.")
+    }
+    for _, workerURL := range workerURLs {
+        if !isValidWorkerURL(workerURL) {
+            return fmt.Errorf("Invalid worker URL %q. Use a full http(s) URL.", workerURL)
         }
+    }
+    if workerSHA256 != "" && !isValidSHA256(workerSHA256) {
+        return errors.New("Invalid -worker-sha256 value. It must be a 64-character hex SHA-256 digest.")
+    }
+    if workerVersion != workerLatestTag && !isValidReleaseTag(workerVersion) {
+        return fmt.Errorf("Invalid worker version %q. Use a release tag such as v3.0.0, or run the releases command to list them.", workerVersion)
+    }
+    return nil
+}
 
-        if _, err := runCommand(installDir, fmt.Sprintf("npx wrangler pages project create %s --production-branch production", projectName), 3); err != nil {
-            failMessage("Error creating Pages project", err)
-            if attempt < 3 {
-                fmt.Printf("%s Retrying in 5 seconds...\n", infoPrefix)
-                time.Sleep(5 * time.Second)
-            }
-            continue
-        }
+// prepareDependencies checks Node.js and npm and installs the pinned
+// Wrangler into installDir. It reports failures itself.
+func prepareDependencies(installDir string) bool {
+    logStep("dependencies")
+    if err := checkNode(); err != nil {
+        failMessage(fmt.Sprintf("Node.js is not installed or version is too old. Please ensure Node.js v%d or higher is installed, or run install-deps.", minNodeMajor), err)
+        return false
+    }
 
-        _, err := runCommand(installDir, "npx wrangler pages deploy --commit-dirty true --branch production", 3)
-        if err != nil {
-            failMessage("Error deploying Panel", err)
-            if attempt < 3 {
-                fmt.Printf("%s Retrying deployment in 5 seconds...\n", infoPrefix)
-                time.Sleep(5 * time.Second)
-            }
-            continue
-        }
+    if err := checkNpm(); err != nil {
+        failMessage("npm is not installed or not working. Please ensure npm is installed, or run install-deps.", err)
+        return false
+    }
 
-        successMessage("Panel deployed successfully!")
-        panelURL = "https://" + projectName + ".pages.dev/panel"
-        break
+    fmt.Printf("%s Installing Wrangler...\n", infoPrefix)
+    if err := ensureLocalWrangler(installDir); err != nil {
+        failMessage("Could not install Wrangler. Check your network connection, or run install-deps.", err)
+        return false
+    }
+    output, err := runCommand(installDir, wranglerCommand(installDir, "--version"), 1)
+    if err != nil {
+        failMessage("Failed to verify Wrangler installation", fmt.Errorf("output: %s, error: %v", output, err))
+        return false
     }
 
-    if panelURL == "" {
-        failMessage("Failed to deploy panel after multiple attempts.", nil)
+    successMessage("BPB Terminal Wizard dependencies are ready!")
+    return true
+}
+
+// printCredentials is the only place generated credentials are printed in
+// clear text, and only when -show-secrets was given.
+func printCredentials(deployment *Deployment) {
+    if !showSecrets {
+        fmt.Printf("%s Credentials are hidden in this output and saved in the vault. Run with -show-secrets or use vault export to see them.\n", infoPrefix)
         return
     }
+    fmt.Printf("\n%s Panel credentials (shown once, keep them private):\n", warnPrefix)
+    fmt.Printf("   %sUUID%s: %s%s%s\n", bold+green, reset, cyan, deployment.UUID, reset)
+    fmt.Printf("   %sTrojan password%s: %s%s%s\n", bold+green, reset, cyan, deployment.TrPass, reset)
+    fmt.Printf("   %sSubscription path%s: %s%s%s\n", bold+green, reset, cyan, deployment.SubPath, reset)
+}
 
-    fmt.Printf("\n%s Panel installed successfully!\n%s Access it at: %s%s%s\n%s Copy this URL and open it in your browser to access the BPB Panel.\n", successPrefix, infoPrefix, blue, panelURL, reset, infoPrefix)
+func getInstallDir() (string, error) {
+    homeDir, err := os.UserHomeDir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(homeDir, ".bpb-terminal-wizard"), nil
 }
 
-func checkNode() error {
+func nodeMajorVersion() (int, error) {
     output, err := exec.Command("node", "-v").Output()
     if err != nil {
-        return fmt.Errorf("Node.js is not installed or not working: %v", err)
+        return 0, fmt.Errorf("Node.js is not installed or not working: %v", err)
     }
-    version := strings.TrimPrefix(string(output), "v")
+    version := strings.TrimSpace(strings.TrimPrefix(string(output), "v"))
     versionParts := strings.Split(version, ".")
-    if len(versionParts) < 1 {
-        return fmt.Errorf("invalid Node.js version format: %s", version)
-    }
     major, err := strconv.Atoi(versionParts[0])
     if err != nil {
-        return fmt.Errorf("cannot parse Node.js major version: %v", err)
+        return 0, fmt.Errorf("cannot parse Node.js major version: %v", err)
     }
-    if major < 18 {
-        return fmt.Errorf("Node.js version %s is too old, requires v18 or higher", version)
+    return major, nil
+}
+
+func checkNode() error {
+    major, err := nodeMajorVersion()
+    if err != nil {
+        return err
+    }
+    if major < minNodeMajor {
+        return fmt.Errorf("Node.js version %d is too old, requires v%d or higher", major, minNodeMajor)
     }
     return nil
 }
@@ -355,36 +423,16 @@ func checkNpm() error {
     return nil
 }
 
-func checkWrangler() error {
-    _, err := exec.Command("npx", "wrangler", "--version").Output()
+func checkWrangler(installDir string) error {
+    cmd := exec.Command(localWranglerBin(installDir), "--version")
+    cmd.Env = commandEnv()
+    _, err := cmd.Output()
     if err != nil {
         return fmt.Errorf("Wrangler is not installed or not working: %v", err)
     }
     return nil
 }
 
-func runCommand(cmdDir string, command string, retries int) (string, error) {
-    for attempt := 1; attempt <= retries; attempt++ {
-        cmd := exec.Command("sh", "-c", command)
-        cmd.Dir = cmdDir
-        var stdoutBuf, stderrBuf bytes.Buffer
-        cmd.Stdout = &stdoutBuf
-        cmd.Stderr = &stderrBuf
-        err := cmd.Run()
-        output := stdoutBuf.String() + stderrBuf.String()
-        if err == nil {
-            return output, nil
-        }
-        if attempt < retries {
-            fmt.Printf("%s Retrying command after error: %v\n", warnPrefix, err)
-            time.Sleep(5 * time.Second)
-        } else {
-            return output, fmt.Errorf("command failed after %d attempts: %v", retries, err)
-        }
-    }
-    return "", fmt.Errorf("unexpected error in runCommand")
-}
-
 func isValidDomain(domain string) bool {
     re, err := regexp.Compile(`^([a-zA-Z0-9-]+\.)+[a-zA-Z]{2,}$`)
     if err != nil {
@@ -393,12 +441,23 @@ func isValidDomain(domain string) bool {
     return re.MatchString(domain)
 }
 
+// randomIndex returns a uniform index below n from crypto/rand, whose
+// reader does not fail since Go 1.24.
+func randomIndex(n int) int {
+    i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+    if err != nil {
+        panic(err)
+    }
+    return int(i.Int64())
+}
+
+// generateRandomString draws from crypto/rand: the results become panel
+// credentials.
 func generateRandomString(charSet string, length int, isDomain bool) string {
-    r := rand.New(rand.NewSource(time.Now().UnixNano()))
     randomBytes := make([]byte, length)
     for i := range randomBytes {
         for {
-            char := charSet[r.Intn(len(charSet))]
+            char := charSet[randomIndex(len(charSet))]
             if isDomain && (i == 0 || i == length-1) && char == byte('-') {
                 continue
             }
@@ -412,11 +471,6 @@ func generateRandomString(charSet string, length int, isDomain bool) string {
     return string(randomBytes)
 }
 
-func generateRandomDomain(subDomainLength int) string {
-    const charset = "abcdefghijklmnopqrstuvwxyz0123456789-"
-    return generateRandomString(charset, subDomainLength, true)
-}
-
 func generateTrPassword(passwordLength int) string {
     const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!@#$%^&*()_+[]{}|;:',.<>?"
     return generateRandomString(charset, passwordLength, false)
@@ -427,17 +481,6 @@ func generateSubURIPath(uriLength int) string {
     return generateRandomString(charset, uriLength, false)
 }
 
-func isWorkerAvailable(installDir, projectName, deployType string) bool {
-    var command string
-    if deployType == "1" {
-        command = fmt.Sprintf("npx wrangler deployments list --name %s", projectName)
-    } else {
-        command = fmt.Sprintf("npx wrangler pages deployment list --project-name %s", projectName)
-    }
-    _, err := runCommand(installDir, command, 1)
-    return err == nil
-}
-
 func extractURL(output string) (string, error) {
     re, err := regexp.Compile(`https?://[^\s]+`)
     if err != nil {
@@ -462,54 +505,58 @@ func extractOAuthURL(output string) (string, error) {
     return matches[0], nil
 }
 
-func openURL(url string) error {
-    var cmd *exec.Cmd
-    if _, err := os.Stat("/data/data/com.termux"); err == nil {
-        cmd = exec.Command("termux-open-url", url)
-        cmd.Env = append(os.Environ(), "TERMUX_API_VERSION=0.50")
-    } else {
-        cmd = exec.Command("xdg-open", url)
+// wranglerConfig is the configuration deployed for a panel. Records from
+// before the compatibility date was recorded get yesterday's date.
+func wranglerConfig(deployment *Deployment) map[string]any {
+    compatibilityDate := deployment.CompatibilityDate
+    if compatibilityDate == "" {
+        compatibilityDate = time.Now().AddDate(0, 0, -1).Format("2006-01-02")
     }
-    return cmd.Run()
-}
-
-func buildWranglerConfig(filePath string) error {
     config := map[string]any{
-        "name":                projectName,
-        "compatibility_date":  time.Now().AddDate(0, 0, -1).Format("2006-01-02"),
+        "name":                deployment.Name,
+        "compatibility_date":  compatibilityDate,
         "compatibility_flags": []string{"nodejs_compat"},
         "kv_namespaces": []map[string]string{
             {
                 "binding": "kv",
-                "id":      kvID,
+                "id":      deployment.KVID,
             },
         },
-        "vars": map[string]string{
-            "UUID":     UUID,
-            "TR_PASS":  TR_PASS,
-            "PROXY_IP": PROXY_IP,
-            "FALLBACK": FALLBACK,
-            "SUB_PATH": SUB_PATH,
-        },
     }
-    if deployType == "1" {
+    vars := map[string]string{}
+    for name, value := range deployment.Vars {
+        vars[name] = value
+    }
+    vars["PROXY_IP"] = deployment.ProxyIP
+    vars["FALLBACK"] = deployment.Fallback
+    if !deployment.SecretsMode {
+        for name, value := range panelSecrets(deployment) {
+            vars[name] = value
+        }
+    }
+    config["vars"] = vars
+    if deployment.DeployType == "1" {
         config["main"] = "./src/worker.js"
         config["workers_dev"] = true
     } else {
         config["pages_build_output_dir"] = "./src/"
     }
-    if customDomain != "" {
+    if deployment.CustomDomain != "" {
         config["routes"] = []map[string]any{
             {
-                "route": customDomain,
+                "route": deployment.CustomDomain,
             },
         }
     }
-    jsonData, err := json.MarshalIndent(config, "", "  ")
+    return config
+}
+
+func buildWranglerConfig(filePath string, deployment *Deployment) error {
+    jsonData, err := json.MarshalIndent(wranglerConfig(deployment), "", "  ")
     if err != nil {
         return fmt.Errorf("error marshaling config to JSON: %v", err)
     }
-    if err = os.WriteFile(filePath, jsonData, 0644); err != nil {
+    if err = os.WriteFile(filePath, jsonData, 0600); err != nil {
         return fmt.Errorf("error writing JSON to file: %v", err)
     }
     return nil
@@ -527,51 +574,14 @@ func extractKvID(output string) (string, error) {
     return "", fmt.Errorf("no valid ID found in output")
 }
 
-func downloadFile(url, dest string, retries int) error {
-    for attempt := 1; attempt <= retries; attempt++ {
-        resp, err := http.Get(url)
-        if err != nil {
-            if attempt < retries {
-                fmt.Printf("%s Retrying download after error: %v\n", warnPrefix, err)
-                time.Sleep(5 * time.Second)
-                continue
-            }
-            return fmt.Errorf("error making GET request after %d attempts: %v", retries, err)
-        }
-        defer resp.Body.Close()
-        if resp.StatusCode != http.StatusOK {
-            if attempt < retries {
-                fmt.Printf("%s Retrying download after HTTP %d\n", warnPrefix, resp.StatusCode)
-                time.Sleep(5 * time.Second)
-                continue
-            }
-            return fmt.Errorf("failed to download file after %d attempts: %s (HTTP %d)", retries, url, resp.StatusCode)
-        }
-        out, err := os.Create(dest)
-        if err != nil {
-            return fmt.Errorf("error creating file: %v", err)
-        }
-        defer out.Close()
-        if _, err = io.Copy(out, resp.Body); err != nil {
-            if attempt < retries {
-                fmt.Printf("%s Retrying download after write error: %v\n", warnPrefix, err)
-                time.Sleep(5 * time.Second)
-                continue
-            }
-            return fmt.Errorf("error writing to file after %d attempts: %v", retries, err)
-        }
-        return nil
-    }
-    return fmt.Errorf("unexpected error in downloadFile")
-}
-
 func failMessage(message string, err error) {
     if err != nil {
         message += ": " + err.Error()
     }
-    fmt.Printf("%s %s\n", errorPrefix, message)
+    logMessage("error", message)
+    fmt.Printf("%s %s\n", errorPrefix, redact(message))
 }
 
 func successMessage(message string) {
-    fmt.Printf("%s %s\n", successPrefix, message)
+    fmt.Printf("%s %s\n", successPrefix, redact(message))
 }
\ No newline at end of file
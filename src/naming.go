@@ -0,0 +1,217 @@
+package main
+
+import (
+    "fmt"
+    "math/rand"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+const (
+    nameBatchSize  = 4
+    maxNameBatches = 5
+)
+
+var (
+    namePrefix   string
+    nameStyle    = "random"
+    nameTemplate string
+)
+
+var nameStyles = map[string]string{
+    "random": "{rand:32}",
+    "words":  "{adj}-{noun}-{num:2}",
+}
+
+var prefixedNameStyles = map[string]string{
+    "random": "{prefix}-{rand:8}",
+    "words":  "{prefix}-{adj}-{noun}-{num:2}",
+}
+
+var nameAdjectives = []string{
+    "amber", "bold", "brave", "bright", "calm", "clear", "cool", "crisp",
+    "daring", "deep", "eager", "early", "fair", "fancy", "fast", "fine",
+    "fresh", "gentle", "glad", "golden", "grand", "green", "happy", "kind",
+    "light", "lively", "lucky", "mellow", "merry", "mild", "misty", "noble",
+    "quick", "quiet", "rapid", "rare", "royal", "shiny", "silent", "silver",
+    "simple", "smart", "snowy", "solid", "sunny", "swift", "tidy", "vivid",
+    "warm", "wild", "wise", "young",
+}
+
+var nameNouns = []string{
+    "breeze", "brook", "canyon", "cedar", "cliff", "cloud", "comet", "coral",
+    "creek", "dawn", "delta", "dune", "ember", "falcon", "field", "forest",
+    "garden", "glade", "grove", "harbor", "hill", "island", "lake", "leaf",
+    "maple", "meadow", "mesa", "moon", "oasis", "ocean", "orbit", "otter",
+    "peak", "pine", "planet", "pond", "prairie", "rain", "reef", "ridge",
+    "river", "rock", "shore", "sky", "spring", "star", "stone", "storm",
+    "summit", "sun", "tide", "trail", "valley", "wave", "willow", "wind",
+}
+
+// reservedNames are rejected by Cloudflare or would be confusing as a
+// workers.dev or pages.dev subdomain.
+var reservedNames = map[string]bool{
+    "www": true, "api": true, "admin": true, "dash": true, "workers": true,
+    "pages": true, "cloudflare": true, "mail": true, "ftp": true, "localhost": true,
+}
+
+var (
+    nameCharsRe     = regexp.MustCompile(`^[a-z0-9-]+$`)
+    nameTemplateRe  = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+    nameTemplateEnd = regexp.MustCompile(`[{}]`)
+)
+
+func validateWorkerName(name, deployType string) error {
+    maxLength := 63
+    if deployType == "2" {
+        maxLength = 58
+    }
+    switch {
+    case name == "":
+        return fmt.Errorf("name is empty")
+    case len(name) > maxLength:
+        return fmt.Errorf("name %q is %d characters, the limit is %d", name, len(name), maxLength)
+    case !nameCharsRe.MatchString(name):
+        return fmt.Errorf("name %q may only contain lowercase letters, digits and hyphens", name)
+    case strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-"):
+        return fmt.Errorf("name %q must not start or end with a hyphen", name)
+    case reservedNames[name]:
+        return fmt.Errorf("name %q is reserved", name)
+    }
+    return nil
+}
+
+// expandNameTemplate fills {prefix}, {rand:N}, {num:N}, {adj} and {noun}.
+func expandNameTemplate(template, prefix string) (string, error) {
+    var expandErr error
+    name := nameTemplateRe.ReplaceAllStringFunc(template, func(token string) string {
+        parts := nameTemplateRe.FindStringSubmatch(token)
+        length := 0
+        if parts[2] != "" {
+            length, _ = strconv.Atoi(parts[2])
+        }
+        switch parts[1] {
+        case "prefix":
+            if prefix == "" {
+                expandErr = fmt.Errorf("template uses {prefix} but no -name-prefix was given")
+            }
+            return prefix
+        case "rand":
+            if length < 1 || length > 32 {
+                expandErr = fmt.Errorf("{rand:N} needs a length between 1 and 32")
+                return ""
+            }
+            return generateRandomString("abcdefghijklmnopqrstuvwxyz0123456789", length, false)
+        case "num":
+            if length < 1 || length > 8 {
+                expandErr = fmt.Errorf("{num:N} needs a length between 1 and 8")
+                return ""
+            }
+            return generateRandomString("0123456789", length, true)
+        case "adj":
+            return nameAdjectives[rand.Intn(len(nameAdjectives))]
+        case "noun":
+            return nameNouns[rand.Intn(len(nameNouns))]
+        default:
+            expandErr = fmt.Errorf("unknown template field %s", token)
+            return ""
+        }
+    })
+    if expandErr != nil {
+        return "", expandErr
+    }
+    if nameTemplateEnd.MatchString(name) {
+        return "", fmt.Errorf("template %q has an unterminated or malformed field", template)
+    }
+    return name, nil
+}
+
+// newNameGenerator returns a generator for the configured naming strategy
+// after checking that it produces valid names for deployType.
+func newNameGenerator(deployType string) (func() (string, error), error) {
+    prefix := strings.ToLower(strings.TrimSpace(namePrefix))
+    if prefix != "" && !nameCharsRe.MatchString(prefix) {
+        return nil, fmt.Errorf("name prefix %q may only contain lowercase letters, digits and hyphens", namePrefix)
+    }
+
+    template := nameTemplate
+    if template == "" {
+        styles := nameStyles
+        if prefix != "" {
+            styles = prefixedNameStyles
+        }
+        var ok bool
+        if template, ok = styles[nameStyle]; !ok {
+            return nil, fmt.Errorf("unknown name style %q, use random or words", nameStyle)
+        }
+    }
+
+    generate := func() (string, error) {
+        name, err := expandNameTemplate(template, prefix)
+        if err != nil {
+            return "", err
+        }
+        return name, validateWorkerName(name, deployType)
+    }
+    if _, err := generate(); err != nil {
+        return nil, err
+    }
+    return generate, nil
+}
+
+type nameCandidate struct {
+    name   string
+    status nameStatus
+    err    error
+}
+
+// pickAvailableName checks batches of candidates in parallel and returns
+// the first one the account reports as free.
+func pickAvailableName(backend Backend, deployType string, generate func() (string, error)) (string, error) {
+    var lastErr error
+    for batch := 1; batch <= maxNameBatches; batch++ {
+        var candidates []*nameCandidate
+        seen := map[string]bool{}
+        for i := 0; i < nameBatchSize; i++ {
+            name, err := generate()
+            if err != nil {
+                return "", err
+            }
+            if !seen[name] {
+                seen[name] = true
+                candidates = append(candidates, &nameCandidate{name: name})
+            }
+        }
+
+        var wg sync.WaitGroup
+        for _, candidate := range candidates {
+            wg.Add(1)
+            go func(c *nameCandidate) {
+                defer wg.Done()
+                c.status, c.err = backend.NameStatus(c.name, deployType)
+            }(candidate)
+        }
+        wg.Wait()
+
+        var unknown *nameCandidate
+        for _, candidate := range candidates {
+            fmt.Printf("%s %s%s%s: %s\n", infoPrefix, cyan, candidate.name, reset, candidate.status)
+            if candidate.status == nameFree {
+                return candidate.name, nil
+            }
+            if candidate.status == nameUnknown && unknown == nil {
+                unknown = candidate
+            }
+        }
+        if unknown != nil {
+            return "", fmt.Errorf("could not verify that %s is free: %v", unknown.name, unknown.err)
+        }
+        lastErr = fmt.Errorf("all %d candidates are already used", len(candidates))
+        if len(candidates) == 1 {
+            break
+        }
+    }
+    return "", fmt.Errorf("no free name found: %v", lastErr)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+    "regexp"
+    "slices"
+    "strings"
+    "testing"
+)
+
+func TestValidateWorkerName(t *testing.T) {
+    tests := []struct {
+        name       string
+        deployType string
+        valid      bool
+    }{
+        {"calm-river-42", "1", true},
+        {"panel-x7k2q9", "2", true},
+        {"", "1", false},
+        {"-panel", "1", false},
+        {"panel-", "2", false},
+        {"Panel", "1", false},
+        {"panel_one", "1", false},
+        {"www", "1", false},
+        {strings.Repeat("a", 63), "1", true},
+        {strings.Repeat("a", 64), "1", false},
+        {strings.Repeat("a", 59), "2", false},
+    }
+    for _, tt := range tests {
+        if err := validateWorkerName(tt.name, tt.deployType); (err == nil) != tt.valid {
+            t.Errorf("validateWorkerName(%q, %s) = %v, want valid=%v", tt.name, tt.deployType, err, tt.valid)
+        }
+    }
+}
+
+func withNaming(t *testing.T, prefix, style, template string) {
+    t.Helper()
+    savedPrefix, savedStyle, savedTemplate := namePrefix, nameStyle, nameTemplate
+    t.Cleanup(func() { namePrefix, nameStyle, nameTemplate = savedPrefix, savedStyle, savedTemplate })
+    namePrefix, nameStyle, nameTemplate = prefix, style, template
+}
+
+func TestNameGenerators(t *testing.T) {
+    tests := []struct {
+        prefix, style, template string
+        pattern                 string
+    }{
+        {"", "random", "", `^[a-z][a-z0-9]{31}$`},
+        {"", "words", "", `^[a-z]+-[a-z]+-[0-9]{2}$`},
+        {"Panel", "random", "", `^panel-[a-z][a-z0-9]{7}$`},
+        {"vpn", "words", "", `^vpn-[a-z]+-[a-z]+-[0-9]{2}$`},
+        {"home", "random", "{prefix}-{rand:6}", `^home-[a-z][a-z0-9]{5}$`},
+        {"", "random", "{noun}{num:3}", `^[a-z]+[0-9]{3}$`},
+    }
+    for _, tt := range tests {
+        withNaming(t, tt.prefix, tt.style, tt.template)
+        generate, err := newNameGenerator("2")
+        if err != nil {
+            t.Errorf("%+v: %v", tt, err)
+            continue
+        }
+        for i := 0; i < 20; i++ {
+            name, err := generate()
+            if err != nil || !regexp.MustCompile(tt.pattern).MatchString(name) {
+                t.Errorf("%+v: generated %q, %v", tt, name, err)
+            }
+        }
+    }
+}
+
+func TestInvalidNamingOptions(t *testing.T) {
+    tests := []struct {
+        prefix, style, template string
+    }{
+        {"", "fancy", ""},
+        {"bad prefix", "random", ""},
+        {"", "random", "{prefix}-{rand:6}"},
+        {"", "random", "{color}-{rand:4}"},
+        {"", "random", "{rand:0}"},
+        {"", "random", "panel-{rand:4"},
+        {"", "random", "{rand:6}-"},
+        {strings.Repeat("p", 60), "words", ""},
+    }
+    for _, tt := range tests {
+        withNaming(t, tt.prefix, tt.style, tt.template)
+        if _, err := newNameGenerator("1"); err == nil {
+            t.Errorf("%+v: expected an error", tt)
+        }
+    }
+}
+
+func TestPickAvailableName(t *testing.T) {
+    withNaming(t, "", "words", "")
+    generate, err := newNameGenerator("1")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    backend := newMemoryBackend()
+    backend.takenChecks = nameBatchSize + 1
+    name, err := pickAvailableName(backend, "1", generate)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(backend.nameChecks) < nameBatchSize+2 {
+        t.Errorf("expected a second batch after a fully used first one, got %d checks", len(backend.nameChecks))
+    }
+    if !slices.Contains(backend.nameChecks[nameBatchSize:], name) {
+        t.Errorf("picked %q, which was not in the second batch", name)
+    }
+
+    backend = newMemoryBackend()
+    backend.takenChecks = 1
+    backend.unknownChecks = nameBatchSize - 1
+    if _, err := pickAvailableName(backend, "1", generate); err == nil || !strings.Contains(err.Error(), "could not verify") {
+        t.Errorf("expected an unknown name to stop the search, got %v", err)
+    }
+
+    withNaming(t, "", "", "fixed-name")
+    generate, err = newNameGenerator("1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    backend = newMemoryBackend()
+    backend.deployed["fixed-name"] = "https://fixed-name.example.workers.dev"
+    if _, err := pickAvailableName(backend, "1", generate); err == nil {
+        t.Error("expected a fixed name that is taken to fail")
+    }
+    if len(backend.nameChecks) != 1 {
+        t.Errorf("fixed name was checked %d times, want 1", len(backend.nameChecks))
+    }
+}
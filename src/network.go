@@ -0,0 +1,438 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "golang.org/x/net/proxy"
+)
+
+type dohResolver struct {
+    endpoint string
+    client   *http.Client
+    mu       sync.Mutex
+    cache    map[string][]string
+}
+
+type dohResponse struct {
+    Status int `json:"Status"`
+    Answer []struct {
+        Type int    `json:"type"`
+        Data string `json:"data"`
+    } `json:"Answer"`
+}
+
+type networkConfig struct {
+    proxy    *url.URL
+    resolver *dohResolver
+}
+
+var (
+    proxyFlag     string
+    dohFlag       string
+    activeNetwork = &networkConfig{}
+    childProxyURL string
+    baseDialer    = &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+)
+
+func addNetworkFlags(fs *flag.FlagSet) {
+    fs.StringVar(&proxyFlag, "proxy", "", "Route all outbound traffic through this proxy (http://, https:// or socks5://host:port)")
+    fs.StringVar(&dohFlag, "doh", "", "Resolve hostnames with this DNS-over-HTTPS JSON endpoint, e.g. https://1.1.1.1/dns-query")
+}
+
+func parseProxyURL(rawURL string) (*url.URL, error) {
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return nil, fmt.Errorf("invalid proxy URL: %v", err)
+    }
+    switch u.Scheme {
+    case "http", "https", "socks5", "socks5h":
+    default:
+        return nil, fmt.Errorf("unsupported proxy scheme %q, use http, https or socks5", u.Scheme)
+    }
+    if u.Hostname() == "" || u.Port() == "" {
+        return nil, fmt.Errorf("proxy URL must include host and port")
+    }
+    return u, nil
+}
+
+func newDoHResolver(endpoint string, upstream *url.URL) (*dohResolver, error) {
+    u, err := url.Parse(endpoint)
+    if err != nil || u.Scheme != "https" || u.Host == "" {
+        return nil, fmt.Errorf("invalid DoH URL %q, it must be a full https:// URL", endpoint)
+    }
+    bootstrap := &networkConfig{proxy: upstream}
+    return &dohResolver{
+        endpoint: endpoint,
+        client:   &http.Client{Transport: bootstrap.transport(), Timeout: apiTimeout},
+        cache:    map[string][]string{},
+    }, nil
+}
+
+func (r *dohResolver) query(ctx context.Context, host, recordType string) ([]string, error) {
+    u, err := url.Parse(r.endpoint)
+    if err != nil {
+        return nil, err
+    }
+    q := u.Query()
+    q.Set("name", host)
+    q.Set("type", recordType)
+    u.RawQuery = q.Encode()
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Accept", "application/dns-json")
+    resp, err := r.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("DoH query failed: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("DoH server returned HTTP %d", resp.StatusCode)
+    }
+    var answer dohResponse
+    if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&answer); err != nil {
+        return nil, fmt.Errorf("error decoding DoH response: %v", err)
+    }
+    if answer.Status != 0 {
+        return nil, fmt.Errorf("DoH lookup of %s failed with DNS status %d", host, answer.Status)
+    }
+    var ips []string
+    for _, record := range answer.Answer {
+        if (record.Type == 1 || record.Type == 28) && net.ParseIP(record.Data) != nil {
+            ips = append(ips, record.Data)
+        }
+    }
+    return ips, nil
+}
+
+func (r *dohResolver) lookup(ctx context.Context, host string) ([]string, error) {
+    r.mu.Lock()
+    cached, ok := r.cache[host]
+    r.mu.Unlock()
+    if ok {
+        return cached, nil
+    }
+    ips, err := r.query(ctx, host, "A")
+    if err != nil {
+        return nil, err
+    }
+    if v6, err := r.query(ctx, host, "AAAA"); err == nil {
+        ips = append(ips, v6...)
+    }
+    if len(ips) == 0 {
+        return nil, fmt.Errorf("DoH lookup of %s returned no addresses", host)
+    }
+    r.mu.Lock()
+    r.cache[host] = ips
+    r.mu.Unlock()
+    return ips, nil
+}
+
+func (c *networkConfig) dialDirect(ctx context.Context, network, addr string) (net.Conn, error) {
+    if c.resolver == nil {
+        return baseDialer.DialContext(ctx, network, addr)
+    }
+    host, port, err := net.SplitHostPort(addr)
+    if err != nil {
+        return nil, err
+    }
+    if net.ParseIP(host) != nil {
+        return baseDialer.DialContext(ctx, network, addr)
+    }
+    ips, err := c.resolver.lookup(ctx, host)
+    if err != nil {
+        return nil, err
+    }
+    var lastErr error
+    for _, ip := range ips {
+        conn, err := baseDialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+        if err == nil {
+            return conn, nil
+        }
+        lastErr = err
+    }
+    return nil, lastErr
+}
+
+type contextDialerFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (f contextDialerFunc) Dial(network, addr string) (net.Conn, error) {
+    return f(context.Background(), network, addr)
+}
+
+func (f contextDialerFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+    return f(ctx, network, addr)
+}
+
+func (c *networkConfig) isSOCKS() bool {
+    return c.proxy != nil && strings.HasPrefix(c.proxy.Scheme, "socks5")
+}
+
+func (c *networkConfig) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+    if !c.isSOCKS() {
+        return c.dialDirect(ctx, network, addr)
+    }
+    var auth *proxy.Auth
+    if c.proxy.User != nil {
+        password, _ := c.proxy.User.Password()
+        auth = &proxy.Auth{User: c.proxy.User.Username(), Password: password}
+    }
+    dialer, err := proxy.SOCKS5("tcp", c.proxy.Host, auth, contextDialerFunc(c.dialDirect))
+    if err != nil {
+        return nil, fmt.Errorf("error creating SOCKS5 dialer: %v", err)
+    }
+    return dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+}
+
+func (c *networkConfig) transport() *http.Transport {
+    transport := &http.Transport{
+        Proxy:                 http.ProxyFromEnvironment,
+        DialContext:           c.dial,
+        TLSHandshakeTimeout:   connectTimeout,
+        ResponseHeaderTimeout: apiTimeout,
+        IdleConnTimeout:       90 * time.Second,
+    }
+    if c.proxy != nil {
+        transport.Proxy = nil
+        if !c.isSOCKS() {
+            transport.Proxy = http.ProxyURL(c.proxy)
+        }
+    }
+    return transport
+}
+
+func configureNetwork() error {
+    config := &networkConfig{}
+    if proxyFlag != "" {
+        u, err := parseProxyURL(proxyFlag)
+        if err != nil {
+            return err
+        }
+        config.proxy = u
+        if password, ok := u.User.Password(); ok {
+            registerSecret(password)
+        }
+    }
+    if dohFlag != "" {
+        resolver, err := newDoHResolver(dohFlag, config.proxy)
+        if err != nil {
+            return err
+        }
+        config.resolver = resolver
+    }
+    activeNetwork = config
+
+    switch {
+    case config.proxy != nil && !config.isSOCKS():
+        childProxyURL = config.proxy.String()
+    case config.proxy != nil || config.resolver != nil:
+        bridgeURL, err := startProxyBridge(config)
+        if err != nil {
+            return fmt.Errorf("error starting local proxy bridge for wrangler: %v", err)
+        }
+        childProxyURL = bridgeURL
+    }
+    return nil
+}
+
+func startProxyBridge(config *networkConfig) (string, error) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        return "", err
+    }
+    forward := config.transport()
+    forward.Proxy = nil
+    server := &http.Server{
+        ReadHeaderTimeout: apiTimeout,
+        Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Method == http.MethodConnect {
+                bridgeConnect(config, w, r)
+                return
+            }
+            r.RequestURI = ""
+            resp, err := forward.RoundTrip(r)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadGateway)
+                return
+            }
+            defer resp.Body.Close()
+            for key, values := range resp.Header {
+                w.Header()[key] = values
+            }
+            w.WriteHeader(resp.StatusCode)
+            io.Copy(w, resp.Body)
+        }),
+    }
+    go server.Serve(listener)
+    return "http://" + listener.Addr().String(), nil
+}
+
+func bridgeConnect(config *networkConfig, w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), connectTimeout*2)
+    defer cancel()
+    upstream, err := config.dial(ctx, "tcp", r.Host)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadGateway)
+        return
+    }
+    hijacker, ok := w.(http.Hijacker)
+    if !ok {
+        upstream.Close()
+        http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+        return
+    }
+    client, _, err := hijacker.Hijack()
+    if err != nil {
+        upstream.Close()
+        return
+    }
+    client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+    go func() {
+        io.Copy(upstream, client)
+        upstream.Close()
+    }()
+    io.Copy(client, upstream)
+    client.Close()
+}
+
+func commandEnv() []string {
+    env := os.Environ()
+    if childProxyURL == "" {
+        return env
+    }
+    var filtered []string
+    nodeOptions := ""
+    for _, kv := range env {
+        key := strings.ToUpper(strings.SplitN(kv, "=", 2)[0])
+        switch key {
+        case "HTTPS_PROXY", "HTTP_PROXY", "ALL_PROXY":
+            continue
+        case "NODE_OPTIONS":
+            nodeOptions = strings.SplitN(kv, "=", 2)[1]
+            continue
+        }
+        filtered = append(filtered, kv)
+    }
+    if major, err := nodeMajorVersion(); err == nil && major >= 24 && !strings.Contains(nodeOptions, "--use-env-proxy") {
+        nodeOptions = strings.TrimSpace(nodeOptions + " --use-env-proxy")
+    }
+    filtered = append(filtered,
+        "HTTPS_PROXY="+childProxyURL,
+        "HTTP_PROXY="+childProxyURL,
+        "https_proxy="+childProxyURL,
+        "http_proxy="+childProxyURL,
+    )
+    if nodeOptions != "" {
+        filtered = append(filtered, "NODE_OPTIONS="+nodeOptions)
+    }
+    return filtered
+}
+
+type preflightTarget struct {
+    name string
+    url  string
+}
+
+var preflightTargets = []preflightTarget{
+    {"GitHub", "https://github.com"},
+    {"GitHub API", "https://api.github.com"},
+    {"npm registry", "https://registry.npmjs.org"},
+    {"Cloudflare API", "https://api.cloudflare.com/client/v4/ips"},
+    {"Cloudflare dash", "https://dash.cloudflare.com"},
+}
+
+func probeEndpoint(config *networkConfig, target string) (time.Duration, error) {
+    client := &http.Client{Transport: config.transport(), Timeout: 20 * time.Second}
+    start := time.Now()
+    req, err := http.NewRequest(http.MethodHead, target, nil)
+    if err != nil {
+        return 0, err
+    }
+    req.Header.Set("User-Agent", "BPB-Terminal-Wizard")
+    resp, err := client.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    resp.Body.Close()
+    return time.Since(start), nil
+}
+
+func runConnectivityPreflight() bool {
+    type path struct {
+        name   string
+        config *networkConfig
+    }
+    paths := []path{{"direct", &networkConfig{}}}
+    if activeNetwork.resolver != nil {
+        paths = append(paths, path{"doh", &networkConfig{resolver: activeNetwork.resolver}})
+    }
+    if activeNetwork.proxy != nil {
+        paths = append(paths, path{"proxy", &networkConfig{proxy: activeNetwork.proxy}})
+        if activeNetwork.resolver != nil {
+            paths = append(paths, path{"proxy+doh", activeNetwork})
+        }
+    }
+
+    fmt.Printf("\n  %-16s", "ENDPOINT")
+    for _, p := range paths {
+        fmt.Printf(" %-14s", strings.ToUpper(p.name))
+    }
+    fmt.Println()
+
+    allReachable := true
+    for _, target := range preflightTargets {
+        fmt.Printf("  %-16s", target.name)
+        results := make([]string, len(paths))
+        var wg sync.WaitGroup
+        for i, p := range paths {
+            wg.Add(1)
+            go func(i int, config *networkConfig) {
+                defer wg.Done()
+                latency, err := probeEndpoint(config, target.url)
+                if err != nil {
+                    results[i] = red + fmt.Sprintf("%-14s", "unreachable") + reset
+                    return
+                }
+                results[i] = green + fmt.Sprintf("%-14s", fmt.Sprintf("ok %dms", latency.Milliseconds())) + reset
+            }(i, p.config)
+        }
+        wg.Wait()
+        for _, result := range results {
+            fmt.Printf(" %s", result)
+        }
+        fmt.Println()
+        if strings.Contains(results[len(results)-1], "unreachable") {
+            allReachable = false
+        }
+    }
+    return allReachable
+}
+
+func runPreflight(args []string) {
+    fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+    fmt.Printf("\n%s Checking connectivity...\n", titlePrefix)
+    if runConnectivityPreflight() {
+        successMessage("All endpoints are reachable through the configured path.")
+    } else {
+        fmt.Printf("%s Some endpoints are unreachable through the configured path. Try -proxy and/or -doh.\n", warnPrefix)
+    }
+}
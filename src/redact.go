@@ -0,0 +1,58 @@
+package main
+
+import (
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+)
+
+const redactedMark = "[REDACTED]"
+
+var showSecrets bool
+
+var (
+    secretsMu    sync.Mutex
+    secretValues []string
+
+    // tokenPatterns catch credentials that were never registered, such as
+    // OAuth codes in callback URLs, tokens echoed by Wrangler and proxy
+    // passwords. The credential sits between the first and second groups.
+    tokenPatterns = []*regexp.Regexp{
+        regexp.MustCompile(`(?i)([?&]code=)[^&\s"'#]+`),
+        regexp.MustCompile(`(?i)(bearer\s+)[a-z0-9._~+/=-]+`),
+        regexp.MustCompile(`(?i)((?:oauth_token|refresh_token|access_token|api_token|client_secret)"?\s*[:=]\s*"?)[^"'\s&,]+`),
+        regexp.MustCompile(`(://[^:/@\s]*:)[^@\s/]+(@)`),
+    }
+)
+
+// registerSecret makes redact mask value wherever it appears. Values
+// shorter than four characters are ignored so ordinary words survive.
+func registerSecret(value string) {
+    if len(value) < 4 {
+        return
+    }
+    secretsMu.Lock()
+    defer secretsMu.Unlock()
+    for _, known := range secretValues {
+        if known == value {
+            return
+        }
+    }
+    secretValues = append(secretValues, value)
+    sort.Slice(secretValues, func(i, j int) bool { return len(secretValues[i]) > len(secretValues[j]) })
+}
+
+// redact masks registered secrets and anything that looks like a token.
+// Every message the wizard prints goes through it.
+func redact(text string) string {
+    secretsMu.Lock()
+    for _, value := range secretValues {
+        text = strings.ReplaceAll(text, value, redactedMark)
+    }
+    secretsMu.Unlock()
+    for _, pattern := range tokenPatterns {
+        text = pattern.ReplaceAllString(text, "${1}"+redactedMark+"${2}")
+    }
+    return text
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+// registryMu serializes updates from panels deployed in parallel.
+var registryMu sync.Mutex
+
+type Deployment struct {
+    Name              string            `json:"name"`
+    DeployType        string            `json:"deploy_type"`
+    PanelURL          string            `json:"panel_url"`
+    KVID              string            `json:"kv_id"`
+    WorkerVersion     string            `json:"worker_version"`
+    WorkerSHA256      string            `json:"worker_sha256"`
+    WorkerSource      string            `json:"worker_source"`
+    UUID              string            `json:"uuid"`
+    TrPass            string            `json:"tr_pass"`
+    ProxyIP           string            `json:"proxy_ip"`
+    Fallback          string            `json:"fallback"`
+    SubPath           string            `json:"sub_path"`
+    CustomDomain      string            `json:"custom_domain,omitempty"`
+    CompatibilityDate string            `json:"compatibility_date,omitempty"`
+    SecretsMode       bool              `json:"secrets_mode,omitempty"`
+    Profile           string            `json:"profile,omitempty"`
+    Vars              map[string]string `json:"vars,omitempty"`
+    Tags              []string          `json:"tags,omitempty"`
+    AccountID         string            `json:"account_id,omitempty"`
+    CreatedAt         time.Time         `json:"created_at"`
+    UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// registryPath is the plain-text registry used before the vault; it is
+// only read to migrate old records.
+func registryPath(installDir string) string {
+    return filepath.Join(installDir, "deployments.json")
+}
+
+// loadDeployments returns the recorded panels. Their credentials are
+// registered so any command that redeploys them keeps them out of output.
+func loadDeployments(installDir string) ([]Deployment, error) {
+    data, err := loadVault(installDir)
+    if err != nil {
+        return nil, fmt.Errorf("error reading deployment records: %v", err)
+    }
+    for i := range data.Deployments {
+        for _, value := range panelSecrets(&data.Deployments[i]) {
+            registerSecret(value)
+        }
+    }
+    return data.Deployments, nil
+}
+
+func saveDeployments(installDir string, deployments []Deployment) error {
+    data, err := loadVault(installDir)
+    if err != nil {
+        return fmt.Errorf("error reading deployment records: %v", err)
+    }
+    data.Deployments = deployments
+    if err := saveVault(installDir, data); err != nil {
+        return fmt.Errorf("error writing deployment records: %v", err)
+    }
+    return nil
+}
+
+func recordDeployment(installDir string, deployment Deployment) error {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+    deployments, err := loadDeployments(installDir)
+    if err != nil {
+        return err
+    }
+    now := time.Now().UTC()
+    deployment.UpdatedAt = now
+    for i := range deployments {
+        if deployments[i].Name == deployment.Name {
+            deployment.CreatedAt = deployments[i].CreatedAt
+            deployments[i] = deployment
+            return saveDeployments(installDir, deployments)
+        }
+    }
+    deployment.CreatedAt = now
+    return saveDeployments(installDir, append(deployments, deployment))
+}
+
+func findDeployment(installDir, name string) (*Deployment, error) {
+    deployments, err := loadDeployments(installDir)
+    if err != nil {
+        return nil, err
+    }
+    for i := range deployments {
+        if deployments[i].Name == name {
+            return &deployments[i], nil
+        }
+    }
+    return nil, fmt.Errorf("no deployment record found for %s", name)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strings"
+    "time"
+)
+
+const (
+    workerRepo      = "bia-pain-bache/BPB-Worker-Panel"
+    workerLatestTag = "latest"
+)
+
+var workerReleasesAPI = "https://api.github.com/repos/" + workerRepo + "/releases"
+
+type ReleaseAsset struct {
+    Name               string `json:"name"`
+    Size               int64  `json:"size"`
+    Digest             string `json:"digest"`
+    BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+type Release struct {
+    TagName     string         `json:"tag_name"`
+    Name        string         `json:"name"`
+    Prerelease  bool           `json:"prerelease"`
+    Draft       bool           `json:"draft"`
+    PublishedAt time.Time      `json:"published_at"`
+    Assets      []ReleaseAsset `json:"assets"`
+}
+
+type WorkerRelease struct {
+    Tag    string
+    URL    string
+    SHA256 string
+}
+
+func isValidReleaseTag(tag string) bool {
+    re, err := regexp.Compile(`^v?\d+(\.\d+){0,3}([-.][0-9A-Za-z.-]+)?$`)
+    if err != nil {
+        return false
+    }
+    return re.MatchString(tag)
+}
+
+func fetchReleaseJSON(apiURL string, target any) error {
+    req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+    if err != nil {
+        return fmt.Errorf("error creating request: %v", err)
+    }
+    req.Header.Set("Accept", "application/vnd.github+json")
+    req.Header.Set("User-Agent", "BPB-Terminal-Wizard")
+    resp, err := newHTTPClient(apiTimeout).Do(req)
+    if err != nil {
+        return fmt.Errorf("error querying GitHub releases: %v", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusNotFound {
+        return fmt.Errorf("release not found (HTTP 404)")
+    }
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("GitHub releases API returned HTTP %d", resp.StatusCode)
+    }
+    if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+        return fmt.Errorf("error decoding GitHub releases response: %v", err)
+    }
+    return nil
+}
+
+func listWorkerReleases(limit int) ([]Release, error) {
+    var releases []Release
+    apiURL := fmt.Sprintf("%s?per_page=%d", workerReleasesAPI, limit)
+    if err := fetchReleaseJSON(apiURL, &releases); err != nil {
+        return nil, err
+    }
+    return releases, nil
+}
+
+func getWorkerRelease(tag string) (*Release, error) {
+    var release Release
+    apiURL := workerReleasesAPI + "/latest"
+    if tag != workerLatestTag {
+        apiURL = workerReleasesAPI + "/tags/" + url.PathEscape(tag)
+    }
+    if err := fetchReleaseJSON(apiURL, &release); err != nil {
+        return nil, err
+    }
+    return &release, nil
+}
+
+func (r *Release) findAsset(name string) (*ReleaseAsset, error) {
+    for i := range r.Assets {
+        if r.Assets[i].Name == name {
+            return &r.Assets[i], nil
+        }
+    }
+    return nil, fmt.Errorf("release %s has no %s asset", r.TagName, name)
+}
+
+func (a *ReleaseAsset) sha256Digest() string {
+    digest, found := strings.CutPrefix(a.Digest, "sha256:")
+    if !found {
+        return ""
+    }
+    return strings.ToLower(digest)
+}
+
+func workerDownloadURL(tag string) string {
+    if tag == workerLatestTag {
+        return "https://github.com/" + workerRepo + "/releases/latest/download/worker.js"
+    }
+    return fmt.Sprintf("https://github.com/%s/releases/download/%s/worker.js", workerRepo, url.PathEscape(tag))
+}
+
+func resolveWorkerRelease(tag string) (*WorkerRelease, error) {
+    release, err := getWorkerRelease(tag)
+    if err != nil {
+        fallback := &WorkerRelease{Tag: tag, URL: workerDownloadURL(tag)}
+        if tag == workerLatestTag {
+            return fallback, fmt.Errorf("could not resolve latest release: %v", err)
+        }
+        return fallback, fmt.Errorf("could not verify release %s: %v", tag, err)
+    }
+    asset, err := release.findAsset("worker.js")
+    if err != nil {
+        return nil, err
+    }
+    return &WorkerRelease{
+        Tag:    release.TagName,
+        URL:    asset.BrowserDownloadURL,
+        SHA256: asset.sha256Digest(),
+    }, nil
+}
+
+func runReleases(args []string) {
+    fs := flag.NewFlagSet("releases", flag.ExitOnError)
+    limit := fs.Int("limit", 15, "Number of releases to list")
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+
+    fmt.Printf("\n%s Fetching %sBPB-Worker-Panel%s releases...\n", titlePrefix, bold+blue, reset)
+    releases, err := listWorkerReleases(*limit)
+    if err != nil {
+        failMessage("Error listing releases", err)
+        return
+    }
+    if len(releases) == 0 {
+        fmt.Printf("%s No releases found.\n", warnPrefix)
+        return
+    }
+
+    fmt.Printf("\n  %-16s %-12s %s\n", "TAG", "PUBLISHED", "NOTES")
+    for _, release := range releases {
+        if release.Draft {
+            continue
+        }
+        var notes []string
+        if release.Prerelease {
+            notes = append(notes, "pre-release")
+        }
+        if _, err := release.findAsset("worker.js"); err != nil {
+            notes = append(notes, "no worker.js")
+        }
+        fmt.Printf("  %s%-16s%s %-12s %s\n", cyan, release.TagName, reset, release.PublishedAt.Format("2006-01-02"), strings.Join(notes, ", "))
+    }
+    fmt.Printf("\n%s Deploy a specific release with %s-worker-version <tag>%s.\n", infoPrefix, bold, reset)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestIsValidReleaseTag(t *testing.T) {
+    tests := []struct {
+        tag string
+        ok  bool
+    }{
+        {"v3.0.0", true},
+        {"3.0.0", true},
+        {"v2.5", true},
+        {"v1.2.3.4", true},
+        {"v3.0.0-rc.1", true},
+        {"v3.0.0-beta1", true},
+        {"", false},
+        {workerLatestTag, false},
+        {"v", false},
+        {"vX.Y.Z", false},
+        {"v3.0.0 ", false},
+        {"v3.0.0/../../evil", false},
+        {"v3.0.0;rm -rf ~", false},
+    }
+    for _, tt := range tests {
+        if got := isValidReleaseTag(tt.tag); got != tt.ok {
+            t.Errorf("isValidReleaseTag(%q) = %v, want %v", tt.tag, got, tt.ok)
+        }
+    }
+}
+
+func TestWorkerDownloadURL(t *testing.T) {
+    if got := workerDownloadURL(workerLatestTag); !strings.HasSuffix(got, "/releases/latest/download/worker.js") {
+        t.Errorf("latest: %s", got)
+    }
+    if got := workerDownloadURL("v3.0.0-rc.1"); !strings.HasSuffix(got, "/releases/download/v3.0.0-rc.1/worker.js") {
+        t.Errorf("pinned tag: %s", got)
+    }
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "math/rand"
+    "net/http"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// retryPolicy is the one retry loop used for commands, Cloudflare
+// operations and downloads. Only transient failures are retried.
+type retryPolicy struct {
+    maxAttempts int
+    baseDelay   time.Duration
+    maxDelay    time.Duration
+    deadline    time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+    maxAttempts: 4,
+    baseDelay:   2 * time.Second,
+    maxDelay:    30 * time.Second,
+    deadline:    3 * time.Minute,
+}
+
+func (p retryPolicy) withAttempts(attempts int) retryPolicy {
+    p.maxAttempts = attempts
+    return p
+}
+
+// backoff returns an exponential delay with jitter in [d/2, d].
+func (p retryPolicy) backoff(attempt int) time.Duration {
+    delay := p.baseDelay << (attempt - 1)
+    if delay <= 0 || delay > p.maxDelay {
+        delay = p.maxDelay
+    }
+    half := delay / 2
+    return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (p retryPolicy) do(action string, fn func() error) error {
+    start := time.Now()
+    for attempt := 1; ; attempt++ {
+        err := fn()
+        if err == nil {
+            return nil
+        }
+        transient, retryAfter := classifyError(err)
+        if !transient {
+            return fmt.Errorf("%s failed with a permanent error: %w", action, err)
+        }
+        if attempt >= p.maxAttempts {
+            return fmt.Errorf("%s failed after %d attempts: %w", action, attempt, err)
+        }
+        delay := max(p.backoff(attempt), retryAfter)
+        if time.Since(start)+delay > p.deadline {
+            return fmt.Errorf("%s failed, retry deadline of %s reached: %w", action, p.deadline, err)
+        }
+        fmt.Printf("%s %s failed (%s), retrying in %s...\n", warnPrefix, action, redact(err.Error()), delay.Round(100*time.Millisecond))
+        logMessage("retry", fmt.Sprintf("%s attempt %d failed, retrying in %s: %v", action, attempt, delay.Round(100*time.Millisecond), err))
+        sleep(delay)
+    }
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+    err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+    return &permanentError{err: err}
+}
+
+// httpStatusError is a non-success HTTP response.
+type httpStatusError struct {
+    status     int
+    retryAfter time.Duration
+    message    string
+}
+
+func (e *httpStatusError) Error() string { return e.message }
+
+// commandError keeps a failed command's output for classification
+// without repeating it in the error message.
+type commandError struct {
+    err    error
+    output string
+}
+
+func (e *commandError) Error() string { return e.err.Error() }
+func (e *commandError) Unwrap() error { return e.err }
+
+var (
+    permanentPatterns = []string{
+        "authentication error", "code: 10000", "unauthorized", "not authorized", "forbidden",
+        "http 401", "http 403", "http 404", "permission denied", "eacces",
+        "already exists", "already taken", "already in use", "name is not available",
+        "invalid", "validation", "not logged in", "you must be logged in",
+    }
+    rateLimitRe   = regexp.MustCompile(`(?i)\b429\b|too many requests|rate.?limit`)
+    serverErrorRe = regexp.MustCompile(`(?i)\b(http|status|code)[: ]*5\d\d\b|\b5\d\d (internal server error|bad gateway|service unavailable|gateway timeout)\b`)
+    retryAfterRe  = regexp.MustCompile(`(?i)retry-after:?\s*(\d+)`)
+)
+
+// classifyError reports whether err is worth retrying and how long the
+// server asked us to wait. Unrecognised failures count as transient.
+func classifyError(err error) (bool, time.Duration) {
+    var perm *permanentError
+    if errors.As(err, &perm) {
+        return false, 0
+    }
+    if errors.Is(err, os.ErrPermission) {
+        return false, 0
+    }
+    var statusErr *httpStatusError
+    if errors.As(err, &statusErr) {
+        switch {
+        case statusErr.status == http.StatusTooManyRequests:
+            return true, statusErr.retryAfter
+        case statusErr.status >= 500, statusErr.status == http.StatusRequestTimeout, statusErr.status == http.StatusRequestedRangeNotSatisfiable:
+            return true, statusErr.retryAfter
+        default:
+            return false, 0
+        }
+    }
+
+    text := err.Error()
+    var cmdErr *commandError
+    if errors.As(err, &cmdErr) {
+        text += "\n" + cmdErr.output
+    }
+    if rateLimitRe.MatchString(text) {
+        var wait time.Duration
+        if matches := retryAfterRe.FindStringSubmatch(text); len(matches) == 2 {
+            wait = parseRetryAfter(matches[1])
+        }
+        return true, wait
+    }
+    if serverErrorRe.MatchString(text) {
+        return true, 0
+    }
+    lower := strings.ToLower(text)
+    for _, pattern := range permanentPatterns {
+        if strings.Contains(lower, pattern) {
+            return false, 0
+        }
+    }
+    return true, 0
+}
+
+func parseRetryAfter(value string) time.Duration {
+    value = strings.TrimSpace(value)
+    if value == "" {
+        return 0
+    }
+    if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+        return time.Duration(seconds) * time.Second
+    }
+    if when, err := http.ParseTime(value); err == nil {
+        return max(time.Until(when), 0)
+    }
+    return 0
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestClassifyError(t *testing.T) {
+    tests := []struct {
+        name       string
+        err        error
+        transient  bool
+        retryAfter time.Duration
+    }{
+        {"fetch failed", &commandError{err: errors.New("exit status 1"), output: "✘ [ERROR] fetch failed"}, true, 0},
+        {"server error", &commandError{err: errors.New("exit status 1"), output: "A request to the Cloudflare API failed. [code: 502]"}, true, 0},
+        {"rate limited", &commandError{err: errors.New("exit status 1"), output: "429 Too Many Requests\nRetry-After: 12"}, true, 12 * time.Second},
+        {"authentication", &commandError{err: errors.New("exit status 1"), output: "Authentication error [code: 10000]"}, false, 0},
+        {"name conflict", fmt.Errorf("error creating Pages project: %w", &commandError{err: errors.New("exit status 1"), output: "A project with this name already exists."}), false, 0},
+        {"validation", &commandError{err: errors.New("exit status 1"), output: "Invalid worker name"}, false, 0},
+        {"http 503", &httpStatusError{status: http.StatusServiceUnavailable, retryAfter: time.Second}, true, time.Second},
+        {"http 429", &httpStatusError{status: http.StatusTooManyRequests, retryAfter: 30 * time.Second}, true, 30 * time.Second},
+        {"http 404", &httpStatusError{status: http.StatusNotFound}, false, 0},
+        {"permission", fmt.Errorf("error creating file: %w", os.ErrPermission), false, 0},
+        {"marked permanent", permanent(errors.New("no URL in output")), false, 0},
+        {"unknown", errors.New("exit status 1"), true, 0},
+    }
+    for _, tt := range tests {
+        transient, retryAfter := classifyError(tt.err)
+        if transient != tt.transient || retryAfter != tt.retryAfter {
+            t.Errorf("%s: got (%v, %s), want (%v, %s)", tt.name, transient, retryAfter, tt.transient, tt.retryAfter)
+        }
+    }
+}
+
+func TestRetryPolicy(t *testing.T) {
+    var slept []time.Duration
+    savedSleep := sleep
+    sleep = func(d time.Duration) { slept = append(slept, d) }
+    t.Cleanup(func() { sleep = savedSleep })
+
+    policy := retryPolicy{maxAttempts: 5, baseDelay: time.Second, maxDelay: 4 * time.Second, deadline: time.Minute}
+
+    calls := 0
+    err := policy.do("test", func() error {
+        calls++
+        if calls < 5 {
+            return errors.New("fetch failed")
+        }
+        return nil
+    })
+    if err != nil || calls != 5 {
+        t.Fatalf("got %v after %d calls", err, calls)
+    }
+    for i, d := range slept {
+        limit := min(policy.baseDelay<<i, policy.maxDelay)
+        if d < limit/2 || d > limit {
+            t.Errorf("delay %d = %s, want between %s and %s", i+1, d, limit/2, limit)
+        }
+    }
+
+    calls = 0
+    err = policy.do("test", func() error {
+        calls++
+        return errors.New("Authentication error [code: 10000]")
+    })
+    if err == nil || calls != 1 || !strings.Contains(err.Error(), "permanent") {
+        t.Errorf("permanent error: got %v after %d calls", err, calls)
+    }
+
+    slept = nil
+    calls = 0
+    err = policy.do("test", func() error {
+        calls++
+        if calls == 1 {
+            return &httpStatusError{status: http.StatusTooManyRequests, retryAfter: 20 * time.Second}
+        }
+        return nil
+    })
+    if err != nil || len(slept) != 1 || slept[0] != 20*time.Second {
+        t.Errorf("Retry-After was not honoured: err %v, slept %v", err, slept)
+    }
+
+    calls = 0
+    policy.deadline = 10 * time.Second
+    err = policy.do("test", func() error {
+        calls++
+        return &httpStatusError{status: http.StatusTooManyRequests, retryAfter: time.Minute}
+    })
+    if err == nil || calls != 1 || !strings.Contains(err.Error(), "deadline") {
+        t.Errorf("deadline: got %v after %d calls", err, calls)
+    }
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    maxRunLogs        = 20
+    outputExcerptSize = 2048
+)
+
+var verboseMode bool
+
+// runLogEntry is one line of a run log. Everything in it has been
+// through redact before it is written.
+type runLogEntry struct {
+    Time       time.Time `json:"time"`
+    Event      string    `json:"event"`
+    Step       string    `json:"step,omitempty"`
+    Panel      string    `json:"panel,omitempty"`
+    Command    string    `json:"command,omitempty"`
+    Args       []string  `json:"args,omitempty"`
+    DurationMS int64     `json:"duration_ms,omitempty"`
+    ExitCode   *int      `json:"exit_code,omitempty"`
+    Output     string    `json:"output,omitempty"`
+    Message    string    `json:"message,omitempty"`
+}
+
+// runLog writes the JSON-lines log of a single wizard run.
+type runLog struct {
+    mu     sync.Mutex
+    file   *os.File
+    path   string
+    step   string
+    start  time.Time
+    failed bool
+}
+
+var currentRun *runLog
+
+func runLogDir(installDir string) string {
+    return filepath.Join(installDir, "logs")
+}
+
+// startRunLog opens a new log for this run and removes the oldest logs
+// beyond maxRunLogs.
+func startRunLog(installDir string, args []string) error {
+    dir := runLogDir(installDir)
+    if err := os.MkdirAll(dir, 0700); err != nil {
+        return fmt.Errorf("error creating log directory: %v", err)
+    }
+    start := time.Now()
+    name := fmt.Sprintf("%s-%d.jsonl", start.UTC().Format("20060102-150405"), os.Getpid())
+    path := filepath.Join(dir, name)
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+    if err != nil {
+        return fmt.Errorf("error creating run log: %v", err)
+    }
+    currentRun = &runLog{file: file, path: path, start: start}
+    pruneRunLogs(dir)
+
+    redacted := make([]string, len(args))
+    for i, arg := range args {
+        redacted[i] = redact(arg)
+    }
+    logEntry(runLogEntry{Event: "start", Args: redacted, Message: versionString()})
+    return nil
+}
+
+// finishRunLog records how the run ended and closes the log.
+func finishRunLog() {
+    run := currentRun
+    if run == nil {
+        return
+    }
+    result := "success"
+    if run.failed {
+        result = "failed"
+    }
+    logEntry(runLogEntry{Event: "end", DurationMS: time.Since(run.start).Milliseconds(), Message: result})
+    run.mu.Lock()
+    run.file.Close()
+    run.mu.Unlock()
+    currentRun = nil
+}
+
+func pruneRunLogs(dir string) {
+    runs, err := listRunLogs(dir)
+    if err != nil {
+        return
+    }
+    for i := maxRunLogs; i < len(runs); i++ {
+        os.Remove(filepath.Join(dir, runs[i]+".jsonl"))
+    }
+}
+
+// logEntry appends entry to the current run log and, with -verbose,
+// mirrors it to the console.
+func logEntry(entry runLogEntry) {
+    run := currentRun
+    if run == nil {
+        return
+    }
+    run.mu.Lock()
+    defer run.mu.Unlock()
+    entry.Time = time.Now().UTC()
+    if entry.Step == "" {
+        entry.Step = run.step
+    }
+    if entry.Event == "error" {
+        run.failed = true
+    }
+    if data, err := json.Marshal(entry); err == nil {
+        run.file.Write(append(data, '\n'))
+    }
+    if verboseMode && entry.Event != "start" {
+        fmt.Printf("   %s[%s]%s %s\n", cyan, entry.Event, reset, entry.summary())
+    }
+}
+
+// logStep marks the start of a deploy step; later entries carry its name.
+func logStep(step string) {
+    run := currentRun
+    if run == nil {
+        return
+    }
+    run.mu.Lock()
+    run.step = step
+    run.mu.Unlock()
+    logEntry(runLogEntry{Event: "step", Step: step})
+}
+
+// logPanelStep marks a step of one panel in a run that deploys several at
+// once. The run's step is left alone: entries in between may come from any
+// panel and keep the step of the phase they all share.
+func logPanelStep(panel, step string) {
+    logEntry(runLogEntry{Event: "step", Step: step, Panel: panel})
+}
+
+func logMessage(event, message string) {
+    logEntry(runLogEntry{Event: event, Message: redact(message)})
+}
+
+func logCommand(command string, start time.Time, output string, err error) {
+    code := exitCode(err)
+    entry := runLogEntry{
+        Event:      "command",
+        Command:    redact(command),
+        DurationMS: time.Since(start).Milliseconds(),
+        ExitCode:   &code,
+        Output:     outputExcerpt(redact(output)),
+    }
+    if err != nil {
+        entry.Message = redact(err.Error())
+    }
+    logEntry(entry)
+}
+
+func logRequest(method, path string, status int, start time.Time, err error) {
+    entry := runLogEntry{
+        Event:      "request",
+        Command:    method + " " + redact(path),
+        DurationMS: time.Since(start).Milliseconds(),
+    }
+    if status != 0 {
+        entry.Message = fmt.Sprintf("HTTP %d", status)
+    }
+    if err != nil {
+        entry.Message = redact(err.Error())
+    }
+    logEntry(entry)
+}
+
+func exitCode(err error) int {
+    if err == nil {
+        return 0
+    }
+    var exitErr *exec.ExitError
+    if errors.As(err, &exitErr) {
+        return exitErr.ExitCode()
+    }
+    return -1
+}
+
+// outputExcerpt keeps the end of long command output, where errors are.
+func outputExcerpt(output string) string {
+    output = strings.TrimSpace(output)
+    if len(output) > outputExcerptSize {
+        output = "..." + output[len(output)-outputExcerptSize:]
+    }
+    return output
+}
+
+func (e runLogEntry) summary() string {
+    var parts []string
+    switch e.Event {
+    case "start":
+        parts = append(parts, strings.Join(e.Args, " "))
+    case "step":
+        if e.Panel != "" {
+            parts = append(parts, e.Panel+":")
+        }
+        parts = append(parts, e.Step)
+    case "command", "request":
+        parts = append(parts, e.Command)
+    }
+    var details []string
+    if e.DurationMS > 0 || e.Event == "command" || e.Event == "request" {
+        details = append(details, (time.Duration(e.DurationMS) * time.Millisecond).String())
+    }
+    if e.ExitCode != nil {
+        details = append(details, fmt.Sprintf("exit %d", *e.ExitCode))
+    }
+    if len(details) > 0 {
+        parts = append(parts, "("+strings.Join(details, ", ")+")")
+    }
+    if e.Message != "" {
+        parts = append(parts, e.Message)
+    }
+    return strings.Join(parts, " ")
+}
+
+// listRunLogs returns run IDs, newest first.
+func listRunLogs(dir string) ([]string, error) {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    var runs []string
+    for _, entry := range entries {
+        if name, found := strings.CutSuffix(entry.Name(), ".jsonl"); found && !entry.IsDir() {
+            runs = append(runs, name)
+        }
+    }
+    sort.Sort(sort.Reverse(sort.StringSlice(runs)))
+    return runs, nil
+}
+
+func readRunLog(dir, run string) ([]runLogEntry, error) {
+    file, err := os.Open(filepath.Join(dir, run+".jsonl"))
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    var entries []runLogEntry
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        var entry runLogEntry
+        if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+            entries = append(entries, entry)
+        }
+    }
+    return entries, scanner.Err()
+}
+
+func runLogs(installDir string, args []string) {
+    dir := runLogDir(installDir)
+    command := "list"
+    if len(args) > 0 {
+        command, args = args[0], args[1:]
+    }
+    runs, err := listRunLogs(dir)
+    if err != nil {
+        failMessage("Error reading run logs", err)
+        return
+    }
+
+    switch command {
+    case "list":
+        fs := flag.NewFlagSet("logs list", flag.ExitOnError)
+        limit := fs.Int("n", 10, "Number of runs to list")
+        fs.Parse(args)
+        if len(runs) == 0 {
+            fmt.Printf("%s No runs have been logged yet.\n", infoPrefix)
+            return
+        }
+        fmt.Printf("\n  %-24s %-18s %-8s %-10s %s\n", "RUN", "STARTED", "RESULT", "DURATION", "FAILED STEP")
+        for i, run := range runs {
+            if i >= *limit {
+                break
+            }
+            entries, err := readRunLog(dir, run)
+            if err != nil || len(entries) == 0 {
+                continue
+            }
+            result, duration, failedStep := "running", "", ""
+            for _, entry := range entries {
+                switch entry.Event {
+                case "end":
+                    result = entry.Message
+                    duration = (time.Duration(entry.DurationMS) * time.Millisecond).Round(time.Second).String()
+                case "error":
+                    if failedStep == "" {
+                        failedStep = entry.Step
+                    }
+                }
+            }
+            fmt.Printf("  %s%-24s%s %-18s %-8s %-10s %s\n", cyan, run, reset, entries[0].Time.Local().Format("2006-01-02 15:04"), result, duration, failedStep)
+        }
+    case "show":
+        fs := flag.NewFlagSet("logs show", flag.ExitOnError)
+        raw := fs.Bool("json", false, "Print the raw JSON lines")
+        fs.Parse(args)
+        if len(runs) == 0 {
+            failMessage("No runs have been logged yet", nil)
+            return
+        }
+        run := runs[0]
+        if fs.NArg() > 0 && fs.Arg(0) != "latest" {
+            run = strings.TrimSuffix(fs.Arg(0), ".jsonl")
+        }
+        if *raw {
+            data, err := os.ReadFile(filepath.Join(dir, run+".jsonl"))
+            if err != nil {
+                failMessage("Error reading run log", err)
+                return
+            }
+            os.Stdout.Write(data)
+            return
+        }
+        entries, err := readRunLog(dir, run)
+        if err != nil {
+            failMessage("Error reading run log", err)
+            return
+        }
+        fmt.Printf("\n%s Run %s%s%s\n", titlePrefix, cyan, run, reset)
+        for _, entry := range entries {
+            fmt.Printf("  %s %-8s %-14s %s\n", entry.Time.Local().Format("15:04:05"), entry.Event, entry.Step, entry.summary())
+            if entry.Output != "" && entry.ExitCode != nil && *entry.ExitCode != 0 {
+                for _, line := range strings.Split(entry.Output, "\n") {
+                    fmt.Printf("      %s\n", line)
+                }
+            }
+        }
+    case "path":
+        fmt.Println(dir)
+    default:
+        failMessage(fmt.Sprintf("Unknown logs command %q. Use: logs list [-n N] | logs show [run|latest] [-json] | logs path", command), nil)
+    }
+}
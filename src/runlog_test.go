@@ -0,0 +1,149 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestRunLogRecordsDeploy(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    t.Cleanup(finishRunLog)
+    backend, runner, _ := newTestWranglerBackend(t, installDir)
+    runner.on("deploy ./src/worker.js", fail("Error: 503 Service Unavailable"), ok("Deployed\n  https://panel.example.workers.dev\n"))
+
+    if err := startRunLog(installDir, []string{"bpb-wizard", "-deploy", "1"}); err != nil {
+        t.Fatal(err)
+    }
+    verboseMode = true
+    defer func() { verboseMode = false }()
+    var deployment *Deployment
+    console := captureStdout(t, func() {
+        if err := loginCloudflare(backend); err != nil {
+            t.Fatal(err)
+        }
+        var err error
+        deployment, err = deployPanel(installDir, backend)
+        if err != nil {
+            t.Fatal(err)
+        }
+    })
+    path := currentRun.path
+    finishRunLog()
+
+    if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+        t.Fatalf("run log missing or readable by others: %v", err)
+    }
+    entries, err := readRunLog(runLogDir(installDir), strings.TrimSuffix(filepath.Base(path), ".jsonl"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if entries[0].Event != "start" || entries[len(entries)-1].Event != "end" || entries[len(entries)-1].Message != "success" {
+        t.Errorf("run log is not framed by start and end: first %+v, last %+v", entries[0], entries[len(entries)-1])
+    }
+
+    var failedDeploys, retries int
+    steps := map[string]bool{}
+    for _, entry := range entries {
+        switch entry.Event {
+        case "step":
+            steps[entry.Step] = true
+        case "retry":
+            retries++
+        case "command":
+            if entry.ExitCode == nil {
+                t.Errorf("command entry without exit code: %+v", entry)
+            }
+            if strings.Contains(entry.Command, "deploy ./src/worker.js") && *entry.ExitCode != 0 {
+                failedDeploys++
+                if entry.Step != "deploy" || !strings.Contains(entry.Output, "503") {
+                    t.Errorf("failed deploy entry = %+v", entry)
+                }
+            }
+        }
+    }
+    for _, step := range []string{"login", "choose-name", "create-kv", "deploy", "record"} {
+        if !steps[step] {
+            t.Errorf("step %s was not logged", step)
+        }
+    }
+    if failedDeploys != 1 || retries != 1 {
+        t.Errorf("logged %d failed deploys and %d retries, want 1 and 1", failedDeploys, retries)
+    }
+
+    data, _ := os.ReadFile(path)
+    for _, secret := range []string{deployment.UUID, deployment.TrPass, deployment.SubPath} {
+        if strings.Contains(string(data), secret) || strings.Contains(console, secret) {
+            t.Errorf("run log or console contains %q", secret)
+        }
+    }
+    if !strings.Contains(console, "[command]"+reset) || !strings.Contains(console, "[step]"+reset+" deploy") {
+        t.Errorf("-verbose did not mirror the log to the console:\n%s", console)
+    }
+}
+
+func TestRunLogPrunesOldRuns(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    t.Cleanup(finishRunLog)
+    dir := runLogDir(installDir)
+    if err := os.MkdirAll(dir, 0700); err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i < maxRunLogs+5; i++ {
+        os.WriteFile(filepath.Join(dir, fmt.Sprintf("20200101-0000%02d-1.jsonl", i)), nil, 0600)
+    }
+    if err := startRunLog(installDir, nil); err != nil {
+        t.Fatal(err)
+    }
+    runs, err := listRunLogs(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(runs) != maxRunLogs {
+        t.Errorf("%d run logs kept, want %d", len(runs), maxRunLogs)
+    }
+    if runs[0]+".jsonl" != filepath.Base(currentRun.path) {
+        t.Errorf("newest run %s is not the current one", runs[0])
+    }
+}
+
+func TestRunLogStepsOfConcurrentPanels(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    t.Cleanup(finishRunLog)
+    deployments := []Deployment{
+        {Name: "panel-one", DeployType: "1", KVID: "kv1", UUID: "uuid-one-value", TrPass: "pass-one", SubPath: "sub-one"},
+        {Name: "panel-two", DeployType: "1", KVID: "kv2", UUID: "uuid-two-value", TrPass: "pass-two", SubPath: "sub-two"},
+    }
+    if err := startRunLog(installDir, nil); err != nil {
+        t.Fatal(err)
+    }
+    captureStdout(t, func() {
+        redeployFleet(installDir, newMemoryBackend(), deployments, "set", false, 2, func(*Deployment) {})
+    })
+    path := currentRun.path
+    finishRunLog()
+
+    entries, err := readRunLog(runLogDir(installDir), strings.TrimSuffix(filepath.Base(path), ".jsonl"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    panelSteps := map[string][]string{}
+    for _, entry := range entries {
+        switch {
+        case entry.Event == "step" && entry.Panel != "":
+            panelSteps[entry.Panel] = append(panelSteps[entry.Panel], entry.Step)
+        case entry.Event != "step" && entry.Panel != "":
+            t.Errorf("entry claims a panel: %+v", entry)
+        }
+        if entry.Event != "step" && entry.Event != "start" && entry.Step != "deploy" && entry.Step != "prepare-worker" {
+            t.Errorf("entry carries a per-panel step: %+v", entry)
+        }
+    }
+    for _, deployment := range deployments {
+        if got := strings.Join(panelSteps[deployment.Name], " "); got != "create-kv build-config deploy" {
+            t.Errorf("%s steps: %q", deployment.Name, got)
+        }
+    }
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+    "bytes"
+    "io"
+    "os"
+    "os/exec"
+    "runtime"
+    "sync"
+    "time"
+)
+
+// Runner executes shell commands. Everything the wizard runs through
+// "sh -c" goes through a Runner so tests can script the results.
+type Runner interface {
+    Run(dir, command string) (string, error)
+    Start(dir, command string, stdout io.Writer) (Process, error)
+}
+
+// Process is a command started by Runner.Start.
+type Process interface {
+    Wait() error
+}
+
+type execRunner struct{}
+
+var (
+    commandRunner Runner = execRunner{}
+    sleep                = time.Sleep
+)
+
+func (execRunner) Run(dir, command string) (string, error) {
+    cmd := exec.Command("sh", "-c", command)
+    cmd.Dir = dir
+    cmd.Env = commandEnv()
+    var stdoutBuf, stderrBuf bytes.Buffer
+    cmd.Stdout = &stdoutBuf
+    cmd.Stderr = &stderrBuf
+    err := cmd.Run()
+    return stdoutBuf.String() + stderrBuf.String(), err
+}
+
+func (execRunner) Start(dir, command string, stdout io.Writer) (Process, error) {
+    cmd := exec.Command("sh", "-c", command)
+    cmd.Dir = dir
+    cmd.Env = commandEnv()
+    cmd.Stdout = stdout
+    cmd.Stderr = os.Stderr
+    cmd.Stdin = os.Stdin
+    if err := cmd.Start(); err != nil {
+        return nil, err
+    }
+    return cmd, nil
+}
+
+func runWith(runner Runner, cmdDir, command string, attempts int) (string, error) {
+    var output string
+    err := defaultRetryPolicy.withAttempts(attempts).do("Command", func() error {
+        var err error
+        start := time.Now()
+        output, err = runner.Run(cmdDir, command)
+        logCommand(command, start, output, err)
+        if err != nil {
+            return &commandError{err: err, output: output}
+        }
+        return nil
+    })
+    return output, err
+}
+
+func runCommand(cmdDir string, command string, attempts int) (string, error) {
+    return runWith(commandRunner, cmdDir, command, attempts)
+}
+
+func openURLCommand(url string) string {
+    if _, err := os.Stat("/data/data/com.termux"); err == nil {
+        return "TERMUX_API_VERSION=0.50 termux-open-url " + shellQuote(url)
+    }
+    if runtime.GOOS == "darwin" {
+        return "open " + shellQuote(url)
+    }
+    return "xdg-open " + shellQuote(url)
+}
+
+// syncBuffer lets the login loop poll output while the process writes it.
+type syncBuffer struct {
+    mu  sync.Mutex
+    buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.buf.String()
+}
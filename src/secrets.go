@@ -0,0 +1,68 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+)
+
+var secretsMode bool
+
+// panelSecrets returns the panel settings that grant access to the proxy.
+func panelSecrets(deployment *Deployment) map[string]string {
+    return map[string]string{
+        "UUID":     deployment.UUID,
+        "TR_PASS":  deployment.TrPass,
+        "SUB_PATH": deployment.SubPath,
+    }
+}
+
+// writeSecretsFile stores secrets for "wrangler secret bulk" in a file
+// only the current user can read. The caller removes it after the upload.
+func writeSecretsFile(dir, name string, secrets map[string]string) (string, error) {
+    jsonData, err := json.Marshal(secrets)
+    if err != nil {
+        return "", fmt.Errorf("error marshaling secrets: %v", err)
+    }
+    path := filepath.Join(dir, fmt.Sprintf(".secrets-%s.json", name))
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+    if err != nil {
+        return "", fmt.Errorf("error creating secrets file: %v", err)
+    }
+    if _, err := file.Write(jsonData); err != nil {
+        file.Close()
+        os.Remove(path)
+        return "", fmt.Errorf("error writing secrets file: %v", err)
+    }
+    if err := file.Close(); err != nil {
+        os.Remove(path)
+        return "", fmt.Errorf("error writing secrets file: %v", err)
+    }
+    return path, nil
+}
+
+// tightenPermissions removes group and other access from everything the
+// wizard writes into the install directory. node_modules is left alone.
+func tightenPermissions(installDir string) error {
+    return filepath.WalkDir(installDir, func(path string, entry fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if entry.IsDir() && entry.Name() == "node_modules" {
+            return filepath.SkipDir
+        }
+        if entry.Type()&fs.ModeSymlink != 0 {
+            return nil
+        }
+        info, err := entry.Info()
+        if err != nil {
+            return err
+        }
+        if mode := info.Mode().Perm(); mode&0077 != 0 {
+            return os.Chmod(path, mode&0700)
+        }
+        return nil
+    })
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// captureSecrets records the contents of secrets files passed to
+// "secret bulk" before the backend deletes them.
+func captureSecrets(t *testing.T, runner *fakeRunner) *map[string]string {
+    t.Helper()
+    captured := map[string]string{}
+    runner.inspect = func(command string) {
+        if !strings.Contains(command, "secret bulk ") {
+            return
+        }
+        fields := strings.Fields(strings.SplitN(command, "secret bulk ", 2)[1])
+        data, err := os.ReadFile(strings.Trim(fields[0], "'"))
+        if err != nil {
+            t.Errorf("secrets file is missing during upload: %v", err)
+            return
+        }
+        info, _ := os.Stat(strings.Trim(fields[0], "'"))
+        if info.Mode().Perm() != 0600 {
+            t.Errorf("secrets file mode = %o, want 600", info.Mode().Perm())
+        }
+        if err := json.Unmarshal(data, &captured); err != nil {
+            t.Errorf("secrets file is not JSON: %v", err)
+        }
+    }
+    return &captured
+}
+
+func assertSecretsMode(t *testing.T, installDir string, deployment *Deployment, captured map[string]string) {
+    t.Helper()
+    vars := readWranglerConfig(t, installDir)["vars"].(map[string]any)
+    for _, name := range []string{"UUID", "TR_PASS", "SUB_PATH"} {
+        if _, found := vars[name]; found {
+            t.Errorf("%s was written to wrangler.json in secrets mode", name)
+        }
+    }
+    if vars["PROXY_IP"] != deployment.ProxyIP {
+        t.Errorf("PROXY_IP var = %v", vars["PROXY_IP"])
+    }
+    if captured["UUID"] != deployment.UUID || captured["TR_PASS"] != deployment.TrPass || captured["SUB_PATH"] != deployment.SubPath {
+        t.Errorf("uploaded secrets %v do not match the deployment", captured)
+    }
+    if !deployment.SecretsMode {
+        t.Error("deployment record does not note secrets mode")
+    }
+    matches, _ := filepath.Glob(filepath.Join(installDir, ".secrets-*"))
+    if len(matches) != 0 {
+        t.Errorf("secrets files were left behind: %v", matches)
+    }
+    filepath.Walk(installDir, func(path string, info os.FileInfo, err error) error {
+        if err == nil && info.Mode().Perm()&0077 != 0 {
+            t.Errorf("%s is accessible to other users (mode %o)", path, info.Mode().Perm())
+        }
+        return nil
+    })
+}
+
+func indexOf(calls []string, match string) int {
+    for i, call := range calls {
+        if strings.Contains(call, match) {
+            return i
+        }
+    }
+    return -1
+}
+
+func TestWorkersSecretsMode(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    secretsMode = true
+    backend, runner, _ := newTestWranglerBackend(t, installDir)
+    runner.on("deploy ./src/worker.js", ok("https://panel.example.workers.dev"))
+    captured := captureSecrets(t, runner)
+
+    deployment, err := deployPanel(installDir, backend)
+    if err != nil {
+        t.Fatal(err)
+    }
+    assertSecretsMode(t, installDir, deployment, *captured)
+    upload := indexOf(runner.calls, "secret bulk")
+    if upload < 0 || !strings.HasSuffix(runner.calls[upload], "--name "+deployment.Name) {
+        t.Fatalf("secrets were not uploaded to the worker: %v", runner.calls)
+    }
+    if upload > indexOf(runner.calls, "deploy ./src/worker.js") {
+        t.Error("the worker was deployed before its secrets were uploaded")
+    }
+}
+
+func TestPagesSecretsMode(t *testing.T) {
+    installDir := setupDeploy(t, "2")
+    secretsMode = true
+    backend, runner, _ := newTestWranglerBackend(t, installDir)
+    runner.on("pages project create", ok("Successfully created the project"))
+    runner.on("pages deploy --commit-dirty", ok("Deployment complete!"))
+    captured := captureSecrets(t, runner)
+
+    deployment, err := deployPanel(installDir, backend)
+    if err != nil {
+        t.Fatal(err)
+    }
+    assertSecretsMode(t, installDir, deployment, *captured)
+    create := indexOf(runner.calls, "pages project create")
+    upload := indexOf(runner.calls, "pages secret bulk")
+    deploy := indexOf(runner.calls, "pages deploy --commit-dirty")
+    if !(create < upload && upload < deploy) {
+        t.Errorf("expected create, secret upload, deploy in order, got %d, %d, %d", create, upload, deploy)
+    }
+}
+
+func TestPlainVarsWithoutSecretsMode(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    backend := newMemoryBackend()
+    deployment, err := deployPanel(installDir, backend)
+    if err != nil {
+        t.Fatal(err)
+    }
+    vars := readWranglerConfig(t, installDir)["vars"].(map[string]any)
+    if vars["UUID"] != deployment.UUID || vars["SUB_PATH"] != deployment.SubPath {
+        t.Errorf("secrets missing from vars without secrets mode: %v", vars)
+    }
+    if len(backend.secrets) != 0 {
+        t.Error("secrets were uploaded without secrets mode")
+    }
+    info, err := os.Stat(filepath.Join(installDir, "wrangler.json"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if info.Mode().Perm() != 0600 {
+        t.Errorf("wrangler.json mode = %o, want 600", info.Mode().Perm())
+    }
+}
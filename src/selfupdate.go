@@ -0,0 +1,240 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "runtime"
+    "strconv"
+    "strings"
+)
+
+const (
+    wizardRepo        = "4n0nymou3/BPB-Terminal-Wizard"
+    wizardReleasesAPI = "https://api.github.com/repos/" + wizardRepo + "/releases"
+    maxBinarySize     = 100 * 1024 * 1024
+)
+
+func versionString() string {
+    return fmt.Sprintf("BPB Terminal Wizard %s (commit %s, %s/%s)", version, commit, runtime.GOOS, runtime.GOARCH)
+}
+
+func compareVersions(a, b string) int {
+    partsA := strings.Split(strings.TrimPrefix(a, "v"), ".")
+    partsB := strings.Split(strings.TrimPrefix(b, "v"), ".")
+    for i := 0; i < max(len(partsA), len(partsB)); i++ {
+        var numA, numB int
+        if i < len(partsA) {
+            numA, _ = strconv.Atoi(strings.SplitN(partsA[i], "-", 2)[0])
+        }
+        if i < len(partsB) {
+            numB, _ = strconv.Atoi(strings.SplitN(partsB[i], "-", 2)[0])
+        }
+        if numA != numB {
+            if numA < numB {
+                return -1
+            }
+            return 1
+        }
+    }
+    return 0
+}
+
+func wizardAssetName() string {
+    return fmt.Sprintf("BPB-Terminal-Wizard-%s-%s", runtime.GOOS, runtime.GOARCH)
+}
+
+func expectedAssetDigest(release *Release, assetName, tmpDir string) (string, error) {
+    asset, err := release.findAsset(assetName)
+    if err != nil {
+        return "", err
+    }
+    if digest := asset.sha256Digest(); digest != "" {
+        return digest, nil
+    }
+    sums, err := release.findAsset("SHA256SUMS")
+    if err != nil {
+        return "", fmt.Errorf("release %s publishes no checksum for %s", release.TagName, assetName)
+    }
+    sumsPath := filepath.Join(tmpDir, ".bpb-SHA256SUMS")
+    defer os.Remove(sumsPath)
+    if err := downloadFile(sums.BrowserDownloadURL, sumsPath, 1024*1024, 3); err != nil {
+        return "", fmt.Errorf("error downloading SHA256SUMS: %v", err)
+    }
+    file, err := os.Open(sumsPath)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == assetName && isValidSHA256(fields[0]) {
+            return strings.ToLower(fields[0]), nil
+        }
+    }
+    return "", fmt.Errorf("SHA256SUMS has no entry for %s", assetName)
+}
+
+func smokeCheck(binaryPath, expectedVersion string) error {
+    output, err := exec.Command(binaryPath, "-version").CombinedOutput()
+    if err != nil {
+        return fmt.Errorf("new binary failed to run: %v", err)
+    }
+    if !strings.Contains(string(output), strings.TrimPrefix(expectedVersion, "v")) {
+        return fmt.Errorf("new binary reports an unexpected version: %s", strings.TrimSpace(string(output)))
+    }
+    return nil
+}
+
+// downloadBinary fetches a release binary to newPath and checks it
+// against expectedSHA256. Nothing is left behind on failure.
+func downloadBinary(url, newPath, expectedSHA256 string) error {
+    if err := downloadFile(url, newPath, maxBinarySize, 3); err != nil {
+        return fmt.Errorf("error downloading update: %v", err)
+    }
+    digest, err := fileSHA256(newPath)
+    if err == nil && !strings.EqualFold(digest, expectedSHA256) {
+        err = fmt.Errorf("expected %s, got %s", expectedSHA256, digest)
+    }
+    if err != nil {
+        os.Remove(newPath)
+        return fmt.Errorf("checksum verification failed: %v", err)
+    }
+    if err := os.Chmod(newPath, 0755); err != nil {
+        os.Remove(newPath)
+        return fmt.Errorf("error making the new binary executable: %v", err)
+    }
+    return nil
+}
+
+// backupExecutable keeps a copy of the running binary at backupPath while
+// exePath stays in place, with a hard link where the filesystem allows.
+func backupExecutable(exePath, backupPath string) error {
+    os.Remove(backupPath)
+    if err := os.Link(exePath, backupPath); err == nil {
+        return nil
+    }
+    src, err := os.Open(exePath)
+    if err != nil {
+        return err
+    }
+    defer src.Close()
+    info, err := src.Stat()
+    if err != nil {
+        return err
+    }
+    dest, err := os.OpenFile(backupPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(dest, src); err != nil {
+        dest.Close()
+        os.Remove(backupPath)
+        return err
+    }
+    return dest.Close()
+}
+
+// replaceExecutable swaps newPath in with a single rename, so exePath is
+// never missing, and renames the backup back if the new binary fails
+// its smoke check.
+func replaceExecutable(exePath, newPath, expectedVersion string) error {
+    backupPath := exePath + ".old"
+    if err := backupExecutable(exePath, backupPath); err != nil {
+        os.Remove(newPath)
+        return fmt.Errorf("error backing up current binary: %v", err)
+    }
+    if err := os.Rename(newPath, exePath); err != nil {
+        os.Remove(newPath)
+        os.Remove(backupPath)
+        return fmt.Errorf("error installing new binary: %v", err)
+    }
+    if err := smokeCheck(exePath, expectedVersion); err != nil {
+        if rollbackErr := os.Rename(backupPath, exePath); rollbackErr != nil {
+            return fmt.Errorf("%v (rollback also failed: %v, previous binary kept at %s)", err, rollbackErr, backupPath)
+        }
+        return fmt.Errorf("%v, rolled back to the previous version", err)
+    }
+    os.Remove(backupPath)
+    return nil
+}
+
+func runSelfUpdate(args []string) {
+    fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+    force := fs.Bool("force", false, "Reinstall even if the current version is up to date")
+    check := fs.Bool("check", false, "Only check whether an update is available")
+    addNetworkFlags(fs)
+    fs.Parse(args)
+
+    if err := configureNetwork(); err != nil {
+        failMessage("Invalid network settings", err)
+        return
+    }
+
+    fmt.Printf("\n%s Checking for %sBPB Terminal Wizard%s updates...\n", titlePrefix, bold+blue, reset)
+    fmt.Printf("%s Current version: %s%s%s\n", infoPrefix, cyan, version, reset)
+    var release Release
+    if err := fetchReleaseJSON(wizardReleasesAPI+"/latest", &release); err != nil {
+        failMessage("Error checking for updates", err)
+        return
+    }
+    fmt.Printf("%s Latest version: %s%s%s\n", infoPrefix, cyan, release.TagName, reset)
+
+    if version == "dev" && !*force {
+        fmt.Printf("%s This is a development build; use -force to replace it with %s.\n", warnPrefix, release.TagName)
+        return
+    }
+    if version != "dev" && compareVersions(release.TagName, version) <= 0 && !*force {
+        successMessage("BPB Terminal Wizard is up to date.")
+        return
+    }
+    if *check {
+        fmt.Printf("%s Update available: %s -> %s. Run self-update to install it.\n", infoPrefix, version, release.TagName)
+        return
+    }
+
+    exePath, err := os.Executable()
+    if err != nil {
+        failMessage("Error locating the running executable", err)
+        return
+    }
+    if resolved, err := filepath.EvalSymlinks(exePath); err == nil {
+        exePath = resolved
+    }
+    exeDir := filepath.Dir(exePath)
+
+    assetName := wizardAssetName()
+    asset, err := release.findAsset(assetName)
+    if err != nil {
+        failMessage("No binary published for this platform", err)
+        return
+    }
+    expectedSHA256, err := expectedAssetDigest(&release, assetName, exeDir)
+    if err != nil {
+        failMessage("Refusing to update without a checksum", err)
+        return
+    }
+
+    newPath := exePath + ".new"
+    fmt.Printf("\n%s Downloading %s%s%s...\n", titlePrefix, bold+green, assetName, reset)
+    if err := downloadBinary(asset.BrowserDownloadURL, newPath, expectedSHA256); err != nil {
+        failMessage("Update aborted", err)
+        return
+    }
+    successMessage("Checksum verified.")
+
+    if err := replaceExecutable(exePath, newPath, release.TagName); err != nil {
+        if errors.Is(err, os.ErrPermission) {
+            err = fmt.Errorf("%v; try running with sudo", err)
+        }
+        failMessage("Update failed", err)
+        return
+    }
+    successMessage(fmt.Sprintf("Updated BPB Terminal Wizard to %s.", release.TagName))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func writeScript(t *testing.T, path, body string) {
+    t.Helper()
+    if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestDownloadBinaryChecksum(t *testing.T) {
+    setupDeploy(t, "1")
+    const binary = "#!/bin/sh\necho v1.1.0\n"
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(binary))
+    }))
+    defer server.Close()
+
+    newPath := filepath.Join(t.TempDir(), "wizard.new")
+    if err := downloadBinary(server.URL, newPath, sha256Hex("a different build")); err == nil || !strings.Contains(err.Error(), "checksum verification failed") {
+        t.Errorf("got %v, want a checksum mismatch", err)
+    }
+    if _, err := os.Stat(newPath); err == nil {
+        t.Error("the binary that failed its checksum was left behind")
+    }
+
+    if err := downloadBinary(server.URL, newPath, strings.ToUpper(sha256Hex(binary))); err != nil {
+        t.Fatal(err)
+    }
+    if info, err := os.Stat(newPath); err != nil || info.Mode().Perm()&0100 == 0 {
+        t.Errorf("verified binary missing or not executable: %v", err)
+    }
+}
+
+func TestReplaceExecutable(t *testing.T) {
+    tests := []struct {
+        name    string
+        newBody string
+        want    string
+        wantErr string
+    }{
+        {"working update", "echo 'BPB Terminal Wizard v1.1.0'", "v1.1.0", ""},
+        {"binary that does not run", "exit 1", "v1.0.0", "rolled back"},
+        {"binary with the wrong version", "echo 'BPB Terminal Wizard v0.9.0'", "v1.0.0", "rolled back"},
+    }
+    for _, tt := range tests {
+        dir := t.TempDir()
+        exePath, newPath := filepath.Join(dir, "wizard"), filepath.Join(dir, "wizard.new")
+        writeScript(t, exePath, "echo 'BPB Terminal Wizard v1.0.0'")
+        writeScript(t, newPath, tt.newBody)
+
+        err := replaceExecutable(exePath, newPath, "v1.1.0")
+        if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+            t.Errorf("%s: got %v, want error %q", tt.name, err, tt.wantErr)
+        }
+        if data, _ := os.ReadFile(exePath); !strings.Contains(string(data), tt.want) {
+            t.Errorf("%s: installed binary is %q, want %s", tt.name, data, tt.want)
+        }
+        for _, leftover := range []string{newPath, exePath + ".old"} {
+            if _, err := os.Stat(leftover); err == nil {
+                t.Errorf("%s: %s was left behind", tt.name, filepath.Base(leftover))
+            }
+        }
+    }
+}
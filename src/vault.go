@@ -0,0 +1,516 @@
+package main
+
+import (
+    "bytes"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "golang.org/x/crypto/scrypt"
+    "golang.org/x/term"
+)
+
+const (
+    vaultPassphraseEnv  = "BPB_VAULT_PASSPHRASE"
+    defaultVaultTimeout = 15 * time.Minute
+)
+
+// vaultScryptN is the scrypt cost; it is stored in each vault so it can
+// be raised later without breaking existing files.
+var vaultScryptN = 1 << 15
+
+var errVaultLocked = errors.New("the vault is locked, run vault unlock or set " + vaultPassphraseEnv)
+
+// vaultEnvelope is the on-disk format: an AES-256-GCM ciphertext whose
+// key is derived from the passphrase with scrypt.
+type vaultEnvelope struct {
+    Version    int    `json:"version"`
+    KDF        string `json:"kdf"`
+    N          int    `json:"n"`
+    R          int    `json:"r"`
+    P          int    `json:"p"`
+    Salt       []byte `json:"salt"`
+    Nonce      []byte `json:"nonce"`
+    Ciphertext []byte `json:"ciphertext"`
+}
+
+// vaultData is everything the wizard keeps about deployments, including
+// panel credentials and API tokens.
+type vaultData struct {
+    Deployments []Deployment      `json:"deployments"`
+    Tokens      map[string]string `json:"tokens,omitempty"`
+}
+
+type vaultSession struct {
+    Salt      []byte    `json:"salt"`
+    Key       []byte    `json:"key"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+// The unlocked key is kept for the lifetime of the process so the
+// passphrase is asked for at most once per run.
+var (
+    vaultKey     []byte
+    vaultKeySalt []byte
+)
+
+func vaultPath(installDir string) string {
+    return filepath.Join(installDir, "vault.json")
+}
+
+// vaultSessionPath is where an unlocked key is kept. Sessions live only in
+// the per-user runtime directory, which is cleared at logout; without one
+// there is no session and the path is empty.
+func vaultSessionPath() string {
+    if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+        return filepath.Join(dir, "bpb-terminal-wizard-vault-session.json")
+    }
+    return ""
+}
+
+// legacySessionPath is where older versions kept sessions next to the
+// vault. It is removed whenever sessions are read or locked.
+func legacySessionPath(installDir string) string {
+    return filepath.Join(installDir, ".vault-session.json")
+}
+
+func writeFileAtomic(path string, data []byte) error {
+    tmpPath := path + ".tmp"
+    if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+        return err
+    }
+    if err := os.Rename(tmpPath, path); err != nil {
+        os.Remove(tmpPath)
+        return err
+    }
+    return nil
+}
+
+func readVaultEnvelope(installDir string) (*vaultEnvelope, error) {
+    data, err := os.ReadFile(vaultPath(installDir))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("error reading vault: %v", err)
+    }
+    var envelope vaultEnvelope
+    if err := json.Unmarshal(data, &envelope); err != nil {
+        return nil, fmt.Errorf("error parsing vault: %v", err)
+    }
+    if envelope.Version != 1 || envelope.KDF != "scrypt" {
+        return nil, fmt.Errorf("unsupported vault format (version %d, kdf %s)", envelope.Version, envelope.KDF)
+    }
+    return &envelope, nil
+}
+
+func readPassphrase(prompt string, confirm bool) (string, error) {
+    if passphrase := os.Getenv(vaultPassphraseEnv); passphrase != "" {
+        registerSecret(passphrase)
+        return passphrase, nil
+    }
+    if !term.IsTerminal(int(os.Stdin.Fd())) {
+        return "", errVaultLocked
+    }
+    fmt.Fprintf(os.Stderr, "%s %s: ", infoPrefix, prompt)
+    passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+    fmt.Fprintln(os.Stderr)
+    if err != nil {
+        return "", fmt.Errorf("error reading passphrase: %v", err)
+    }
+    if len(passphrase) == 0 {
+        return "", fmt.Errorf("passphrase must not be empty")
+    }
+    if confirm {
+        fmt.Fprintf(os.Stderr, "%s Repeat the passphrase: ", infoPrefix)
+        repeat, err := term.ReadPassword(int(os.Stdin.Fd()))
+        fmt.Fprintln(os.Stderr)
+        if err != nil {
+            return "", fmt.Errorf("error reading passphrase: %v", err)
+        }
+        if !bytes.Equal(passphrase, repeat) {
+            return "", fmt.Errorf("passphrases do not match")
+        }
+    }
+    registerSecret(string(passphrase))
+    return string(passphrase), nil
+}
+
+func (e *vaultEnvelope) deriveKey(passphrase string) ([]byte, error) {
+    key, err := scrypt.Key([]byte(passphrase), e.Salt, e.N, e.R, e.P, 32)
+    if err != nil {
+        return nil, fmt.Errorf("error deriving vault key: %v", err)
+    }
+    return key, nil
+}
+
+func (e *vaultEnvelope) open(key []byte) ([]byte, error) {
+    aead, err := newVaultAEAD(key)
+    if err != nil {
+        return nil, err
+    }
+    plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, []byte("bpb-vault-v1"))
+    if err != nil {
+        return nil, fmt.Errorf("wrong vault passphrase or corrupted vault")
+    }
+    return plaintext, nil
+}
+
+func (e *vaultEnvelope) seal(key, plaintext []byte) error {
+    aead, err := newVaultAEAD(key)
+    if err != nil {
+        return err
+    }
+    e.Nonce = make([]byte, aead.NonceSize())
+    if _, err := rand.Read(e.Nonce); err != nil {
+        return fmt.Errorf("error generating nonce: %v", err)
+    }
+    e.Ciphertext = aead.Seal(nil, e.Nonce, plaintext, []byte("bpb-vault-v1"))
+    return nil
+}
+
+func newVaultAEAD(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, fmt.Errorf("error creating vault cipher: %v", err)
+    }
+    return cipher.NewGCM(block)
+}
+
+func newVaultEnvelope() (*vaultEnvelope, error) {
+    envelope := &vaultEnvelope{Version: 1, KDF: "scrypt", N: vaultScryptN, R: 8, P: 1, Salt: make([]byte, 16)}
+    if _, err := rand.Read(envelope.Salt); err != nil {
+        return nil, fmt.Errorf("error generating salt: %v", err)
+    }
+    return envelope, nil
+}
+
+// readVaultSession returns the key of an unexpired session for this vault.
+// A session that is expired, unreadable or for another vault is deleted
+// so the key does not stay on disk.
+func readVaultSession(installDir string, envelope *vaultEnvelope) []byte {
+    os.Remove(legacySessionPath(installDir))
+    path := vaultSessionPath()
+    if path == "" {
+        return nil
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil
+    }
+    var session vaultSession
+    if err := json.Unmarshal(data, &session); err != nil || time.Now().After(session.ExpiresAt) || !bytes.Equal(session.Salt, envelope.Salt) {
+        os.Remove(path)
+        return nil
+    }
+    return session.Key
+}
+
+// unlockVault returns the key for an existing vault, trying the in-process
+// key, an unlocked session, then the passphrase. With interactive false
+// it never prompts.
+func unlockVault(installDir string, envelope *vaultEnvelope, interactive bool) ([]byte, error) {
+    candidates := [][]byte{}
+    if vaultKey != nil && bytes.Equal(vaultKeySalt, envelope.Salt) {
+        candidates = append(candidates, vaultKey)
+    }
+    if key := readVaultSession(installDir, envelope); key != nil {
+        candidates = append(candidates, key)
+    }
+    for _, key := range candidates {
+        if _, err := envelope.open(key); err == nil {
+            vaultKey, vaultKeySalt = key, envelope.Salt
+            return key, nil
+        }
+    }
+    if !interactive && os.Getenv(vaultPassphraseEnv) == "" {
+        return nil, errVaultLocked
+    }
+    passphrase, err := readPassphrase("Vault passphrase", false)
+    if err != nil {
+        return nil, err
+    }
+    key, err := envelope.deriveKey(passphrase)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := envelope.open(key); err != nil {
+        return nil, err
+    }
+    vaultKey, vaultKeySalt = key, envelope.Salt
+    return key, nil
+}
+
+func writeVault(installDir string, envelope *vaultEnvelope, key []byte, data *vaultData) error {
+    plaintext, err := json.Marshal(data)
+    if err != nil {
+        return fmt.Errorf("error marshaling vault: %v", err)
+    }
+    if err := envelope.seal(key, plaintext); err != nil {
+        return err
+    }
+    jsonData, err := json.MarshalIndent(envelope, "", "  ")
+    if err != nil {
+        return fmt.Errorf("error marshaling vault: %v", err)
+    }
+    if err := os.MkdirAll(installDir, 0700); err != nil {
+        return fmt.Errorf("error creating install directory: %v", err)
+    }
+    if err := writeFileAtomic(vaultPath(installDir), jsonData); err != nil {
+        return fmt.Errorf("error writing vault: %v", err)
+    }
+    return nil
+}
+
+// createVault sets up a new vault, moving any plain-text deployment
+// records into it.
+func createVault(installDir string) (*vaultData, error) {
+    data := &vaultData{}
+    legacy, err := os.ReadFile(registryPath(installDir))
+    if err == nil {
+        if err := json.Unmarshal(legacy, &data.Deployments); err != nil {
+            return nil, fmt.Errorf("error parsing deployment records: %v", err)
+        }
+        fmt.Printf("%s Moving %d deployment record(s) into an encrypted vault.\n", infoPrefix, len(data.Deployments))
+    } else if !errors.Is(err, os.ErrNotExist) {
+        return nil, fmt.Errorf("error reading deployment records: %v", err)
+    }
+
+    fmt.Printf("%s Deployment credentials are kept in an encrypted vault. Choose a passphrase to protect it.\n", infoPrefix)
+    passphrase, err := readPassphrase("New vault passphrase", true)
+    if err != nil {
+        return nil, err
+    }
+    envelope, err := newVaultEnvelope()
+    if err != nil {
+        return nil, err
+    }
+    key, err := envelope.deriveKey(passphrase)
+    if err != nil {
+        return nil, err
+    }
+    if err := writeVault(installDir, envelope, key, data); err != nil {
+        return nil, err
+    }
+    vaultKey, vaultKeySalt = key, envelope.Salt
+    if err := os.Remove(registryPath(installDir)); err != nil && !errors.Is(err, os.ErrNotExist) {
+        fmt.Printf("%s Warning: Could not remove plain-text deployment records: %v\n", warnPrefix, err)
+    }
+    return data, nil
+}
+
+// loadVault decrypts the vault. When no vault exists yet it returns empty
+// data without asking for a passphrase, unless plain-text records need
+// to be migrated.
+func loadVault(installDir string) (*vaultData, error) {
+    envelope, err := readVaultEnvelope(installDir)
+    if err != nil {
+        return nil, err
+    }
+    if envelope == nil {
+        if _, err := os.Stat(registryPath(installDir)); err == nil {
+            return createVault(installDir)
+        }
+        return &vaultData{}, nil
+    }
+    key, err := unlockVault(installDir, envelope, true)
+    if err != nil {
+        return nil, err
+    }
+    plaintext, err := envelope.open(key)
+    if err != nil {
+        return nil, err
+    }
+    var data vaultData
+    if err := json.Unmarshal(plaintext, &data); err != nil {
+        return nil, fmt.Errorf("error parsing vault contents: %v", err)
+    }
+    return &data, nil
+}
+
+func saveVault(installDir string, data *vaultData) error {
+    envelope, err := readVaultEnvelope(installDir)
+    if err != nil {
+        return err
+    }
+    if envelope == nil {
+        if _, err := createVault(installDir); err != nil {
+            return err
+        }
+        if envelope, err = readVaultEnvelope(installDir); err != nil {
+            return err
+        }
+    }
+    key, err := unlockVault(installDir, envelope, true)
+    if err != nil {
+        return err
+    }
+    return writeVault(installDir, envelope, key, data)
+}
+
+// ensureVault makes sure deployment records can be saved before anything
+// is deployed, so a locked vault never loses a new panel's credentials.
+func ensureVault(installDir string) error {
+    envelope, err := readVaultEnvelope(installDir)
+    if err != nil {
+        return err
+    }
+    if envelope == nil {
+        _, err := createVault(installDir)
+        return err
+    }
+    _, err = unlockVault(installDir, envelope, true)
+    return err
+}
+
+// peekVault opens the vault only if that needs no prompt, and returns
+// nil otherwise.
+func peekVault(installDir string) *vaultData {
+    envelope, err := readVaultEnvelope(installDir)
+    if err != nil || envelope == nil {
+        return nil
+    }
+    key, err := unlockVault(installDir, envelope, false)
+    if err != nil {
+        return nil
+    }
+    plaintext, err := envelope.open(key)
+    if err != nil {
+        return nil
+    }
+    var data vaultData
+    if err := json.Unmarshal(plaintext, &data); err != nil {
+        return nil
+    }
+    return &data
+}
+
+// vaultToken returns a stored API token if the vault can be opened
+// without prompting.
+func vaultToken(installDir, name string) string {
+    data := peekVault(installDir)
+    if data == nil {
+        return ""
+    }
+    return data.Tokens[name]
+}
+
+func runVault(installDir string, args []string) {
+    if len(args) == 0 {
+        failMessage("Usage: vault unlock [-timeout 15m] | vault lock | vault export [-o file] | vault set-token [-name cloudflare]", nil)
+        return
+    }
+    switch args[0] {
+    case "unlock":
+        fs := flag.NewFlagSet("vault unlock", flag.ExitOnError)
+        timeout := fs.Duration("timeout", defaultVaultTimeout, "How long the vault stays unlocked")
+        fs.Parse(args[1:])
+
+        path := vaultSessionPath()
+        if path == "" {
+            failMessage(fmt.Sprintf("XDG_RUNTIME_DIR is not set, so there is no private place to keep the unlocked key. Set %s to run without a prompt instead.", vaultPassphraseEnv), nil)
+            os.Exit(1)
+        }
+        if err := ensureVault(installDir); err != nil {
+            failMessage("Could not unlock the vault", err)
+            os.Exit(1)
+        }
+        session := vaultSession{Salt: vaultKeySalt, Key: vaultKey, ExpiresAt: time.Now().Add(*timeout)}
+        jsonData, err := json.Marshal(session)
+        if err != nil {
+            failMessage("Error creating vault session", err)
+            return
+        }
+        if err := writeFileAtomic(path, jsonData); err != nil {
+            failMessage("Error saving vault session", err)
+            return
+        }
+        successMessage(fmt.Sprintf("Vault unlocked until %s. Run vault lock when you are done.", session.ExpiresAt.Local().Format("15:04")))
+    case "lock":
+        for _, path := range []string{vaultSessionPath(), legacySessionPath(installDir)} {
+            if path == "" {
+                continue
+            }
+            if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+                failMessage("Error locking the vault", err)
+                return
+            }
+        }
+        successMessage("Vault locked.")
+    case "export":
+        fs := flag.NewFlagSet("vault export", flag.ExitOnError)
+        output := fs.String("o", "", "Write the decrypted records to this file instead of stdout")
+        fs.Parse(args[1:])
+
+        data, err := loadVault(installDir)
+        if err != nil {
+            failMessage("Could not open the vault", err)
+            os.Exit(1)
+        }
+        jsonData, err := json.MarshalIndent(data, "", "  ")
+        if err != nil {
+            failMessage("Error exporting the vault", err)
+            return
+        }
+        if *output == "" {
+            fmt.Fprintf(os.Stderr, "%s The export below contains panel credentials in plain text.\n", warnPrefix)
+            fmt.Println(string(jsonData))
+            return
+        }
+        if err := os.WriteFile(*output, jsonData, 0600); err != nil {
+            failMessage("Error writing export", err)
+            return
+        }
+        fmt.Printf("%s %s contains panel credentials in plain text; delete it when you are done.\n", warnPrefix, *output)
+        successMessage(fmt.Sprintf("Exported %d deployment record(s).", len(data.Deployments)))
+    case "set-token":
+        fs := flag.NewFlagSet("vault set-token", flag.ExitOnError)
+        name := fs.String("name", "cloudflare", "Token name")
+        fs.Parse(args[1:])
+
+        data, err := loadVault(installDir)
+        if err != nil {
+            failMessage("Could not open the vault", err)
+            os.Exit(1)
+        }
+        token := os.Getenv("CLOUDFLARE_API_TOKEN")
+        if token == "" {
+            if !term.IsTerminal(int(os.Stdin.Fd())) {
+                failMessage("Set CLOUDFLARE_API_TOKEN or run this command in a terminal", nil)
+                return
+            }
+            fmt.Fprintf(os.Stderr, "%s API token: ", infoPrefix)
+            input, err := term.ReadPassword(int(os.Stdin.Fd()))
+            fmt.Fprintln(os.Stderr)
+            if err != nil {
+                failMessage("Error reading token", err)
+                return
+            }
+            token = strings.TrimSpace(string(input))
+        }
+        if token == "" {
+            failMessage("Token must not be empty", nil)
+            return
+        }
+        registerSecret(token)
+        if data.Tokens == nil {
+            data.Tokens = map[string]string{}
+        }
+        data.Tokens[*name] = token
+        if err := saveVault(installDir, data); err != nil {
+            failMessage("Error saving the vault", err)
+            return
+        }
+        successMessage(fmt.Sprintf("Stored the %s token in the vault.", *name))
+    default:
+        failMessage(fmt.Sprintf("Unknown vault command %q. Use: vault unlock | vault lock | vault export | vault set-token", args[0]), nil)
+    }
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    deployment := Deployment{Name: "calm-river-42", UUID: "6f1c1f0e-3b1a-4d55-9d1e-2a8f0b1c3d4e", TrPass: "s3cret!pass", SubPath: "sub-path-value"}
+    if err := recordDeployment(installDir, deployment); err != nil {
+        t.Fatal(err)
+    }
+
+    raw, err := os.ReadFile(vaultPath(installDir))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, secret := range []string{deployment.Name, deployment.UUID, deployment.TrPass, deployment.SubPath} {
+        if strings.Contains(string(raw), secret) {
+            t.Errorf("vault file contains %q in plain text", secret)
+        }
+    }
+    if info, _ := os.Stat(vaultPath(installDir)); info.Mode().Perm() != 0600 {
+        t.Errorf("vault mode = %o, want 600", info.Mode().Perm())
+    }
+
+    vaultKey, vaultKeySalt = nil, nil
+    record, err := findDeployment(installDir, deployment.Name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if record.TrPass != deployment.TrPass || record.UUID != deployment.UUID {
+        t.Errorf("decrypted record %+v does not match", record)
+    }
+
+    vaultKey, vaultKeySalt = nil, nil
+    t.Setenv(vaultPassphraseEnv, "wrong passphrase")
+    if _, err := loadDeployments(installDir); err == nil || !strings.Contains(err.Error(), "wrong vault passphrase") {
+        t.Errorf("expected a wrong passphrase error, got %v", err)
+    }
+
+    vaultKey, vaultKeySalt = nil, nil
+    t.Setenv(vaultPassphraseEnv, "")
+    if _, err := loadDeployments(installDir); err == nil || !strings.Contains(err.Error(), "vault is locked") {
+        t.Errorf("expected a locked vault without a passphrase, got %v", err)
+    }
+}
+
+func TestVaultMigratesPlainRecords(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    legacy, _ := json.Marshal([]Deployment{{Name: "old-panel", TrPass: "legacy-pass"}})
+    if err := os.WriteFile(registryPath(installDir), legacy, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    deployments, err := loadDeployments(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(deployments) != 1 || deployments[0].TrPass != "legacy-pass" {
+        t.Fatalf("legacy records were not migrated: %+v", deployments)
+    }
+    if _, err := os.Stat(registryPath(installDir)); !errors.Is(err, os.ErrNotExist) {
+        t.Error("plain-text deployments.json was left behind")
+    }
+    if _, err := os.Stat(vaultPath(installDir)); err != nil {
+        t.Errorf("vault was not created: %v", err)
+    }
+}
+
+func TestVaultSession(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    if err := recordDeployment(installDir, Deployment{Name: "session-panel"}); err != nil {
+        t.Fatal(err)
+    }
+
+    runVault(installDir, []string{"unlock", "-timeout", "5m"})
+    vaultKey, vaultKeySalt = nil, nil
+    t.Setenv(vaultPassphraseEnv, "")
+    if _, err := findDeployment(installDir, "session-panel"); err != nil {
+        t.Errorf("unlocked session did not open the vault: %v", err)
+    }
+
+    runVault(installDir, []string{"lock"})
+    vaultKey, vaultKeySalt = nil, nil
+    if _, err := loadDeployments(installDir); err == nil {
+        t.Error("vault opened after vault lock")
+    }
+}
+
+func TestVaultSessionExpiry(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    if err := recordDeployment(installDir, Deployment{Name: "session-panel"}); err != nil {
+        t.Fatal(err)
+    }
+    envelope, err := readVaultEnvelope(installDir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, session := range []vaultSession{
+        {Salt: envelope.Salt, Key: vaultKey, ExpiresAt: time.Now().Add(-time.Minute)},
+        {Salt: []byte("another vault"), Key: vaultKey, ExpiresAt: time.Now().Add(time.Hour)},
+    } {
+        data, _ := json.Marshal(session)
+        if err := os.WriteFile(vaultSessionPath(), data, 0600); err != nil {
+            t.Fatal(err)
+        }
+        if key := readVaultSession(installDir, envelope); key != nil {
+            t.Error("an expired or foreign session was used")
+        }
+        if _, err := os.Stat(vaultSessionPath()); !errors.Is(err, os.ErrNotExist) {
+            t.Error("the stale session file was left on disk")
+        }
+    }
+}
+
+func TestVaultUnlockNeedsRuntimeDir(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    t.Setenv("XDG_RUNTIME_DIR", "")
+    if vaultSessionPath() != "" {
+        t.Fatal("a session path was chosen without XDG_RUNTIME_DIR")
+    }
+    legacy := legacySessionPath(installDir)
+    if err := os.WriteFile(legacy, []byte(`{"key":"c2VjcmV0"}`), 0600); err != nil {
+        t.Fatal(err)
+    }
+    runVault(installDir, []string{"lock"})
+    if _, err := os.Stat(legacy); !errors.Is(err, os.ErrNotExist) {
+        t.Error("vault lock left a session from an older version")
+    }
+}
+
+func TestVaultToken(t *testing.T) {
+    installDir := setupDeploy(t, "1")
+    t.Setenv("CLOUDFLARE_API_TOKEN", "stored-token")
+    runVault(installDir, []string{"set-token"})
+    if got := vaultToken(installDir, "cloudflare"); got != "stored-token" {
+        t.Errorf("vault token = %q", got)
+    }
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+    "fmt"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+type stringList []string
+
+func (l *stringList) String() string {
+    return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            *l = append(*l, item)
+        }
+    }
+    return nil
+}
+
+func isValidWorkerURL(rawURL string) bool {
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return false
+    }
+    return (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+type WorkerScript struct {
+    Tag    string
+    SHA256 string
+    Source string
+}
+
+func copyLocalWorker(src, dest string) error {
+    data, err := os.ReadFile(src)
+    if err != nil {
+        return fmt.Errorf("error reading local worker file: %v", err)
+    }
+    if err := os.WriteFile(dest, data, 0640); err != nil {
+        return fmt.Errorf("error writing worker file: %v", err)
+    }
+    return nil
+}
+
+func downloadFromMirrors(mirrors []string, dest, expectedSHA256 string) (string, string, error) {
+    var lastErr error
+    for _, mirror := range mirrors {
+        fmt.Printf("%s Downloading from %s%s%s\n", infoPrefix, blue, mirror, reset)
+        if err := downloadFile(mirror, dest, maxWorkerSize, defaultRetryPolicy.maxAttempts); err != nil {
+            os.Remove(partFilePath(mirror, dest))
+            fmt.Printf("%s Download from %s failed: %v\n", warnPrefix, mirror, err)
+            lastErr = err
+            continue
+        }
+        digest, err := verifyWorkerScript(dest, expectedSHA256)
+        if err != nil {
+            os.Remove(dest)
+            fmt.Printf("%s Worker from %s failed verification: %v\n", warnPrefix, mirror, err)
+            lastErr = err
+            continue
+        }
+        return mirror, digest, nil
+    }
+    return "", "", fmt.Errorf("all download sources failed, last error: %v", lastErr)
+}
+
+// customWorkerDigest returns the digest a -worker-file or -worker-url
+// script must match: -worker-sha256 when given, otherwise the digest
+// published for the release named with -worker-version.
+func customWorkerDigest() string {
+    if workerSHA256 != "" || workerVersion == workerLatestTag || offlineMode {
+        return workerSHA256
+    }
+    release, err := resolveWorkerRelease(workerVersion)
+    if err != nil {
+        fmt.Printf("%s Warning: %v; only the trusted hash database can check %s.\n", warnPrefix, err, workerVersion)
+        return ""
+    }
+    if release.SHA256 != "" {
+        fmt.Printf("%s Checking against the published digest of %s%s%s\n", infoPrefix, cyan, release.Tag, reset)
+    }
+    return release.SHA256
+}
+
+func prepareWorkerScript(installDir, workerPath string) (*WorkerScript, error) {
+    if workerFile != "" {
+        absPath, err := filepath.Abs(workerFile)
+        if err != nil {
+            return nil, fmt.Errorf("error resolving worker file path: %v", err)
+        }
+        fmt.Printf("%s Using local worker file: %s%s%s\n", infoPrefix, cyan, absPath, reset)
+        if err := copyLocalWorker(absPath, workerPath); err != nil {
+            return nil, err
+        }
+        digest, err := verifyWorkerScript(workerPath, customWorkerDigest())
+        if err != nil {
+            os.Remove(workerPath)
+            return nil, fmt.Errorf("local worker file failed verification: %v", err)
+        }
+        if workerVersion == workerLatestTag {
+            return &WorkerScript{Tag: "local", SHA256: digest, Source: "local file " + absPath}, nil
+        }
+        script := &WorkerScript{Tag: workerVersion, SHA256: digest, Source: "local file " + absPath}
+        if err := checkScriptTrust(installDir, workerPath, script); err != nil {
+            return nil, err
+        }
+        return script, nil
+    }
+
+    if len(workerURLs) > 0 {
+        expectedSHA256 := customWorkerDigest()
+        if expectedSHA256 == "" {
+            if workerVersion == workerLatestTag && !allowNoDigest {
+                return nil, fmt.Errorf("no SHA-256 digest to check the worker from -worker-url against; pass -worker-sha256, name the release it mirrors with -worker-version, or rerun with -allow-unverified to deploy it unchecked")
+            }
+            fmt.Printf("%s Warning: No SHA-256 digest for the custom worker URLs; only basic payload checks will be applied.\n", warnPrefix)
+        }
+        mirror, digest, err := downloadFromMirrors(workerURLs, workerPath, expectedSHA256)
+        if err != nil {
+            return nil, err
+        }
+        if workerVersion == workerLatestTag {
+            return &WorkerScript{Tag: "custom", SHA256: digest, Source: mirror}, nil
+        }
+        script := &WorkerScript{Tag: workerVersion, SHA256: digest, Source: mirror}
+        if err := checkScriptTrust(installDir, workerPath, script); err != nil {
+            return nil, err
+        }
+        return script, nil
+    }
+
+    cache, err := openWorkerCache(installDir)
+    if err != nil {
+        return nil, err
+    }
+
+    if offlineMode {
+        entry, ok := cache.lookup(workerVersion)
+        if !ok {
+            return nil, fmt.Errorf("release %s is not in the worker cache; run once without -offline to cache it", workerVersion)
+        }
+        fmt.Printf("%s Offline mode: using cached release %s%s%s\n", infoPrefix, cyan, entry.Tag, reset)
+        if err := cache.restore(entry, workerPath); err != nil {
+            return nil, err
+        }
+        digest, err := verifyWorkerScript(workerPath, workerSHA256)
+        if err != nil {
+            os.Remove(workerPath)
+            return nil, fmt.Errorf("cached worker script failed verification: %v", err)
+        }
+        return &WorkerScript{Tag: entry.Tag, SHA256: digest, Source: "cache of " + entry.URL}, nil
+    }
+
+    fmt.Printf("%s Resolving %sBPB-Worker-Panel%s release...\n", infoPrefix, bold+green, reset)
+    release, err := resolveWorkerRelease(workerVersion)
+    if err != nil {
+        if release == nil {
+            return nil, fmt.Errorf("error resolving worker release: %v", err)
+        }
+        fmt.Printf("%s Warning: %v, continuing with %s...\n", warnPrefix, err, release.URL)
+    } else {
+        fmt.Printf("%s Using release: %s%s%s\n", infoPrefix, cyan, release.Tag, reset)
+    }
+    expectedSHA256 := release.SHA256
+    if workerSHA256 != "" {
+        expectedSHA256 = workerSHA256
+    }
+    if expectedSHA256 == "" {
+        // A pinned tag is still checked against the first digest seen for
+        // it; an unresolved latest has nothing at all to compare with.
+        if release.Tag == workerLatestTag && !allowNoDigest {
+            return nil, fmt.Errorf("no SHA-256 digest is available for the latest release; pin a release with -worker-version, pass -worker-sha256, or rerun with -allow-unverified to deploy it unchecked")
+        }
+        fmt.Printf("%s Warning: No published SHA-256 digest for this release; only basic payload checks will be applied.\n", warnPrefix)
+    }
+
+    var script *WorkerScript
+    if release.Tag == workerLatestTag {
+        script, err = fetchLatestWithRevalidation(cache, release.URL, workerPath, expectedSHA256)
+    } else {
+        script, err = fetchReleaseWithCache(cache, release, workerPath, expectedSHA256)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if err := checkScriptTrust(installDir, workerPath, script); err != nil {
+        return nil, err
+    }
+    return script, nil
+}
+
+// checkScriptTrust compares script with the first digest seen for its tag.
+// It fails closed: if the trusted hash database cannot be used, the script
+// is removed just as on a mismatch.
+func checkScriptTrust(installDir, workerPath string, script *WorkerScript) error {
+    trusted, err := checkTrustedHash(installDir, script.Tag, script.SHA256, workerSHA256 != "")
+    if err != nil {
+        os.Remove(workerPath)
+        return fmt.Errorf("could not check %s against the trusted hash database, refusing an unchecked worker.js (repair or remove %s): %v", script.Tag, trustedHashesPath(installDir), err)
+    }
+    if !trusted {
+        os.Remove(workerPath)
+        fmt.Printf("\n%s %sWARNING: THE CONTENT OF RELEASE %s HAS CHANGED SINCE IT WAS FIRST DOWNLOADED!%s\n", warnPrefix, bold+red, script.Tag, reset)
+        fmt.Printf("%s This may mean the release or a download mirror has been tampered with.\n", warnPrefix)
+        fmt.Printf("%s New SHA-256: %s\n", warnPrefix, script.SHA256)
+        fmt.Printf("%s If you have verified this change, rerun with %s-worker-sha256 %s%s to trust it.\n", warnPrefix, bold, script.SHA256, reset)
+        return fmt.Errorf("worker script does not match the trusted hash for %s", script.Tag)
+    }
+    return nil
+}
+
+func fetchReleaseWithCache(cache *WorkerCache, release *WorkerRelease, workerPath, expectedSHA256 string) (*WorkerScript, error) {
+    if entry, ok := cache.lookup(release.Tag); ok && (expectedSHA256 == "" || strings.EqualFold(entry.SHA256, expectedSHA256)) {
+        if err := cache.restore(entry, workerPath); err == nil {
+            if digest, err := verifyWorkerScript(workerPath, expectedSHA256); err == nil {
+                fmt.Printf("%s Using cached release %s%s%s\n", infoPrefix, cyan, release.Tag, reset)
+                if workerVersion == workerLatestTag {
+                    cache.Entries[workerLatestTag] = *entry
+                    if err := cache.save(); err != nil {
+                        fmt.Printf("%s Warning: Could not update worker cache: %v\n", warnPrefix, err)
+                    }
+                }
+                return &WorkerScript{Tag: release.Tag, SHA256: digest, Source: "cache of " + entry.URL}, nil
+            }
+        }
+        fmt.Printf("%s Cached copy of %s is unusable, downloading again...\n", warnPrefix, release.Tag)
+    }
+
+    mirror, digest, err := downloadFromMirrors([]string{release.URL}, workerPath, expectedSHA256)
+    if err != nil {
+        return nil, err
+    }
+    entry := CacheEntry{Tag: release.Tag, URL: mirror}
+    if err := cache.store(release.Tag, entry, workerPath); err != nil {
+        fmt.Printf("%s Warning: Could not cache worker script: %v\n", warnPrefix, err)
+    } else if workerVersion == workerLatestTag {
+        cache.Entries[workerLatestTag] = cache.Entries[release.Tag]
+        if err := cache.save(); err != nil {
+            fmt.Printf("%s Warning: Could not update worker cache: %v\n", warnPrefix, err)
+        }
+    }
+    return &WorkerScript{Tag: release.Tag, SHA256: digest, Source: mirror}, nil
+}
+
+func fetchLatestWithRevalidation(cache *WorkerCache, latestURL, workerPath, expectedSHA256 string) (*WorkerScript, error) {
+    cached, _ := cache.lookup(workerLatestTag)
+    var notModified bool
+    var etag, lastModified string
+    fmt.Printf("%s Downloading from %s%s%s\n", infoPrefix, blue, latestURL, reset)
+    err := defaultRetryPolicy.do("Download", func() error {
+        var err error
+        notModified, etag, lastModified, err = revalidateDownload(latestURL, workerPath, cached)
+        return err
+    })
+    if err == nil {
+        if notModified {
+            fmt.Printf("%s Cached latest release (%s) is still current.\n", infoPrefix, cached.Tag)
+            if err := cache.restore(cached, workerPath); err != nil {
+                return nil, err
+            }
+        }
+        digest, err := verifyWorkerScript(workerPath, expectedSHA256)
+        if err != nil {
+            os.Remove(workerPath)
+            return nil, fmt.Errorf("worker from %s failed verification: %v", latestURL, err)
+        }
+        if notModified {
+            return &WorkerScript{Tag: cached.Tag, SHA256: digest, Source: "cache of " + cached.URL}, nil
+        }
+        entry := CacheEntry{Tag: workerLatestTag, URL: latestURL, ETag: etag, LastModified: lastModified}
+        if err := cache.store(workerLatestTag, entry, workerPath); err != nil {
+            fmt.Printf("%s Warning: Could not cache worker script: %v\n", warnPrefix, err)
+        }
+        return &WorkerScript{Tag: workerLatestTag, SHA256: digest, Source: latestURL}, nil
+    }
+    fmt.Printf("%s Download from %s failed: %v\n", warnPrefix, latestURL, err)
+    if cached != nil {
+        fmt.Printf("%s Could not reach %s, falling back to the cached latest release (%s).\n", warnPrefix, latestURL, cached.Tag)
+        if err := cache.restore(cached, workerPath); err != nil {
+            return nil, err
+        }
+        digest, err := verifyWorkerScript(workerPath, expectedSHA256)
+        if err != nil {
+            os.Remove(workerPath)
+            return nil, fmt.Errorf("cached worker script failed verification: %v", err)
+        }
+        return &WorkerScript{Tag: cached.Tag, SHA256: digest, Source: "cache of " + cached.URL}, nil
+    }
+    return nil, fmt.Errorf("all download sources failed, last error: %v", err)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+const defaultWranglerVersion = "4.20.0"
+
+// wranglerCompatibility maps wizard major.minor versions to the Wrangler
+// version they were tested with.
+var wranglerCompatibility = map[string]string{
+    "1.3": "4.20.0",
+}
+
+var wranglerVersionFlag string
+
+func isValidWranglerVersion(v string) bool {
+    re, err := regexp.Compile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?$`)
+    if err != nil {
+        return false
+    }
+    return re.MatchString(v)
+}
+
+func pinnedWranglerVersion() string {
+    if wranglerVersionFlag != "" {
+        return wranglerVersionFlag
+    }
+    return wranglerForVersion(version)
+}
+
+// wranglerForVersion looks a wizard version such as v1.3.2 or the
+// git describe output of a build up by its major.minor.
+func wranglerForVersion(wizardVersion string) string {
+    parts := strings.SplitN(strings.TrimPrefix(wizardVersion, "v"), ".", 3)
+    if len(parts) >= 2 {
+        minor, _, _ := strings.Cut(parts[1], "-")
+        if pinned, ok := wranglerCompatibility[parts[0]+"."+minor]; ok {
+            return pinned
+        }
+    }
+    return defaultWranglerVersion
+}
+
+func shellQuote(s string) string {
+    return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func localWranglerBin(installDir string) string {
+    return filepath.Join(installDir, "node_modules", ".bin", "wrangler")
+}
+
+func wranglerCommand(installDir, args string) string {
+    return shellQuote(localWranglerBin(installDir)) + " " + args
+}
+
+func installedWranglerVersion(installDir string) (string, error) {
+    data, err := os.ReadFile(filepath.Join(installDir, "node_modules", "wrangler", "package.json"))
+    if err != nil {
+        return "", fmt.Errorf("wrangler is not installed in %s", installDir)
+    }
+    var pkg struct {
+        Version string `json:"version"`
+    }
+    if err := json.Unmarshal(data, &pkg); err != nil {
+        return "", fmt.Errorf("error parsing wrangler package.json: %v", err)
+    }
+    if _, err := os.Stat(localWranglerBin(installDir)); err != nil {
+        return "", fmt.Errorf("wrangler binary is missing from %s", installDir)
+    }
+    return pkg.Version, nil
+}
+
+func ensureLocalWrangler(installDir string) error {
+    pinned := pinnedWranglerVersion()
+    if installed, err := installedWranglerVersion(installDir); err == nil && installed == pinned {
+        fmt.Printf("%s Wrangler %s%s%s is already installed.\n", infoPrefix, cyan, installed, reset)
+        return nil
+    } else if err == nil {
+        fmt.Printf("%s Replacing Wrangler %s with tested version %s...\n", infoPrefix, installed, pinned)
+    } else {
+        fmt.Printf("%s Installing tested Wrangler version %s%s%s into %s...\n", infoPrefix, cyan, pinned, reset, installDir)
+    }
+
+    if err := os.MkdirAll(installDir, 0700); err != nil {
+        return fmt.Errorf("error creating install directory: %v", err)
+    }
+    if _, err := runCommand(installDir, "npm cache clean --force", 1); err != nil {
+        fmt.Printf("%s Warning: Could not clean npm cache, continuing anyway...\n", warnPrefix)
+    }
+    command := fmt.Sprintf("npm install --prefix %s --save-exact --no-audit --no-fund wrangler@%s", shellQuote(installDir), pinned)
+    if output, err := runCommand(installDir, command, 3); err != nil {
+        return fmt.Errorf("npm install failed: %v, output: %s", err, output)
+    }
+    installed, err := installedWranglerVersion(installDir)
+    if err != nil {
+        return err
+    }
+    if installed != pinned {
+        return fmt.Errorf("installed wrangler %s does not match pinned version %s", installed, pinned)
+    }
+    return nil
+}
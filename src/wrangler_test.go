@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestWranglerForVersion(t *testing.T) {
+    saved := wranglerCompatibility
+    wranglerCompatibility = map[string]string{"1.3": "4.20.0", "1.4": "4.25.1"}
+    defer func() { wranglerCompatibility = saved }()
+
+    tests := []struct {
+        version string
+        want    string
+    }{
+        {"v1.3.0", "4.20.0"},
+        {"1.3", "4.20.0"},
+        {"v1.3.7-rc1", "4.20.0"},
+        {"v1.3.0-5-gabc1234", "4.20.0"},
+        {"v1.4.2", "4.25.1"},
+        {"v1.30.0", defaultWranglerVersion},
+        {"v2.0.0", defaultWranglerVersion},
+        {"dev", defaultWranglerVersion},
+        {"abc1234", defaultWranglerVersion},
+    }
+    for _, tt := range tests {
+        if got := wranglerForVersion(tt.version); got != tt.want {
+            t.Errorf("wranglerForVersion(%q) = %s, want %s", tt.version, got, tt.want)
+        }
+    }
+
+    savedFlag := wranglerVersionFlag
+    wranglerVersionFlag = "4.99.0"
+    defer func() { wranglerVersionFlag = savedFlag }()
+    if got := pinnedWranglerVersion(); got != "4.99.0" {
+        t.Errorf("-wrangler-version was ignored: %s", got)
+    }
+}
+
+func TestIsValidWranglerVersion(t *testing.T) {
+    tests := []struct {
+        version string
+        ok      bool
+    }{
+        {"4.20.0", true},
+        {"4.21.0-beta.1", true},
+        {"4.20", false},
+        {"latest", false},
+        {"4.20.0; rm -rf /", false},
+    }
+    for _, tt := range tests {
+        if got := isValidWranglerVersion(tt.version); got != tt.ok {
+            t.Errorf("isValidWranglerVersion(%q) = %v, want %v", tt.version, got, tt.ok)
+        }
+    }
+}